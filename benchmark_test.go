@@ -2,6 +2,8 @@ package bttsetting
 
 import (
 	"context"
+	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/alicebob/miniredis/v2"
@@ -89,3 +91,163 @@ func BenchmarkGet_Parallel(b *testing.B) {
 		}
 	})
 }
+
+func BenchmarkSharedGetter(b *testing.B) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := context.Background()
+
+	op := NewPublisher(rdb, 1)
+	req := PublishRequest{
+		FullReplace: true,
+		Items: map[string][]RuleInput{
+			"bench_key": {
+				{
+					Tags:      map[string]any{"env": "prod"},
+					Value:     100,
+					ValueType: ValueTypeObject,
+				},
+				{
+					Tags:      map[string]any{},
+					Value:     200,
+					ValueType: ValueTypeObject,
+				},
+			},
+		},
+	}
+	op.Publish(ctx, req)
+	cfg, _ := New(rdb, 1)
+	sg := cfg.WithSharedTags(map[string]any{"env": "prod"})
+
+	b.Run("Serial", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			val, err := GetShared[int](sg, "bench_key")
+			if err != nil || val != 100 {
+				b.Fatalf("Get failed: %v, %v", val, err)
+			}
+		}
+	})
+
+	// 所有协程共享同一个 SharedGetter，对比 BenchmarkGet_Parallel 中每个协程一个 Getter
+	b.Run("Parallel", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				_, _ = GetShared[int](sg, "bench_key")
+			}
+		})
+	})
+}
+
+// BenchmarkGet_NewGetter 模拟每个请求新建 Getter，首次 Get 由求值缓存跳过规则匹配。
+func BenchmarkGet_NewGetter(b *testing.B) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := context.Background()
+
+	rules := make([]RuleInput, 0, 21)
+	for i := 0; i < 20; i++ {
+		rules = append(rules, RuleInput{Tags: map[string]any{"city": i, "env": "prod"}, Value: i})
+	}
+	rules = append(rules, RuleInput{Tags: map[string]any{"env": "prod"}, Value: 100})
+	op := NewPublisher(rdb, 1)
+	op.Publish(ctx, PublishRequest{
+		FullReplace: true,
+		Items:       map[string][]RuleInput{"bench_key": rules},
+	})
+
+	tags := map[string]any{"env": "prod", "city": "bj"}
+	for _, size := range []int{0, DefaultEvalCacheSize} {
+		cfg, _ := New(rdb, 1, WithEvalCacheSize(size))
+		b.Run(fmt.Sprintf("EvalCache=%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				val, err := Get[int](cfg.WithTags(tags), "bench_key")
+				if err != nil || val != 100 {
+					b.Fatalf("Get failed: %v, %v", val, err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkValueCache_Hit L2 命中不分配内存。
+func BenchmarkValueCache_Hit(b *testing.B) {
+	cfg := &Config{}
+	decodeValue[map[string]any](cfg, "h", `{"timeout":100,"retries":3}`)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, src, _ := decodeValue[map[string]any](cfg, "h", ""); src != SourceL2 {
+			b.Fatal("Expected l2 hit")
+		}
+	}
+}
+
+// BenchmarkValueCache_InsertFull 缓存已满时写入新值，每次写入都淘汰一个条目。
+func BenchmarkValueCache_InsertFull(b *testing.B) {
+	const limit = 10000
+	cfg := &Config{}
+	WithValueCacheLimit(limit, 0)(cfg)
+	for i := 0; i < limit; i++ {
+		decodeValue[int](cfg, fmt.Sprint(i), "1")
+	}
+	keys := make([]valueKey, b.N)
+	for i := range keys {
+		keys[i] = valueKey{hash: fmt.Sprint(limit + i), typ: reflect.TypeOf(0)}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cfg.valueCache.put(keys[i], i, 0)
+	}
+}
+
+// BenchmarkValue 与 BenchmarkGet 相同的数据，通过 Value 句柄读取。
+func BenchmarkValue(b *testing.B) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := context.Background()
+
+	op := NewPublisher(rdb, 1)
+	req := PublishRequest{
+		FullReplace: true,
+		Items: map[string][]RuleInput{
+			"bench_key": {
+				{Tags: map[string]any{"env": "prod"}, Value: 100, ValueType: ValueTypeObject},
+				{Tags: map[string]any{}, Value: 200, ValueType: ValueTypeObject},
+			},
+		},
+	}
+	if err := op.Publish(ctx, req); err != nil {
+		b.Fatalf("Publish failed: %v", err)
+	}
+	cfg, err := New(rdb, 1)
+	if err != nil {
+		b.Fatalf("New failed: %v", err)
+	}
+	v, err := ValueOf[int](cfg, "bench_key", map[string]any{"env": "prod"})
+	if err != nil {
+		b.Fatalf("ValueOf failed: %v", err)
+	}
+
+	b.Run("Serial", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if v.Load() != 100 {
+				b.Fatalf("Value mismatch")
+			}
+		}
+	})
+	b.Run("Parallel", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if v.Load() != 100 {
+					b.Fatalf("Value mismatch")
+				}
+			}
+		})
+	})
+}
@@ -0,0 +1,315 @@
+package bttsetting
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Binding 是 Bind 返回的结构体绑定句柄。
+// Load 返回当前快照下构建好的 *T，快照 AllHash 变化时由 Config.Load 重新构建并原子替换。
+// 返回的 *T 被所有调用方共享，只读使用。
+type Binding[T any] struct {
+	cfg    *Config
+	tags   map[string]any
+	plan   *bindPlan
+	ptr    atomic.Pointer[T]
+	remove func()
+
+	mu   sync.Mutex
+	hash string // 当前值对应的 AllHash
+	err  error  // 最近一次构建的错误
+}
+
+// Bind 按结构体字段的标签把配置绑定到 T，并在配置重载时自动重建。
+//
+// 支持的字段标签：
+//
+//	setting:"key"            字段对应的配置 Key；setting:"key,required" 表示 Key 必须存在
+//	default:"..."            Key 不存在且没有通过 Register 声明默认值时使用的值，按 JSON 解析，字符串字段可直接写文本
+//	validate:"..."           逗号分隔的校验规则：nonzero、min=N、max=N、oneof=a b c
+//
+// min/max 对数值比较大小，对字符串、切片、map 比较长度。
+// 没有 setting 标签的结构体字段按嵌套结构体递归绑定；带 setting 标签的字段（包括结构体、切片）
+// 按 Key 的 JSON 值整体解码。没有标签的其他字段保持零值。
+//
+// 初次构建失败（如必填 Key 缺失、校验不通过）时返回错误；重载时构建失败则保留上一次的值，
+// 错误记录日志并可通过 Err 获取。
+func Bind[T any](cfg *Config, tags map[string]any) (*Binding[T], error) {
+	typ := typeOf[T]()
+	if typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("bind: %s is not a struct", typ)
+	}
+	plan, err := compileBindPlan(typ, "")
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Binding[T]{cfg: cfg, tags: tags, plan: plan}
+	// 先注册再构建：构建期间发生的重载同样会触发重建，最终结果总是最新快照
+	b.remove = cfg.addReloadHook(func(_, _ *Snapshot) {
+		b.rebuild()
+	})
+	if err := b.rebuild(); err != nil {
+		b.remove()
+		return nil, err
+	}
+	return b, nil
+}
+
+// Load 返回当前的绑定结果。
+func (b *Binding[T]) Load() *T {
+	return b.ptr.Load()
+}
+
+// Err 返回最近一次重建的错误，成功时为 nil。
+func (b *Binding[T]) Err() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+// Close 停止随配置重载更新，Load 继续返回最后一次的值。
+func (b *Binding[T]) Close() {
+	b.remove()
+}
+
+// rebuild 按 Config 的当前快照构建 T，快照未变化时跳过。
+func (b *Binding[T]) rebuild() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ss := b.cfg.snapshot.Load().(*Snapshot)
+	if b.hash == ss.AllHash && b.ptr.Load() != nil {
+		return nil
+	}
+
+	// 使用固定到该快照的 Getter，所有字段读自同一个 AllHash
+	g := &Getter{cfg: b.cfg, rawTags: b.tags, cache: make(map[string]l1Entries), pinned: ss}
+	v := new(T)
+	if err := b.plan.fill(g, reflect.ValueOf(v).Elem()); err != nil {
+		b.err = err
+		slog.Error("bind rebuild failed", "type", reflect.TypeOf(v).Elem().String(), "allHash", ss.AllHash, "err", err)
+		return err
+	}
+	b.ptr.Store(v)
+	b.hash = ss.AllHash
+	b.err = nil
+	return nil
+}
+
+// bindPlan 结构体的绑定计划，Bind 时编译一次。
+type bindPlan struct {
+	fields []bindField
+}
+
+type bindField struct {
+	index    int
+	path     string // 字段路径，用于错误信息，如 DB.Host
+	key      string
+	required bool
+	def      reflect.Value // 默认值，无效表示没有默认值
+	rules    []validateRule
+	nested   *bindPlan // 没有 setting 标签的嵌套结构体
+}
+
+func compileBindPlan(typ reflect.Type, prefix string) (*bindPlan, error) {
+	plan := &bindPlan{}
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		f := bindField{index: i, path: prefix + sf.Name}
+
+		tag, tagged := sf.Tag.Lookup("setting")
+		if tag == "-" {
+			continue
+		}
+		if !tagged {
+			if sf.Type.Kind() != reflect.Struct {
+				continue
+			}
+			nested, err := compileBindPlan(sf.Type, f.path+".")
+			if err != nil {
+				return nil, err
+			}
+			if len(nested.fields) > 0 {
+				f.nested = nested
+				plan.fields = append(plan.fields, f)
+			}
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			return nil, fmt.Errorf("bind %s: empty setting key", f.path)
+		}
+		f.key = name
+		for _, opt := range strings.Split(opts, ",") {
+			switch opt {
+			case "":
+			case "required":
+				f.required = true
+			default:
+				return nil, fmt.Errorf("bind %s: unknown setting option %q", f.path, opt)
+			}
+		}
+
+		if def, ok := sf.Tag.Lookup("default"); ok {
+			v, err := parseDefault(def, sf.Type)
+			if err != nil {
+				return nil, fmt.Errorf("bind %s: invalid default %q: %w", f.path, def, err)
+			}
+			f.def = v
+		}
+		if spec := sf.Tag.Get("validate"); spec != "" {
+			rules, err := parseValidateRules(spec, sf.Type)
+			if err != nil {
+				return nil, fmt.Errorf("bind %s: %w", f.path, err)
+			}
+			f.rules = rules
+		}
+		plan.fields = append(plan.fields, f)
+	}
+	return plan, nil
+}
+
+// parseDefault 按 JSON 解析默认值；字符串字段的非 JSON 文本按原样使用。
+func parseDefault(def string, typ reflect.Type) (reflect.Value, error) {
+	ptr := reflect.New(typ)
+	err := unmarshalValue(def, ptr.Interface(), typ)
+	if err != nil && typ.Kind() == reflect.String {
+		ptr.Elem().SetString(def)
+		err = nil
+	}
+	return ptr.Elem(), err
+}
+
+// fill 把配置写入结构体 v，汇总所有字段的错误。
+func (p *bindPlan) fill(g *Getter, v reflect.Value) error {
+	var errs []error
+	for i := range p.fields {
+		f := &p.fields[i]
+		fv := v.Field(f.index)
+		if f.nested != nil {
+			if err := f.nested.fill(g, fv); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if err := f.fill(g, fv); err != nil {
+			errs = append(errs, fmt.Errorf("field %s (key %s): %w", f.path, f.key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// fill 读取字段对应的 Key：与 Get 使用同一条读取路径（L1、L2 缓存、注册的解码器与 Register 的默认值），
+// Key 缺失时再使用 default 标签。没有读到值也没有默认值时保持零值，不做校验。
+func (f *bindField) fill(g *Getter, fv reflect.Value) error {
+	val, source, err := getValue(g, f.key, fv.Type())
+	notFound := errors.Is(err, ErrNotFound)
+	if err != nil && !notFound {
+		return err
+	}
+	if f.required && (notFound || source == SourceDefault) {
+		return fmt.Errorf("required: %w", ErrNotFound)
+	}
+	if notFound {
+		if !f.def.IsValid() {
+			return nil
+		}
+		val = f.def
+	}
+	fv.Set(val)
+
+	for _, r := range f.rules {
+		if err := r.check(fv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateRule 单条字段校验规则。
+type validateRule struct {
+	name  string // nonzero、min、max、oneof
+	arg   float64
+	oneof map[string]struct{}
+}
+
+func parseValidateRules(spec string, typ reflect.Type) ([]validateRule, error) {
+	var rules []validateRule
+	for _, part := range strings.Split(spec, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(part), "=")
+		r := validateRule{name: name}
+		switch name {
+		case "nonzero":
+		case "min", "max":
+			if _, ok := sizeOf(reflect.Zero(typ)); !ok {
+				return nil, fmt.Errorf("validate %s: unsupported type %s", name, typ)
+			}
+			n, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				return nil, fmt.Errorf("validate %s: invalid number %q", name, arg)
+			}
+			r.arg = n
+		case "oneof":
+			r.oneof = make(map[string]struct{})
+			for _, s := range strings.Fields(arg) {
+				r.oneof[s] = struct{}{}
+			}
+			if len(r.oneof) == 0 {
+				return nil, fmt.Errorf("validate oneof: empty list")
+			}
+		default:
+			return nil, fmt.Errorf("unknown validate rule %q", name)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func (r *validateRule) check(v reflect.Value) error {
+	switch r.name {
+	case "nonzero":
+		if v.IsZero() {
+			return fmt.Errorf("validate nonzero: value is zero")
+		}
+	case "min":
+		if n, _ := sizeOf(v); n < r.arg {
+			return fmt.Errorf("validate min=%v: got %v", r.arg, n)
+		}
+	case "max":
+		if n, _ := sizeOf(v); n > r.arg {
+			return fmt.Errorf("validate max=%v: got %v", r.arg, n)
+		}
+	case "oneof":
+		s := fmt.Sprint(v.Interface())
+		if _, ok := r.oneof[s]; !ok {
+			return fmt.Errorf("validate oneof: %q not allowed", s)
+		}
+	}
+	return nil
+}
+
+// sizeOf 返回 min/max 比较的量：数值本身，或字符串、切片、map 的长度。
+func sizeOf(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len()), true
+	}
+	return 0, false
+}
@@ -0,0 +1,213 @@
+package bttsetting
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+type bindDB struct {
+	Host string `setting:"db.host,required"`
+	Port int    `setting:"db.port" default:"5432" validate:"min=1,max=65535"`
+}
+
+type bindSettings struct {
+	Timeout  int                  `setting:"timeout" validate:"min=1"`
+	Mode     string               `setting:"mode" default:"fast" validate:"oneof=fast safe"`
+	Hosts    []string             `setting:"hosts" validate:"min=1"`
+	Limits   map[string]int       `setting:"limits"`
+	Ratio    float64              `setting:"ratio" default:"0.5"`
+	Feature  bool                 `setting:"feature"`
+	DB       bindDB               // 嵌套结构体，按字段绑定
+	Backend  struct{ URL string } `setting:"backend"` // 整体按 JSON 解码
+	Ignored  string
+	internal string
+}
+
+func TestBind(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testbind:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	items := map[string][]RuleInput{
+		"timeout": {{Tags: map[string]any{"env": "prod"}, Value: 30}, {Value: 10}},
+		"hosts":   {{Value: []string{"a", "b"}}},
+		"limits":  {{Value: map[string]int{"qps": 100}}},
+		"feature": {{Value: true}},
+		"db.host": {{Value: "db.internal"}},
+		"backend": {{Value: map[string]any{"URL": "http://backend"}}},
+	}
+	if err := p.Publish(ctx, PublishRequest{FullReplace: true, Items: items}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	cfg, _ := New(rdb, 1)
+
+	b, err := Bind[bindSettings](cfg, map[string]any{"env": "prod"})
+	if err != nil {
+		t.Fatalf("Bind failed: %v", err)
+	}
+	s := b.Load()
+	if s.Timeout != 30 || s.Mode != "fast" || len(s.Hosts) != 2 || s.Limits["qps"] != 100 ||
+		s.Ratio != 0.5 || !s.Feature || s.DB.Host != "db.internal" || s.DB.Port != 5432 ||
+		s.Backend.URL != "http://backend" {
+		t.Errorf("Unexpected binding: %+v", s)
+	}
+
+	// 重载后重建并替换
+	items["timeout"] = []RuleInput{{Tags: map[string]any{"env": "prod"}, Value: 60}, {Value: 10}}
+	items["mode"] = []RuleInput{{Value: "safe"}}
+	p.Publish(ctx, PublishRequest{FullReplace: true, Items: items})
+	cfg.Load(ctx)
+	s2 := b.Load()
+	if s2 == s || s2.Timeout != 60 || s2.Mode != "safe" {
+		t.Errorf("Expected rebuilt binding, got %+v", s2)
+	}
+	if s.Timeout != 30 {
+		t.Error("Previous value must not be mutated")
+	}
+
+	// 重建失败保留上一次的值
+	items["mode"] = []RuleInput{{Value: "reckless"}}
+	p.Publish(ctx, PublishRequest{FullReplace: true, Items: items})
+	cfg.Load(ctx)
+	if b.Load() != s2 {
+		t.Error("Failed rebuild should keep previous value")
+	}
+	if err := b.Err(); err == nil || !strings.Contains(err.Error(), "oneof") {
+		t.Errorf("Expected oneof error, got %v", err)
+	}
+
+	// 修复后恢复
+	items["mode"] = []RuleInput{{Value: "fast"}}
+	p.Publish(ctx, PublishRequest{FullReplace: true, Items: items})
+	cfg.Load(ctx)
+	if b.Err() != nil || b.Load().Mode != "fast" {
+		t.Errorf("Expected recovered binding, got %+v, %v", b.Load(), b.Err())
+	}
+
+	// Close 后不再更新
+	b.Close()
+	last := b.Load()
+	items["timeout"] = []RuleInput{{Value: 1}}
+	p.Publish(ctx, PublishRequest{FullReplace: true, Items: items})
+	cfg.Load(ctx)
+	if b.Load() != last {
+		t.Error("Closed binding should not update")
+	}
+}
+
+func TestBind_SharedReadPath(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testbind4:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	p.Publish(ctx, PublishRequest{FullReplace: true, Items: map[string][]RuleInput{
+		"timeout": {{Value: "1.5s"}},
+	}})
+	cfg, _ := New(rdb, 1)
+	Register(cfg, "retries", 4)
+	Register(cfg, "host", "db.local")
+
+	type settings struct {
+		Timeout time.Duration `setting:"timeout"`
+		Retries int           `setting:"retries" default:"1" validate:"min=2"`
+		Host    string        `setting:"host,required"`
+		Missing int           `setting:"missing" validate:"min=1"`
+	}
+	_, err := Bind[settings](cfg, nil)
+	// 必填 Key 必须已发布，注册的默认值不能代替；未读到值也没有默认值的字段不做校验
+	if !errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), "Host") || strings.Contains(err.Error(), "Missing") {
+		t.Fatalf("Expected only the required error, got %v", err)
+	}
+
+	p.Publish(ctx, PublishRequest{Items: map[string][]RuleInput{"host": {{Value: "db.prod"}}}})
+	cfg.Load(ctx)
+	b, err := Bind[settings](cfg, nil)
+	if err != nil {
+		t.Fatalf("Bind failed: %v", err)
+	}
+	defer b.Close()
+	s := b.Load()
+	before := cfg.ValueCacheStats().Decodes
+	// 注册的解码器与默认值与 Get 一致，默认值优先于 default 标签
+	g := cfg.WithTags(nil)
+	if d, _ := Get[time.Duration](g, "timeout"); s.Timeout != d || d != 1500*time.Millisecond {
+		t.Errorf("Expected bound timeout %s to equal Get %s", s.Timeout, d)
+	}
+	if n, _ := Get[int](g, "retries"); s.Retries != n || n != 4 {
+		t.Errorf("Expected bound retries %d to equal Get %d", s.Retries, n)
+	}
+	if s.Missing != 0 {
+		t.Errorf("Expected zero for missing key, got %d", s.Missing)
+	}
+	// 字段读取写入了 L2 缓存，Get 直接命中
+	if after := cfg.ValueCacheStats().Decodes; after != before {
+		t.Errorf("Expected Get to hit the L2 entry written by Bind, decodes %d -> %d", before, after)
+	}
+}
+
+func TestBind_Errors(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testbind2:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	p.Publish(ctx, PublishRequest{FullReplace: true, Items: map[string][]RuleInput{
+		"timeout": {{Value: 0}},
+		"hosts":   {{Value: "not-a-list"}},
+	}})
+	cfg, _ := New(rdb, 1)
+
+	_, err := Bind[bindSettings](cfg, nil)
+	if err == nil {
+		t.Fatal("Expected bind error")
+	}
+	// 所有字段的错误一并返回
+	var tm *TypeMismatchError
+	if !errors.Is(err, ErrNotFound) || !errors.As(err, &tm) || tm.Key != "hosts" {
+		t.Errorf("Expected joined required and type errors, got %v", err)
+	}
+	for _, want := range []string{"DB.Host", "Timeout", "min=1"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %q in error: %v", want, err)
+		}
+	}
+	if len(cfg.hooks) != 0 {
+		t.Error("Failed Bind should unregister its reload hook")
+	}
+
+	if _, err := Bind[int](cfg, nil); err == nil {
+		t.Error("Expected error for non-struct type")
+	}
+	type badDefault struct {
+		N int `setting:"n" default:"abc"`
+	}
+	if _, err := Bind[badDefault](cfg, nil); err == nil || !strings.Contains(err.Error(), "invalid default") {
+		t.Errorf("Expected invalid default error, got %v", err)
+	}
+	type badRule struct {
+		N int `setting:"n" validate:"between=1"`
+	}
+	if _, err := Bind[badRule](cfg, nil); err == nil {
+		t.Error("Expected unknown rule error")
+	}
+	type badOption struct {
+		N int `setting:"n,optional"`
+	}
+	if _, err := Bind[badOption](cfg, nil); err == nil {
+		t.Error("Expected unknown option error")
+	}
+}
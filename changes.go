@@ -0,0 +1,305 @@
+package bttsetting
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+)
+
+// ChangeKind Key 的变化类型。
+type ChangeKind int
+
+const (
+	KeyAdded    ChangeKind = iota + 1 // 新快照中新增的 Key
+	KeyRemoved                        // 新快照中删除的 Key
+	KeyModified                       // 规则发生变化的 Key
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case KeyAdded:
+		return "added"
+	case KeyRemoved:
+		return "removed"
+	case KeyModified:
+		return "modified"
+	}
+	return fmt.Sprintf("ChangeKind(%d)", int(k))
+}
+
+// MarshalText 以名称序列化，便于日志与 JSON 输出。
+func (k ChangeKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// KeyChange 单个 Key 在两个快照之间的变化。
+type KeyChange struct {
+	Key  string     `json:"key"`
+	Kind ChangeKind `json:"kind"`
+	// OldRulesHash、NewRulesHash Key 的规则 Hash，新增或删除时对应一侧为空
+	OldRulesHash string `json:"oldRulesHash,omitempty"`
+	NewRulesHash string `json:"newRulesHash,omitempty"`
+	// ValuesChanged 规则引用的值集合是否变化；为 false 时只有匹配条件（标签、灰度等）变化
+	ValuesChanged bool `json:"valuesChanged"`
+}
+
+// ChangeSet 一次重载的结构化差异，Changes 按 Key 排序。
+type ChangeSet struct {
+	Version int         `json:"version"`
+	OldHash string      `json:"oldHash"`
+	NewHash string      `json:"newHash"`
+	Changes []KeyChange `json:"changes"`
+	// PendingRestart 发布了新值、等待重启生效的静态 Key（已排序），见 Config.Status
+	PendingRestart []string `json:"pendingRestart,omitempty"`
+
+	restartChanged bool // 等待重启的 Key 或其新值在本次重载中有变化
+	old, new       *Snapshot
+}
+
+// Changes 返回接收配置差异的通道，每次调用返回一个新的订阅，通常在启动时调用一次。
+//
+// 差异在 Config.Load 中按 Key 比较新旧快照的规则 Hash 得到，只包含有变化的 Key；
+// 首次加载不产生差异。投递在后台协程中进行，不阻塞重载：通道缓冲区满时丢弃该次差异并记录日志。
+// 上一次差异尚未投递时连续重载，两次差异合并为一次（旧快照到最新快照）。
+//
+// 静态 Key 的变更不出现在 Changes 中，而是记录在 ChangeSet.PendingRestart（见 WithPendingRestart）。
+func (c *Config) Changes() <-chan ChangeSet {
+	ch := make(chan ChangeSet, changesBuffer)
+	c.changes.subscribe(func(cs *ChangeSet) {
+		out := *cs
+		out.old, out.new = nil, nil // 不让通道中的差异持有快照
+		select {
+		case ch <- out:
+		default:
+			slog.Warn("config change dropped, channel full", "oldHash", cs.OldHash, "newHash", cs.NewHash)
+		}
+	})
+	return ch
+}
+
+// changesBuffer Changes 通道的缓冲区大小。
+const changesBuffer = 64
+
+// OnChange 在 key 对给定标签的取值变化时调用 fn，返回取消注册的函数。
+//
+// 仅当 key 的规则变化、且按 tags 匹配到的值 (ValueHash) 确实不同时才调用；
+// Key 新增或删除时缺失的一侧为 T 的零值。新值无法读取为 T 时不调用 fn，错误记录日志。
+// fn 在后台协程中按变化顺序串行调用，不阻塞重载，也不阻塞其他订阅者；fn 的 Panic 只记录日志。
+// fn 返回前发生的多次重载合并为一次比较。
+// 人群包更新与时间窗口边界不属于快照变化，不会触发 fn。
+func OnChange[T any](cfg *Config, key string, tags map[string]any, fn func(old, new T)) (cancel func()) {
+	return cfg.changes.subscribe(func(cs *ChangeSet) {
+		i := sort.Search(len(cs.Changes), func(i int) bool { return cs.Changes[i].Key >= key })
+		if i == len(cs.Changes) || cs.Changes[i].Key != key {
+			return
+		}
+		oldVal, oldHash, err := valueAt[T](cfg, cs.old, key, tags)
+		if err != nil {
+			// 旧值读取失败时按零值处理，仍然通知新值
+			oldHash = ""
+		}
+		newVal, newHash, err := valueAt[T](cfg, cs.new, key, tags)
+		if err != nil {
+			slog.Error("on change: read new value failed", "key", key, "allHash", cs.NewHash, "err", err)
+			return
+		}
+		if oldHash == newHash {
+			return
+		}
+		fn(oldVal, newVal)
+	})
+}
+
+// valueAt 读取快照 ss 下 key 的值及其 ValueHash，Key 不存在或未匹配时返回零值与空 Hash。
+// 只做规则匹配与反序列化：包括前置开关在内都不发送实验曝光，也不读写求值缓存。
+func valueAt[T any](cfg *Config, ss *Snapshot, key string, tags map[string]any) (T, string, error) {
+	var zero T
+	g := &Getter{cfg: cfg, rawTags: tags, cache: make(map[string]l1Entries), pinned: ss, quiet: true}
+	ev, err := g.evaluate(ss, key, nil)
+	if errors.Is(err, ErrNotFound) {
+		return zero, "", nil
+	}
+	if err != nil {
+		return zero, "", err
+	}
+	v, _, err := decodeValue[T](cfg, ev.valueHash, ev.rawJSON)
+	if err != nil {
+		var tm *TypeMismatchError
+		if errors.As(err, &tm) {
+			tm.Key = key
+		}
+		return zero, "", err
+	}
+	return v, ev.valueHash, nil
+}
+
+// diffSnapshots 比较两个快照，返回规则有变化的 Key（按 Key 排序）。
+func diffSnapshots(old, new *Snapshot) []KeyChange {
+	var changes []KeyChange
+	for key := range new.Rules {
+		nh := new.rulesHash(key)
+		if _, ok := old.Rules[key]; !ok {
+			changes = append(changes, KeyChange{Key: key, Kind: KeyAdded, NewRulesHash: nh, ValuesChanged: true})
+			continue
+		}
+		if oh := old.rulesHash(key); oh != nh {
+			changes = append(changes, KeyChange{
+				Key:           key,
+				Kind:          KeyModified,
+				OldRulesHash:  oh,
+				NewRulesHash:  nh,
+				ValuesChanged: !sameValueHashes(old.Rules[key], new.Rules[key]),
+			})
+		}
+	}
+	for key := range old.Rules {
+		if _, ok := new.Rules[key]; !ok {
+			changes = append(changes, KeyChange{Key: key, Kind: KeyRemoved, OldRulesHash: old.rulesHash(key), ValuesChanged: true})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
+
+// rulesHash 返回 Key 的规则 Hash。Load 时按 Redis 中的规则 JSON 计算；
+// 其他方式构建的快照按序列化结果计算。
+func (s *Snapshot) rulesHash(key string) string {
+	if h, ok := s.ruleHashes[key]; ok {
+		return h
+	}
+	data, _ := json.Marshal(s.Rules[key])
+	return CalculateHash16(data)
+}
+
+// sameValueHashes 判断两组规则引用的值集合是否相同。
+func sameValueHashes(a, b []Rule) bool {
+	sa, sb := make(map[string]struct{}), make(map[string]struct{})
+	for i := range a {
+		a[i].valueHashes(func(h string) { sa[h] = struct{}{} })
+	}
+	for i := range b {
+		b[i].valueHashes(func(h string) { sb[h] = struct{}{} })
+	}
+	if len(sa) != len(sb) {
+		return false
+	}
+	for h := range sa {
+		if _, ok := sb[h]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// changeDispatcher 投递配置差异，零值可用。
+// 每个订阅者有自己的后台协程，阻塞的订阅者不影响其他订阅者；没有待投递的差异时协程退出，下一次投递时重新启动。
+// 每个订阅者最多保留一个待投递的差异：前一个尚未开始投递时，新的差异与之合并（保留旧快照，换成最新的新快照），
+// 因此慢订阅者最多持有正在投递与待投递的两组快照。
+type changeDispatcher struct {
+	mu   sync.Mutex
+	subs map[uint64]*changeSub
+	seq  uint64
+}
+
+// changeSub 单个订阅者的投递状态，除 fn 外只在持有 changeDispatcher.mu 时访问。
+type changeSub struct {
+	fn        func(*ChangeSet)
+	pending   *ChangeSet
+	running   bool
+	cancelled bool
+}
+
+// subscribe 注册订阅者，返回取消注册的函数。取消后丢弃待投递的差异。
+func (d *changeDispatcher) subscribe(fn func(*ChangeSet)) (cancel func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.subs == nil {
+		d.subs = make(map[uint64]*changeSub)
+	}
+	d.seq++
+	id := d.seq
+	sub := &changeSub{fn: fn}
+	d.subs[id] = sub
+	return func() {
+		d.mu.Lock()
+		delete(d.subs, id)
+		sub.cancelled, sub.pending = true, nil
+		d.mu.Unlock()
+	}
+}
+
+// active 是否有订阅者，没有时 Load 跳过差异计算。
+func (d *changeDispatcher) active() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.subs) > 0
+}
+
+// publish 把差异交给每个订阅者，不阻塞。
+func (d *changeDispatcher) publish(cs *ChangeSet) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// 落后程度相同的订阅者共享同一个待投递差异，合并结果也共享
+	merged := make(map[*ChangeSet]*ChangeSet)
+	for _, sub := range d.subs {
+		switch {
+		case sub.pending == nil:
+			sub.pending = cs
+		case merged[sub.pending] != nil:
+			sub.pending = merged[sub.pending]
+		default:
+			m := mergeChangeSets(sub.pending, cs)
+			merged[sub.pending] = m
+			sub.pending = m
+		}
+		if !sub.running {
+			sub.running = true
+			go d.run(sub)
+		}
+	}
+}
+
+// mergeChangeSets 合并两次相邻的差异，等价于从 a 的旧快照直接重载到 b 的新快照。
+func mergeChangeSets(a, b *ChangeSet) *ChangeSet {
+	return &ChangeSet{
+		Version:        b.Version,
+		OldHash:        a.OldHash,
+		NewHash:        b.NewHash,
+		Changes:        diffSnapshots(a.old, b.new),
+		PendingRestart: b.PendingRestart,
+		restartChanged: a.restartChanged || b.restartChanged,
+		old:            a.old,
+		new:            b.new,
+	}
+}
+
+// run 依次投递 sub 的待投递差异，没有待投递的差异或订阅已取消时退出。
+func (d *changeDispatcher) run(sub *changeSub) {
+	for {
+		d.mu.Lock()
+		cs := sub.pending
+		if cs == nil || sub.cancelled {
+			sub.running = false
+			d.mu.Unlock()
+			return
+		}
+		sub.pending = nil
+		d.mu.Unlock()
+
+		// 合并后新旧快照可能没有差异（中间的变化被撤回）
+		if len(cs.Changes) == 0 && !cs.restartChanged {
+			continue
+		}
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					slog.Error("config change callback panicked", "panic", r)
+				}
+			}()
+			sub.fn(cs)
+		}()
+	}
+}
@@ -0,0 +1,268 @@
+package bttsetting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestOnChange(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testchanges:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	items := map[string][]RuleInput{
+		"pool":  {{Tags: map[string]any{"env": "prod"}, Value: 10}, {Value: 5}},
+		"other": {{Value: "a"}},
+	}
+	p.Publish(ctx, PublishRequest{FullReplace: true, Items: items})
+	cfg, _ := New(rdb, 1)
+
+	type change struct{ old, new int }
+	got := make(chan change, 10)
+	cancel := OnChange(cfg, "pool", map[string]any{"env": "prod"}, func(old, new int) {
+		got <- change{old, new}
+	})
+	// Panic 的回调不影响其他订阅者
+	OnChange(cfg, "pool", nil, func(old, new int) { panic("boom") })
+
+	expect := func(want change) {
+		t.Helper()
+		select {
+		case c := <-got:
+			if c != want {
+				t.Errorf("Expected %v, got %v", want, c)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected change %v", want)
+		}
+	}
+	publish := func() {
+		t.Helper()
+		if err := p.Publish(ctx, PublishRequest{FullReplace: true, Items: items}); err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+		cfg.Load(ctx)
+	}
+
+	items["pool"] = []RuleInput{{Tags: map[string]any{"env": "prod"}, Value: 20}, {Value: 5}}
+	publish()
+	expect(change{10, 20})
+
+	// 规则变化但对这组标签的取值不变、其他 Key 变化：不通知
+	items["pool"] = []RuleInput{{Tags: map[string]any{"env": "prod"}, Value: 20}, {Value: 6}}
+	items["other"] = []RuleInput{{Value: "b"}}
+	publish()
+
+	// 删除 Key：新值为零值
+	delete(items, "pool")
+	publish()
+	expect(change{20, 0})
+
+	cancel()
+	items["pool"] = []RuleInput{{Value: 1}}
+	publish()
+	select {
+	case c := <-got:
+		t.Errorf("Unexpected change after cancel: %v", c)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestOnChange_NoExposure(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testchanges3:")
+	ctx := context.Background()
+
+	// pool 依赖实验开关 gate：比较新旧值时求值前置开关不应发送曝光
+	p := NewPublisher(rdb, 1)
+	items := map[string][]RuleInput{
+		"gate": {{Experiment: &ExperimentInput{ID: "exp", Tag: "uid", Variants: []VariantInput{
+			{Name: "on", Weight: 100, Value: true},
+		}}}},
+		"pool": {{Value: 10, Prerequisites: []Prerequisite{{Key: "gate", Want: true}}}},
+	}
+	p.Publish(ctx, PublishRequest{Items: items})
+	sink := &memorySink{}
+	cfg, _ := New(rdb, 1, WithExposureSink(sink), WithEvalCacheSize(16))
+
+	got := make(chan int, 1)
+	OnChange(cfg, "pool", map[string]any{"uid": "u1"}, func(_, new int) { got <- new })
+	items["pool"] = []RuleInput{{Value: 20, Prerequisites: []Prerequisite{{Key: "gate", Want: true}}}}
+	p.Publish(ctx, PublishRequest{Items: items})
+	cfg.Load(ctx)
+
+	select {
+	case v := <-got:
+		if v != 20 {
+			t.Errorf("Expected 20, got %d", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected change")
+	}
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if len(sink.events) != 0 {
+		t.Errorf("Expected no exposures from OnChange, got %d", len(sink.events))
+	}
+	if st := cfg.EvalCacheStats(); st.Hits+st.Misses != 0 || st.Size != 0 {
+		t.Errorf("Expected OnChange to bypass the eval cache, got %+v", st)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testchanges2:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	p.Publish(ctx, PublishRequest{FullReplace: true, Items: map[string][]RuleInput{
+		"a": {{Value: 1}},
+		"b": {{Tags: map[string]any{"env": "prod"}, Value: 2}},
+		"c": {{Value: 3}},
+	}})
+	cfg, _ := New(rdb, 1)
+	oldHash := cfg.snapshot.Load().(*Snapshot).AllHash
+
+	// 阻塞的回调不影响重载
+	release := make(chan struct{})
+	OnChange(cfg, "a", nil, func(old, new int) { <-release })
+	ch := cfg.Changes()
+
+	p.Publish(ctx, PublishRequest{FullReplace: true, Items: map[string][]RuleInput{
+		"a": {{Value: 10}},
+		"b": {{Tags: map[string]any{"env": "staging"}, Value: 2}},
+		"d": {{Value: 4}},
+	}})
+	done := make(chan struct{})
+	go func() {
+		cfg.Load(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Load blocked by change callback")
+	}
+	newHash := cfg.snapshot.Load().(*Snapshot).AllHash
+	close(release)
+
+	select {
+	case cs := <-ch:
+		if cs.OldHash != oldHash || cs.NewHash != newHash || cs.Version != 1 {
+			t.Errorf("Unexpected change set: %+v", cs)
+		}
+		want := []struct {
+			key           string
+			kind          ChangeKind
+			valuesChanged bool
+		}{
+			{"a", KeyModified, true},
+			{"b", KeyModified, false},
+			{"c", KeyRemoved, true},
+			{"d", KeyAdded, true},
+		}
+		if len(cs.Changes) != len(want) {
+			t.Fatalf("Expected %d changes, got %+v", len(want), cs.Changes)
+		}
+		for i, w := range want {
+			c := cs.Changes[i]
+			if c.Key != w.key || c.Kind != w.kind || c.ValuesChanged != w.valuesChanged {
+				t.Errorf("Change %d: got %+v, want %+v", i, c, w)
+			}
+		}
+		if cs.Changes[3].OldRulesHash != "" || cs.Changes[3].NewRulesHash == "" {
+			t.Errorf("Unexpected rules hashes: %+v", cs.Changes[3])
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected change set")
+	}
+
+	// 快照未变化时没有差异
+	cfg.Load(ctx)
+	select {
+	case cs := <-ch:
+		t.Errorf("Unexpected change set: %+v", cs)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if KeyAdded.String() != "added" || ChangeKind(9).String() != "ChangeKind(9)" {
+		t.Error("Unexpected ChangeKind string")
+	}
+}
+
+func TestChanges_BlockedSubscriber(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testchanges4:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	p.Publish(ctx, PublishRequest{FullReplace: true, Items: map[string][]RuleInput{"a": {{Value: 0}}}})
+	cfg, _ := New(rdb, 1)
+
+	// 第一个订阅者阻塞在第一次变化上
+	type change struct{ old, new int }
+	blocked := make(chan change, 10)
+	release := make(chan struct{})
+	OnChange(cfg, "a", nil, func(old, new int) {
+		blocked <- change{old, new}
+		<-release
+	})
+	fast := make(chan int, 10)
+	OnChange(cfg, "a", nil, func(_, new int) { fast <- new })
+	ch := cfg.Changes()
+	expectBlocked := func(want change) {
+		t.Helper()
+		select {
+		case c := <-blocked:
+			if c != want {
+				t.Errorf("Expected %v, got %v", want, c)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected change %v", want)
+		}
+	}
+
+	for i := 1; i <= 3; i++ {
+		p.Publish(ctx, PublishRequest{Items: map[string][]RuleInput{"a": {{Value: i}}}})
+		cfg.Load(ctx)
+		// 其他订阅者与 Changes 通道不受影响，逐次收到变化
+		select {
+		case v := <-fast:
+			if v != i {
+				t.Errorf("Expected %d, got %d", i, v)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Subscriber stalled by a blocked callback at change %d", i)
+		}
+		select {
+		case <-ch:
+		case <-time.After(time.Second):
+			t.Fatalf("Changes stalled by a blocked callback at change %d", i)
+		}
+		if i == 1 {
+			expectBlocked(change{0, 1})
+		}
+	}
+
+	// 阻塞期间的两次变化合并为一次：从 1 直接到 3
+	close(release)
+	expectBlocked(change{1, 3})
+	select {
+	case c := <-blocked:
+		t.Errorf("Unexpected change %v", c)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -2,12 +2,12 @@ package bttsetting
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 )
@@ -21,19 +21,77 @@ type Config struct {
 	rdb      *redis.Client
 	version  int
 	snapshot atomic.Value // 存储 *Snapshot
-	mu       sync.RWMutex // 用于更新操作
-	// 全局 ValueCache (L2) 减少反序列化开销
-	// Key: ValueHash + string(reflect.Type), Value: any
-	valueCache sync.Map
+	mu       sync.RWMutex // 用于更新操作 (串行化 Load 中的快照切换与变更投递)
+	// 全局 ValueCache (L2) 减少反序列化开销，按 (ValueHash, reflect.Type) 缓存
+	valueCache valueCache
+
+	// normalizeTags 为 true 时，Getter 按快照中的标签字典规范化输入标签，
+	// 并统计字典中未定义的标签 Key (unknownTags: Key -> *atomic.Int64)。
+	normalizeTags bool
+	unknownTags   sync.Map
+
+	// exposureSink 接收实验曝光事件 (可选)
+	exposureSink ExposureSink
+
+	// segments 当前快照引用的人群包
+	segments *segmentStore
+
+	// now 规则时间窗口求值使用的时钟
+	now func() time.Time
+
+	// unknownMatchers 规则引用但未注册的匹配器 (Name -> *atomic.Int64)
+	unknownMatchers sync.Map
+
+	// evals 跨 Getter 的求值缓存，nil 表示关闭
+	evals *evalCache
+
+	// hooks 快照变化后的重载回调 (见 addReloadHook)，hooksRun 串行化回调的执行
+	hooksMu  sync.Mutex
+	hooks    map[uint64]reloadHook
+	hookSeq  uint64
+	hooksRun sync.Mutex
+
+	// changes 配置差异的订阅者 (见 Changes、OnChange)
+	changes changeDispatcher
+
+	// static 进程启动时的静态 Key，第一次加载快照时记录；
+	// pending 等待重启生效的静态 Key -> 新发布的规则 Hash。均由 mu 保护
+	static  *staticKeys
+	pending map[string]string
+
+	// registry 通过 Register 声明的 Key
+	registry keyRegistry
+
+	// recordTypes 为 true 时记录 Get 读取各 Key 使用的类型 (readType -> struct{})，见 WithTypeRecording
+	recordTypes bool
+	readTypes   sync.Map
+}
+
+// Option 是 New 的可选配置项。
+type Option func(*Config)
+
+// WithTagNormalization 开启输入标签规范化：按快照中发布的标签字典处理 Getter 的输入标签
+// （如转小写、去除空白），并统计字典中未定义的标签 Key，可通过 UnknownTagCounts 查看。
+func WithTagNormalization() Option {
+	return func(c *Config) {
+		c.normalizeTags = true
+	}
 }
 
 // New 创建一个新的 Config 实例。
 // client: Redis 客户端实例（外部传入，DI）。
 // version: 配置版本号，用于版本控制。
-func New(client *redis.Client, version int) (*Config, error) {
+// opts: 可选配置项。
+func New(client *redis.Client, version int, opts ...Option) (*Config, error) {
 	c := &Config{
-		rdb:     client,
-		version: version,
+		rdb:      client,
+		version:  version,
+		segments: newSegmentStore(client),
+		now:      time.Now,
+		evals:    newEvalCache(DefaultEvalCacheSize),
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
 
 	// 初始化空快照
@@ -52,86 +110,438 @@ func New(client *redis.Client, version int) (*Config, error) {
 	return c, nil
 }
 
+// UnknownTagCounts 返回 Getter 输入中出现过、但不在标签字典中的标签 Key 及其出现次数。
+// 仅在开启 WithTagNormalization 时统计，用于诊断拼写错误的标签。
+func (c *Config) UnknownTagCounts() map[string]int64 {
+	out := make(map[string]int64)
+	c.unknownTags.Range(func(k, v any) bool {
+		out[k.(string)] = v.(*atomic.Int64).Load()
+		return true
+	})
+	return out
+}
+
+// countUnknownTag 记录一次未知标签 Key。
+func (c *Config) countUnknownTag(key string) {
+	v, ok := c.unknownTags.Load(key)
+	if !ok {
+		v, _ = c.unknownTags.LoadOrStore(key, new(atomic.Int64))
+	}
+	v.(*atomic.Int64).Add(1)
+}
+
 // WithTags 创建一个感知上下文的 Getter。
+// 标签值可以是标量，也可以是切片/数组/集合（如 []string、map[string]struct{}），
+// 后者按“包含”语义匹配规则中的标量标签。
+// 若快照定义了标签层级，Getter 会在每个快照下展开一次上级标签（见 Snapshot.ExpandTags），
+// 每条规则不匹配输入标签本身时，逐级使用更宽泛的上级标签匹配，规则之间仍按列表顺序决定优先级；
+// 开启 WithTagNormalization 时还会先按标签字典规范化输入标签。
+// Getter 在第一次读取时固定当时的快照，之后的读取都来自同一个 AllHash，见 Refresh。
 func (c *Config) WithTags(tags map[string]any) *Getter {
 	return &Getter{
-		cfg:   c,
-		tags:  tags,
-		cache: make(map[string]CacheEntry),
+		cfg:     c,
+		rawTags: tags,
+		cache:   make(map[string]l1Entries),
 	}
 }
 
 // UpdateTags 更新 Getter 的 Tags 并清空本地缓存。
 func (g *Getter) UpdateTags(tags map[string]any) {
-	g.tags = tags
-	g.cache = make(map[string]CacheEntry)
+	g.rawTags = tags
+	g.tags = nil
+	g.levels = nil
+	g.tagsHash = ""
+	g.resolved = false
+	g.cache = make(map[string]l1Entries)
 }
 
 // Getter 是一个感知上下文的配置访问器。
 // 对于并发的同一个泛型调用如果不加锁是不安全的，
 // 但通常 Getter 是每个请求一个。
-// 如果需要并发使用，需要加锁。
+// 如果需要并发使用，需要加锁，或使用标签固定的 SharedGetter（见 Config.WithSharedTags）。
 // 考虑到“纳秒级”要求，单协程使用时避免锁是首选。
 type Getter struct {
-	cfg   *Config
-	tags  map[string]any
-	cache map[string]CacheEntry
+	cfg     *Config
+	rawTags map[string]any // 调用方传入的原始标签
+	// tags 是针对 tagsHash 对应快照解析后的标签（完全展开了层级），levels 为逐级展开的各级标签
+	// (levels[0] 为输入标签本身，最后一级即 tags)。每个快照只解析一次，快照变化时重新解析。
+	tags        map[string]any
+	levels      []map[string]any
+	tagsHash    string
+	resolved    bool
+	fingerprint string // tags 的指纹，惰性计算，随 tags 一起失效
+	evalKey     string // tags 的求值缓存键，惰性计算，随 tags 一起失效
+	hasEvalKey  bool
+	cache       map[string]l1Entries
+	// shared SharedGetter 已发布的 L1 缓存（只读），cache 中没有的 Key 在其中查找，见 entries
+	shared *sharedState
+	depth  int // 当前前置开关求值的嵌套深度
+	// quiet 为 true 时不发送实验曝光、不写入 L1 缓存、不读写跨 Getter 的求值缓存，
+	// 用于内部比较快照与求值详情（见 valueAt、Explain）
+	quiet bool
+	// pinned 第一次读取时固定的快照，保证同一请求内的读取来自同一个 AllHash；
+	// 为 nil 表示尚未读取或已调用 Refresh。
+	pinned *Snapshot
 }
 
-// Get 获取配置值。
+// snapshot 返回 Getter 固定的快照，首次调用时固定 Config 的当前快照。
+func (g *Getter) snapshot() *Snapshot {
+	if g.pinned == nil {
+		g.pinned = g.cfg.snapshot.Load().(*Snapshot)
+	}
+	return g.pinned
+}
+
+// Refresh 解除快照固定，下一次读取将使用 Config 的最新快照。
+// 长生命周期的 Getter（如后台任务）应在每轮处理开始时调用。
+// L1 缓存按快照 Hash 校验，无需清空。
+func (g *Getter) Refresh() {
+	g.pinned = nil
+}
+
+// resolveTags 返回针对给定快照解析后的标签。
+func (g *Getter) resolveTags(ss *Snapshot) map[string]any {
+	if !g.resolved || g.tagsHash != ss.AllHash {
+		tags := g.rawTags
+		if g.cfg.normalizeTags {
+			tags = ss.NormalizeTags(tags, g.cfg.countUnknownTag)
+		}
+		g.levels = ss.tagLevels(tags)
+		g.tags = g.levels[len(g.levels)-1]
+		g.tagsHash = ss.AllHash
+		g.resolved = true
+		g.fingerprint = ""
+		g.hasEvalKey = false
+	}
+	return g.tags
+}
+
+// tagsFingerprint 返回解析后标签的指纹，需在 resolveTags 之后调用。
+func (g *Getter) tagsFingerprint() string {
+	if g.fingerprint == "" {
+		g.fingerprint = TagsFingerprint(g.tags)
+	}
+	return g.fingerprint
+}
+
+// tagsEvalKey 返回解析后标签的求值缓存键，需在 resolveTags 之后调用。
+// 各级标签由输入标签与快照唯一确定，因此按输入标签（第 0 级）区分。
+func (g *Getter) tagsEvalKey() string {
+	if !g.hasEvalKey {
+		g.evalKey = canonicalTags(g.levels[0])
+		g.hasEvalKey = true
+	}
+	return g.evalKey
+}
+
+// expose 在实验规则被求值时发送曝光事件。
+func (g *Getter) expose(ss *Snapshot, key string, exp *Experiment, v *Variant) {
+	sink := g.cfg.exposureSink
+	if sink == nil || g.quiet {
+		return
+	}
+	sink.Expose(ExposureEvent{
+		Experiment:      exp.ID,
+		Variant:         v.Name,
+		Key:             key,
+		TagsFingerprint: g.tagsFingerprint(),
+		Version:         ss.Version,
+		AllHash:         ss.AllHash,
+		Timestamp:       g.cfg.now().UnixMilli(),
+	})
+}
+
+// Get 获取配置值。SharedGetter 使用 GetShared。
 func Get[T any](g *Getter, key string) (T, error) {
-	var zero T
+	return get[T](g, key, nil)
+}
 
-	// 1. 获取当前快照
-	ss := g.cfg.snapshot.Load().(*Snapshot)
+// GetMany 从同一个快照中批量获取多个同类型的配置值。
+// 成功的 Key 写入返回的 map；失败的 Key（如 ErrNotFound）不出现在 map 中，
+// 其错误以 "key: err" 的形式合并返回，可用 errors.Is 判断。
+func GetMany[T any](g *Getter, keys ...string) (map[string]T, error) {
+	return getMany(keys, func(key string) (T, error) { return get[T](g, key, nil) })
+}
 
-	// 2. L1 缓存检查
-	if entry, ok := g.cache[key]; ok {
-		if entry.SnapshotHash == ss.AllHash {
-			if val, ok := entry.ParsedValue.(T); ok {
-				return val, nil
-			}
-			return zero, fmt.Errorf("type mismatch: %T", entry.ParsedValue)
+// getMany 依次读取 keys 并合并错误，见 GetMany。
+func getMany[T any](keys []string, read func(key string) (T, error)) (map[string]T, error) {
+	out := make(map[string]T, len(keys))
+	var errs []error
+	for _, key := range keys {
+		v, err := read(key)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			continue
 		}
+		out[key] = v
 	}
+	return out, errors.Join(errs...)
+}
 
-	// 3. 匹配规则
-	rules, ok := ss.Rules[key]
-	if !ok {
-		return zero, ErrNotFound
+// get 是 Get 的实现；ex 非 nil 时同时记录求值详情（见 GetDetailed）。
+func get[T any](g *Getter, key string, ex *Explanation) (T, error) {
+	var zero T
+
+	// 1. 获取 Getter 固定的快照
+	ss := g.snapshot()
+	if ex != nil {
+		ex.Version = ss.Version
+		ex.AllHash = ss.AllHash
 	}
 
-	rule := Match(rules, g.tags)
-	if rule == nil {
-		return zero, ErrNotFound
+	// 2. L1 缓存检查 (按 Key 与目标类型)
+	typ := typeID[T]()
+	es := g.entries(key)
+	if entry, ok := es.find(typ); ok && entry.valid(g.cfg, ss) {
+		if val, ok := entry.ParsedValue.(T); ok {
+			if ex != nil {
+				g.explainCached(ss, key, entry, ex)
+			}
+			return val, nil
+		}
 	}
 
-	// 4. 获取原始值
-	rawJSON, ok := ss.Values[rule.ValueHash]
-	if !ok {
-		// 如果保持数据一致性，不应发生这种情况
-		return zero, fmt.Errorf("value missing for hash: %s", rule.ValueHash)
+	// 3. 匹配规则并获取原始值：同一个 Key 已按其他类型、子路径读取过（或确认未匹配）时复用求值结果。
+	// Key 缺失时使用 Register 声明的默认值
+	if g.cfg.recordTypes {
+		g.cfg.recordType(key, "", typeOf[T]())
+	}
+	var (
+		ev  evaluation
+		err error
+	)
+	if e, ok := es.evaluated(g.cfg, ss); ok && ex == nil {
+		ev, err = e.evaluation(ss)
+	} else {
+		ev, err = g.evaluate(ss, key, ex)
+		if errors.Is(err, ErrNotFound) {
+			g.storeNotFound(ss, key, &ev)
+		}
+	}
+	if errors.Is(err, ErrNotFound) {
+		if def, err := defaultValue[T](g.cfg, key, ""); err == nil {
+			if ex != nil {
+				ex.Source = SourceDefault
+			}
+			return def, nil
+		}
+	}
+	if err != nil {
+		return zero, err
+	}
+	// 4. 反序列化 (L2 缓存)
+	val, source, err := decodeValue[T](g.cfg, ev.valueHash, ev.rawJSON)
+	if err != nil {
+		var tm *TypeMismatchError
+		if errors.As(err, &tm) {
+			tm.Key = key
+		}
+		return zero, err
+	}
+	if ex != nil {
+		ex.Source = source
 	}
 
-	// 5. 反序列化 (L2 缓存)
-	// 我们使用 valueHash + TypeName 作为 Key
-	typeKey := rule.ValueHash + "|" + reflect.TypeOf((*T)(nil)).Elem().String()
+	// 5. 更新 L1 缓存
+	g.store(key, ev.cacheEntry(ss, typ, val))
 
-	var val T
-	if cached, ok := g.cfg.valueCache.Load(typeKey); ok {
-		val = cached.(T)
+	return val, nil
+}
+
+// getValue 与 get 相同，按运行时类型 typ 读取（用于 Bind 的字段），同时返回值的来源。
+// L1、L2 缓存与 Register 声明的默认值都与 Get[T] 共用。
+func getValue(g *Getter, key string, typ reflect.Type) (reflect.Value, ValueSource, error) {
+	ss := g.snapshot()
+	id := reflect.PointerTo(typ) // 与 typeID 一致
+	es := g.entries(key)
+	if entry, ok := es.find(id); ok && entry.valid(g.cfg, ss) {
+		return valueOf(entry.ParsedValue, typ), SourceL1, nil
+	}
+
+	if g.cfg.recordTypes {
+		g.cfg.recordType(key, "", typ)
+	}
+	var (
+		ev  evaluation
+		err error
+	)
+	if e, ok := es.evaluated(g.cfg, ss); ok {
+		ev, err = e.evaluation(ss)
 	} else {
-		if err := json.Unmarshal([]byte(rawJSON), &val); err != nil {
-			return zero, fmt.Errorf("unmarshal failed: %w", err)
+		ev, err = g.evaluate(ss, key, nil)
+		if errors.Is(err, ErrNotFound) {
+			g.storeNotFound(ss, key, &ev)
 		}
-		g.cfg.valueCache.Store(typeKey, val)
 	}
+	if errors.Is(err, ErrNotFound) {
+		if def, ok := defaultValueOf(g.cfg, key, typ); ok {
+			return def, SourceDefault, nil
+		}
+	}
+	if err != nil {
+		return reflect.Value{}, "", err
+	}
+	val, source, err := decodeValueOf(g.cfg, ev.valueHash, ev.rawJSON, typ)
+	if err != nil {
+		var tm *TypeMismatchError
+		if errors.As(err, &tm) {
+			tm.Key = key
+		}
+		return reflect.Value{}, "", err
+	}
+	g.store(key, ev.cacheEntry(ss, id, val.Interface()))
+	return val, source, nil
+}
+
+// entries 返回 key 的 L1 缓存条目，先查找 Getter 自身的缓存，再查找 SharedGetter 已发布的缓存。
+func (g *Getter) entries(key string) l1Entries {
+	if es, ok := g.cache[key]; ok || g.shared == nil {
+		return es
+	}
+	return g.shared.load(key)
+}
+
+// store 写入 L1 缓存条目，替换同类型的旧条目。quiet 时不写入：
+// 未发送曝光的求值结果留在缓存中，之后的 Get 命中缓存就不会再发送曝光。
+func (g *Getter) store(key string, e CacheEntry) {
+	if g.quiet {
+		return
+	}
+	g.cache[key] = g.entries(key).with(e)
+}
+
+// quietly 进入 quiet 模式（包括其中求值的前置开关），返回恢复原状态的函数。
+func (g *Getter) quietly() func() {
+	prev := g.quiet
+	g.quiet = true
+	return func() { g.quiet = prev }
+}
+
+// storeNotFound 缓存未匹配的求值结果，之后的读取直到依赖变化前都不再求值。
+func (g *Getter) storeNotFound(ss *Snapshot, key string, ev *evaluation) {
+	e := ev.cacheEntry(ss, nil, nil)
+	e.ruleIndex, e.valueHash, e.variant, e.notFound = -1, "", "", true
+	g.store(key, e)
+}
+
+// evaluation 一次规则求值的结果。
+type evaluation struct {
+	idx       int
+	valueHash string
+	variant   string // 实验规则选中的变体
+	rawJSON   string
+	ec        evalContext // 求值过程中记录的缓存依赖
+}
 
-	// 6. 更新 L1 缓存
-	g.cache[key] = CacheEntry{
+// cacheEntry 根据求值结果构造 L1 缓存条目，typ 为 nil 时只记录求值结果。
+func (ev *evaluation) cacheEntry(ss *Snapshot, typ reflect.Type, val any) CacheEntry {
+	return CacheEntry{
 		ParsedValue:  val,
 		SnapshotHash: ss.AllHash,
+		typ:          typ,
+		segmentGen:   ev.ec.segmentGen,
+		expiresAt:    ev.ec.expiresAt,
+		ruleIndex:    ev.idx,
+		valueHash:    ev.valueHash,
+		variant:      ev.variant,
+		volatile:     ev.ec.volatile,
 	}
+}
 
-	return val, nil
+// evaluation 从缓存条目还原求值结果，未匹配的条目返回 ErrNotFound。
+func (e *CacheEntry) evaluation(ss *Snapshot) (evaluation, error) {
+	ev := evaluation{
+		idx:       e.ruleIndex,
+		valueHash: e.valueHash,
+		variant:   e.variant,
+		rawJSON:   ss.Values[e.valueHash],
+		ec:        evalContext{segmentGen: e.segmentGen, expiresAt: e.expiresAt, volatile: e.volatile},
+	}
+	if e.notFound {
+		return ev, ErrNotFound
+	}
+	return ev, nil
+}
+
+// evaluate 在快照 ss 下匹配 key 的规则并返回原始值，不读取缓存；ex 非 nil 时记录求值详情。
+func (g *Getter) evaluate(ss *Snapshot, key string, ex *Explanation) (evaluation, error) {
+	var ev evaluation
+	rules, ok := ss.Rules[key]
+	if !ok {
+		return ev, ErrNotFound
+	}
+
+	tags := g.resolveTags(ss)
+	ev.ec = evalContext{getter: g, segments: g.cfg.segments, clock: g.cfg.now}
+	ec := &ev.ec
+	var idx int
+	if ex != nil {
+		idx = traceLevels(rules, g.levels, ec, ex)
+	} else if g.cfg.evals == nil || g.quiet {
+		idx, _ = matchLevels(rules, g.levels, ec)
+	} else if res, ok := g.cfg.evals.lookup(g.cfg, ss, key, g.tagsEvalKey()); ok {
+		// 相同标签组合的其他 Getter 已求值过，跳过规则匹配
+		idx = res.ruleIndex
+		ec.segmentGen, ec.expiresAt = res.segmentGen, res.expiresAt
+	} else {
+		idx, _ = matchLevels(rules, g.levels, ec)
+		if !ec.volatile {
+			g.cfg.evals.store(g.cfg, ss, key, g.tagsEvalKey(), evalResult{
+				ruleIndex:  idx,
+				segmentGen: ec.segmentGen,
+				expiresAt:  ec.expiresAt,
+			})
+		}
+	}
+	if idx < 0 {
+		return ev, ErrNotFound
+	}
+	rule := &rules[idx]
+
+	// 实验规则按分桶选择变体，并发送曝光事件
+	valueHash, variant := rule.resolve(tags)
+	if variant != nil {
+		g.expose(ss, key, rule.Experiment, variant)
+	}
+	if ex != nil {
+		ex.setMatch(rule, idx, valueHash, variant)
+	}
+
+	// 获取原始值
+	rawJSON, ok := ss.Values[valueHash]
+	if !ok {
+		// 如果保持数据一致性，不应发生这种情况
+		return ev, fmt.Errorf("value missing for hash: %s", valueHash)
+	}
+	ev.idx, ev.valueHash, ev.rawJSON = idx, valueHash, rawJSON
+	if variant != nil {
+		ev.variant = variant.Name
+	}
+	return ev, nil
+}
+
+// valid 判断 L1 缓存条目在给定快照下是否仍然有效。
+func (e *CacheEntry) valid(c *Config, ss *Snapshot) bool {
+	return e.SnapshotHash == ss.AllHash &&
+		(e.segmentGen == 0 || e.segmentGen == c.segments.gen.Load()) &&
+		(e.expiresAt == 0 || c.now().UnixNano() < e.expiresAt)
+}
+
+// explainCached 为命中 L1 缓存的结果补充求值详情。
+// 匹配结果取自缓存条目；逐条规则的记录需重新求值（不发送曝光，也不改变缓存内容）。
+func (g *Getter) explainCached(ss *Snapshot, key string, entry *CacheEntry, ex *Explanation) {
+	ex.Source = SourceL1
+	ex.Matched = true
+	ex.RuleIndex = entry.ruleIndex
+	ex.ValueHash = entry.valueHash
+	ex.Variant = entry.variant
+
+	rules := ss.Rules[key]
+	if entry.ruleIndex < len(rules) {
+		ex.RuleTags = rules[entry.ruleIndex].Tags
+	}
+	g.resolveTags(ss)
+	defer g.quietly()()
+	ec := evalContext{getter: g, segments: g.cfg.segments, clock: g.cfg.now}
+	traceLevels(rules, g.levels, &ec, ex)
 }
@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -94,7 +96,8 @@ func TestGet(t *testing.T) {
 	}
 	cfg.snapshot.Store(ss2)
 
-	// g 检测到缓存失效，检查版本并重新加载
+	// g 固定了首次读取的快照，Refresh 后检测到缓存失效并重新加载
+	g.Refresh()
 	v4, err := Get[int](g, "limit")
 	if v4 != 300 {
 		t.Errorf("Expected 300 after update, got %v", v4)
@@ -122,8 +125,11 @@ func TestGet_TypeSafety(t *testing.T) {
 
 	g := cfg.WithTags(nil)
 
+	// Get 实例化后可以作为函数值传递
+	var read func(*Getter, string) (string, error) = Get[string]
+
 	// 获取字符串
-	s, err := Get[string](g, "msg")
+	s, err := read(g, "msg")
 	if err != nil || s != "hello" {
 		t.Errorf("Get string failed")
 	}
@@ -133,6 +139,73 @@ func TestGet_TypeSafety(t *testing.T) {
 	if err == nil {
 		t.Errorf("Expected error unmarshalling string to int")
 	}
+	var tm *TypeMismatchError
+	if !errors.As(err, &tm) || tm.Key != "msg" || tm.Want != reflect.TypeOf(0) || tm.Got != "string" {
+		t.Errorf("Expected TypeMismatchError naming both types, got %v", err)
+	}
+
+	// 字符串的 L1 缓存不受影响
+	if s, err := Get[string](g, "msg"); err != nil || s != "hello" {
+		t.Errorf("Get string after mismatch failed: %v", err)
+	}
+}
+
+func TestGet_MultipleTypes(t *testing.T) {
+	cfg := &Config{segments: newSegmentStore(nil), now: time.Now}
+	cfg.snapshot.Store(&Snapshot{
+		Version: 1,
+		AllHash: "hash1",
+		Rules: map[string][]Rule{
+			"limits": {{ValueHash: "l1"}},
+			"ratio":  {{ValueHash: "r1"}},
+		},
+		Values: map[string]string{
+			"l1": `{"qps":100,"burst":20}`,
+			"r1": `2.0`,
+		},
+	})
+	type Limits struct {
+		QPS   int `json:"qps"`
+		Burst int `json:"burst"`
+	}
+
+	g := cfg.WithTags(nil)
+	m, err := Get[map[string]any](g, "limits")
+	if err != nil || m["qps"] != float64(100) {
+		t.Fatalf("Get map failed: %v, %v", m, err)
+	}
+	// 同一个请求中按另一种类型读取同一个 Key
+	l, err := Get[Limits](g, "limits")
+	if err != nil || l.QPS != 100 || l.Burst != 20 {
+		t.Fatalf("Get struct failed: %+v, %v", l, err)
+	}
+	// 两种类型各自命中 L1
+	_, ex, _ := GetDetailed[map[string]any](g, "limits")
+	_, ex2, _ := GetDetailed[Limits](g, "limits")
+	if ex.Source != SourceL1 || ex2.Source != SourceL1 {
+		t.Errorf("Expected both typed views in L1, got %s, %s", ex.Source, ex2.Source)
+	}
+	if n := len(g.cache["limits"]); n != 2 {
+		t.Errorf("Expected 2 L1 entries, got %d", n)
+	}
+
+	// 数值类型按值转换
+	f, _ := Get[float64](g, "ratio")
+	i, err := Get[int](g, "ratio")
+	if f != 2 || i != 2 || err != nil {
+		t.Errorf("Expected 2 as float64 and int, got %v, %v, %v", f, i, err)
+	}
+	n, err := Get[json.Number](g, "ratio")
+	if err != nil || n.String() != "2.0" {
+		t.Errorf("Expected json.Number 2.0, got %v, %v", n, err)
+	}
+
+	// SharedGetter 同样支持
+	sg := cfg.WithSharedTags(nil)
+	GetShared[map[string]any](sg, "limits")
+	if l, err := GetShared[Limits](sg, "limits"); err != nil || l.QPS != 100 {
+		t.Errorf("Shared Get struct failed: %+v, %v", l, err)
+	}
 }
 
 func TestConfig_LoadIncremental(t *testing.T) {
@@ -237,6 +310,50 @@ func TestConfig_Watch(t *testing.T) {
 	}
 }
 
+func TestConfig_ReloadHookOutsideLock(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testreloadhook:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	p.Publish(ctx, PublishRequest{FullReplace: true, Items: map[string][]RuleInput{"k": {{Value: "v1"}}}})
+	cfg, _ := New(rdb, 1)
+
+	entered, release := make(chan struct{}), make(chan struct{})
+	remove := cfg.addReloadHook(func(_, _ *Snapshot) {
+		close(entered)
+		<-release
+	})
+	defer remove()
+
+	p.Publish(ctx, PublishRequest{Items: map[string][]RuleInput{"k": {{Value: "v2"}}}})
+	loaded := make(chan error, 1)
+	go func() { loaded <- cfg.Load(ctx) }()
+	<-entered
+
+	// 回调执行期间不持有 mu，Status 与读取不被阻塞
+	status := make(chan Status, 1)
+	go func() { status <- cfg.Status() }()
+	select {
+	case st := <-status:
+		if st.AllHash != cfg.snapshot.Load().(*Snapshot).AllHash {
+			t.Errorf("Unexpected status %+v", st)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Status blocked by a running reload hook")
+	}
+	if v, _ := Get[string](cfg.WithTags(nil), "k"); v != "v2" {
+		t.Errorf("Expected v2 while the hook runs, got %s", v)
+	}
+
+	close(release)
+	if err := <-loaded; err != nil {
+		t.Errorf("Load failed: %v", err)
+	}
+}
+
 func TestConfig_ValueCacheGC(t *testing.T) {
 	mr, _ := miniredis.Run()
 	defer mr.Close()
@@ -259,12 +376,8 @@ func TestConfig_ValueCacheGC(t *testing.T) {
 	Get[string](g, "k") // 加载到 L2 缓存
 
 	// 检查 L2 缓存是否有值
-	found := false
-	cfg.valueCache.Range(func(_, _ any) bool {
-		found = true
-		return false
-	})
-	if !found {
+	oldKey := valueKey{hash: cfg.snapshot.Load().(*Snapshot).Rules["k"][0].ValueHash, typ: reflect.TypeOf("")}
+	if cur, _ := valueCacheHas(&cfg.valueCache, oldKey); !cur {
 		t.Fatal("Value should be in L2 cache")
 	}
 
@@ -276,21 +389,125 @@ func TestConfig_ValueCacheGC(t *testing.T) {
 		},
 	})
 
-	// 3. 触发 Load
+	// 3. 触发 Load：快照变化，L2 轮换代际，旧值只保留在上一代中
+	cfg.Load(ctx)
+	if len(cfg.valueCache.cur) != 0 {
+		t.Errorf("Current generation should be empty after reload, got %d", len(cfg.valueCache.cur))
+	}
+
+	// 快照未变化时重复 Load 不轮换
+	cfg.Load(ctx)
+	if _, prev := valueCacheHas(&cfg.valueCache, oldKey); !prev {
+		t.Error("Reload of the same snapshot should not rotate L2")
+	}
+
+	// 4. 新快照下读取的值提升到当前代，下一次快照变化后旧值被释放
+	Get[string](cfg.WithTags(nil), "other")
+	p.Publish(ctx, PublishRequest{
+		FullReplace: true,
+		Items: map[string][]RuleInput{
+			"other": {{Value: "something"}},
+			"third": {{Value: 3}},
+		},
+	})
 	cfg.Load(ctx)
+	if cur, prev := valueCacheHas(&cfg.valueCache, oldKey); cur || prev {
+		t.Errorf("L2 cache should be cleaned of old hashes")
+	}
+	newKey := valueKey{hash: cfg.snapshot.Load().(*Snapshot).Rules["other"][0].ValueHash, typ: reflect.TypeOf("")}
+	if _, prev := valueCacheHas(&cfg.valueCache, newKey); !prev {
+		t.Errorf("Value read in the previous snapshot should survive one rotation")
+	}
+	// 上一代命中后提升
+	_, ex, _ := GetDetailed[string](cfg.WithTags(nil), "other")
+	if ex.Source != SourceL2 {
+		t.Errorf("Expected l2, got %s", ex.Source)
+	}
+	if cur, prev := valueCacheHas(&cfg.valueCache, newKey); !cur || prev {
+		t.Errorf("Value should be promoted to current generation")
+	}
+}
 
-	// 4. 检查 L2 缓存是否被清理
-	// 之前的 key 应该在 GC 步骤被删除了
-	found = false
-	cfg.valueCache.Range(func(_, _ any) bool {
-		found = true
-		return true
+func TestGetter_SnapshotPinning(t *testing.T) {
+	cfg := &Config{segments: newSegmentStore(nil), now: time.Now}
+	cfg.snapshot.Store(&Snapshot{
+		Version: 1,
+		AllHash: "hash1",
+		Rules: map[string][]Rule{
+			"timeout": {{ValueHash: "t1"}},
+			"retries": {{ValueHash: "r1"}},
+		},
+		Values: map[string]string{"t1": "100", "r1": "3"},
 	})
-	// 注意：新版本加载后，"other" 的值还没有被 Get，所以 L2 应该是空的（除非 Load 预加载了所有值到 cache，但目前逻辑是 Get 时加载）
-	// Load 仅同步 Snapshot.Values 映射。
-	if found {
-		// 如果 L2 还有项，检查它是否是旧的项目的 Hash
-		// 目前版本中，k 被移除了，所以其对应的 hash 应该不在 ss.Values 中，因此 L2 应该被清理该项。
-		t.Errorf("L2 cache should be empty or cleaned of old hashes")
+
+	g := cfg.WithTags(nil)
+	if v, _ := Get[int](g, "timeout"); v != 100 {
+		t.Fatalf("Expected 100, got %d", v)
+	}
+
+	// 请求处理过程中发生重载
+	cfg.snapshot.Store(&Snapshot{
+		Version: 1,
+		AllHash: "hash2",
+		Rules: map[string][]Rule{
+			"timeout": {{ValueHash: "t2"}},
+			"retries": {{ValueHash: "r2"}},
+		},
+		Values: map[string]string{"t2": "200", "r2": "5"},
+	})
+
+	// 同一个 Getter 的后续读取仍来自首次固定的快照
+	if v, _ := Get[int](g, "retries"); v != 3 {
+		t.Errorf("Expected pinned 3, got %d", v)
+	}
+	if ex, _ := Explain(g, "retries"); ex.AllHash != "hash1" {
+		t.Errorf("Expected pinned hash1, got %s", ex.AllHash)
+	}
+	// 新 Getter 使用最新快照
+	if v, _ := Get[int](cfg.WithTags(nil), "retries"); v != 5 {
+		t.Errorf("Expected 5, got %d", v)
+	}
+
+	g.Refresh()
+	if v, _ := Get[int](g, "timeout"); v != 200 {
+		t.Errorf("Expected 200 after Refresh, got %d", v)
+	}
+	if v, _ := Get[int](g, "retries"); v != 5 {
+		t.Errorf("Expected 5 after Refresh, got %d", v)
+	}
+}
+
+func TestGetMany(t *testing.T) {
+	cfg := &Config{segments: newSegmentStore(nil), now: time.Now}
+	cfg.snapshot.Store(&Snapshot{
+		Version: 1,
+		AllHash: "hash1",
+		Rules: map[string][]Rule{
+			"timeout": {{ValueHash: "t1"}},
+			"retries": {{ValueHash: "r1"}},
+			"name":    {{ValueHash: "n1"}},
+		},
+		Values: map[string]string{"t1": "100", "r1": "3", "n1": `"svc"`},
+	})
+
+	g := cfg.WithTags(nil)
+	got, err := GetMany[int](g, "timeout", "retries")
+	if err != nil {
+		t.Fatalf("GetMany failed: %v", err)
+	}
+	if len(got) != 2 || got["timeout"] != 100 || got["retries"] != 3 {
+		t.Errorf("Unexpected result: %v", got)
+	}
+
+	// 部分失败：成功的 Key 仍返回，错误合并
+	got, err = GetMany[int](g, "timeout", "missing", "name")
+	if len(got) != 1 || got["timeout"] != 100 {
+		t.Errorf("Unexpected result: %v", got)
+	}
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound in joined error, got %v", err)
+	}
+	if err == nil || !strings.Contains(err.Error(), "missing:") || !strings.Contains(err.Error(), "name:") {
+		t.Errorf("Expected per-key errors, got %v", err)
 	}
 }
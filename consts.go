@@ -1,5 +1,7 @@
 package bttsetting
 
+import "strconv"
+
 // prefix 目前使用的 Redis Key 前缀
 var prefix = "btt-setting:"
 
@@ -14,11 +16,17 @@ func SetPrefix(p string) {
 
 // Suffix defs
 const (
-	SuffixRules    = "rules:"   // 配置规则列表
-	SuffixValues   = "values"   // 配置值
-	SuffixVersions = "versions" // 版本映射
-	SuffixHistory  = "history"  // 版本历史
-	SuffixUpdates  = "updates"  // 更新通知
+	SuffixRules     = "rules:"    // 配置规则列表
+	SuffixValues    = "values"    // 配置值
+	SuffixVersions  = "versions"  // 版本映射
+	SuffixHistory   = "history"   // 版本历史
+	SuffixUpdates   = "updates"   // 更新通知
+	SuffixMeta      = "meta:"     // 快照元数据
+	SuffixExposures = "exposures" // 实验曝光事件
+	SuffixSegment   = "segment:"  // 人群包成员
+	SuffixSegments  = "segments"  // 人群包版本
+	SuffixRegistry  = "registry:" // 客户端导出的注册表
+	SuffixSchemas   = "schemas:"  // 客户端上报的类型
 )
 
 // Redis Key Helper
@@ -29,6 +37,12 @@ func KeyRules(hash string) string {
 	return prefix + SuffixRules + hash
 }
 
+// KeyMeta 返回快照元数据的 Redis Key。
+// hash: 规则集合的全局 AllHash，元数据与规则共用同一个 AllHash 版本。
+func KeyMeta(hash string) string {
+	return prefix + SuffixMeta + hash
+}
+
 // KeyValues 返回配置值存储的 Redis Key。
 // 该 Hash 存储 ValueHash -> MapValue。
 func KeyValues() string {
@@ -52,10 +66,40 @@ func KeyUpdates() string {
 	return prefix + SuffixUpdates
 }
 
+// KeyExposures 返回实验曝光事件的 Redis Stream Key。
+func KeyExposures() string {
+	return prefix + SuffixExposures
+}
+
+// KeySegment 返回人群包成员集合的 Redis Key。
+// 该 Set 存储人群包的全部成员 (如 user_id)。
+func KeySegment(name string) string {
+	return prefix + SuffixSegment + name
+}
+
+// KeySegmentRevisions 返回人群包版本的 Redis Key。
+// 该 Hash 存储 SegmentName -> Revision (每次修改递增)。
+func KeySegmentRevisions() string {
+	return prefix + SuffixSegments
+}
+
+// KeyRegistry 返回客户端注册表的 Redis Key。
+// 该 Hash 存储 ConfigKey -> RegisteredKey JSON，按应用版本区分。
+func KeyRegistry(version int) string {
+	return prefix + SuffixRegistry + strconv.Itoa(version)
+}
+
+// KeySchemas 返回客户端上报类型的 Redis Key。
+// 该 Hash 存储 "ConfigKey|GoType" -> TypeSchema JSON，按应用版本区分。
+func KeySchemas(version int) string {
+	return prefix + SuffixSchemas + strconv.Itoa(version)
+}
+
 // Stream 事件类型
 const (
 	EventPublish = "publish"
 	EventReload  = "reload"
+	EventSegment = "segment" // 人群包变更 (与应用版本无关)
 )
 
 // Redis Stream 消息载荷
@@ -64,4 +108,10 @@ type UpdateMessage struct {
 	Version   int    `json:"version"`   // 版本号
 	AllHash   string `json:"all_hash"`  // 全局 Hash
 	Timestamp int64  `json:"timestamp"` // 时间戳
+
+	// 人群包增量 (仅 EventSegment)
+	Segment  string   `json:"segment,omitempty"`  // 人群包名
+	Revision int64    `json:"revision,omitempty"` // 变更后的人群包版本
+	Added    []string `json:"added,omitempty"`    // 新增成员
+	Removed  []string `json:"removed,omitempty"`  // 移除成员
 }
@@ -0,0 +1,165 @@
+package bttsetting
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// TypeMismatchError 配置值无法读取为请求的 Go 类型。
+type TypeMismatchError struct {
+	Key   string       // 配置 Key
+	Want  reflect.Type // 请求的类型
+	Got   string       // 实际的 JSON 值，如 "string"、"number 42.5"
+	Field string       // 解码结构体时不匹配的字段路径，可为空
+	Err   error        // 底层错误
+}
+
+func (e *TypeMismatchError) Error() string {
+	msg := fmt.Sprintf("type mismatch: cannot read %s as %s", e.Got, e.Want)
+	if e.Field != "" {
+		msg += " (field " + e.Field + ")"
+	}
+	if e.Key != "" {
+		msg = "key " + e.Key + ": " + msg
+	}
+	return msg
+}
+
+func (e *TypeMismatchError) Unwrap() error {
+	return e.Err
+}
+
+// typeOf 返回 T 的 reflect.Type（接口类型同样适用），不分配内存。
+func typeOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+// typeID 返回 *T 的 reflect.Type，作为缓存中区分类型的标识。
+// 与 typeOf 一一对应，但不需要 Elem 调用，适合读路径。
+func typeID[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil))
+}
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// unmarshalValue 把 JSON 值解码到 out (指向 T 的指针)。
+//
+// 数值类型的转换规则：JSON 数字可以读取为任意整数、浮点数类型或 json.Number，
+// 只要值能被目标类型精确表示，例如 42.0 可以读取为 int，42.5 与 300 (int8) 则报错。
+// 通过 RegisterDecoder 注册了解码器的类型（包括内置的 time.Duration 等）使用对应的解码器。
+// 无法读取时返回 *TypeMismatchError。
+func unmarshalValue(raw string, out any, typ reflect.Type) error {
+	if fn, ok := lookupDecoder(typ); ok {
+		return decodeWith(fn, raw, out, typ)
+	}
+	if isNumberKind(typ) && !reflect.PointerTo(typ).Implements(unmarshalerType) {
+		return unmarshalNumber(raw, reflect.ValueOf(out).Elem())
+	}
+	err := json.Unmarshal([]byte(raw), out)
+	var ute *json.UnmarshalTypeError
+	if errors.As(err, &ute) {
+		return &TypeMismatchError{Want: typ, Got: ute.Value, Field: ute.Field, Err: err}
+	}
+	if err != nil {
+		return fmt.Errorf("unmarshal failed: %w", err)
+	}
+	return nil
+}
+
+func isNumberKind(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// unmarshalNumber 以 json.Number 读取 JSON 数字，并按目标类型检查能否精确表示。
+func unmarshalNumber(raw string, v reflect.Value) error {
+	dec := json.NewDecoder(bytes.NewReader([]byte(raw)))
+	dec.UseNumber()
+	var x any
+	if err := dec.Decode(&x); err != nil {
+		return fmt.Errorf("unmarshal failed: %w", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("unmarshal failed: invalid data after top-level value")
+	}
+	if x == nil {
+		// 与 encoding/json 一致：null 不修改目标值
+		return nil
+	}
+	n, ok := x.(json.Number)
+	if !ok {
+		return &TypeMismatchError{Want: v.Type(), Got: jsonKind(x)}
+	}
+	if err := setNumber(v, n); err != nil {
+		return &TypeMismatchError{Want: v.Type(), Got: "number " + n.String(), Err: err}
+	}
+	return nil
+}
+
+// setNumber 把 n 写入数值类型的 v，无法精确表示时返回错误。
+func setNumber(v reflect.Value, n json.Number) error {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(n.String(), 10, 64)
+		if err != nil {
+			// 可能是 42.0、1e3 这类写法
+			f, ferr := strconv.ParseFloat(n.String(), 64)
+			if ferr != nil || f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+				return fmt.Errorf("not an integer in range")
+			}
+			i = int64(f)
+		}
+		if v.OverflowInt(i) {
+			return fmt.Errorf("overflows %s", v.Type())
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(n.String(), 10, 64)
+		if err != nil {
+			f, ferr := strconv.ParseFloat(n.String(), 64)
+			if ferr != nil || f != math.Trunc(f) || f < 0 || f >= math.MaxUint64 {
+				return fmt.Errorf("not an unsigned integer in range")
+			}
+			u = uint64(f)
+		}
+		if v.OverflowUint(u) {
+			return fmt.Errorf("overflows %s", v.Type())
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(n.String(), v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	}
+	return nil
+}
+
+// jsonKind 返回解码后 JSON 值的类型名，用于错误信息。
+func jsonKind(x any) string {
+	switch x.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	}
+	return fmt.Sprintf("%T", x)
+}
@@ -0,0 +1,95 @@
+package bttsetting
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnmarshalValue_Numbers(t *testing.T) {
+	type port uint16
+
+	ok := []struct {
+		raw  string
+		out  any
+		want any
+	}{
+		{"42", new(int), 42},
+		{"42.0", new(int), 42},
+		{"1e3", new(int64), int64(1000)},
+		{"-5", new(int8), int8(-5)},
+		{"8080", new(port), port(8080)},
+		{"42", new(float64), 42.0},
+		{"0.5", new(float32), float32(0.5)},
+		{"42.5", new(json.Number), json.Number("42.5")},
+		{"null", new(int), 0},
+		// time.Duration 是 int64，按数值读取 (纳秒)
+		{"1000000000", new(time.Duration), time.Second},
+	}
+	for _, c := range ok {
+		err := unmarshalValue(c.raw, c.out, reflect.TypeOf(c.out).Elem())
+		if err != nil {
+			t.Errorf("%s as %T: unexpected error %v", c.raw, c.out, err)
+			continue
+		}
+		if got := reflect.ValueOf(c.out).Elem().Interface(); got != c.want {
+			t.Errorf("%s as %T: got %v, want %v", c.raw, c.out, got, c.want)
+		}
+	}
+
+	bad := []struct {
+		raw string
+		out any
+		got string
+	}{
+		{"42.5", new(int), "number 42.5"},
+		{"300", new(int8), "number 300"},
+		{"-1", new(uint), "number -1"},
+		{"1e40", new(float32), "number 1e40"},
+		{`"42"`, new(int), "string"},
+		{`{"a":1}`, new(float64), "object"},
+	}
+	for _, c := range bad {
+		err := unmarshalValue(c.raw, c.out, reflect.TypeOf(c.out).Elem())
+		var tm *TypeMismatchError
+		if !errors.As(err, &tm) {
+			t.Errorf("%s as %T: expected TypeMismatchError, got %v", c.raw, c.out, err)
+			continue
+		}
+		if tm.Got != c.got || tm.Want != reflect.TypeOf(c.out).Elem() {
+			t.Errorf("%s as %T: unexpected error %+v", c.raw, c.out, tm)
+		}
+	}
+
+	// 语法错误不是类型不匹配
+	err := unmarshalValue("4x", new(int), reflect.TypeOf(0))
+	var tm *TypeMismatchError
+	if err == nil || errors.As(err, &tm) {
+		t.Errorf("Expected syntax error, got %v", err)
+	}
+}
+
+func TestUnmarshalValue_Struct(t *testing.T) {
+	type limits struct {
+		QPS int `json:"qps"`
+	}
+	var l limits
+	err := unmarshalValue(`{"qps":"fast"}`, &l, reflect.TypeOf(l))
+	var tm *TypeMismatchError
+	if !errors.As(err, &tm) || tm.Field != "qps" || tm.Got != "string" {
+		t.Fatalf("Expected field mismatch, got %v", err)
+	}
+	tm.Key = "limits"
+	msg := tm.Error()
+	if !strings.Contains(msg, "key limits") || !strings.Contains(msg, "string") || !strings.Contains(msg, "bttsetting.limits") {
+		t.Errorf("Unexpected message %q", msg)
+	}
+
+	var ute *json.UnmarshalTypeError
+	if !errors.As(err, &ute) {
+		t.Error("TypeMismatchError should unwrap to the json error")
+	}
+}
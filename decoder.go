@@ -0,0 +1,238 @@
+package bttsetting
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// decodeFunc 类型擦除后的解码器，out 为指向目标类型的指针。
+type decodeFunc func(raw json.RawMessage, out any) error
+
+var (
+	// decoders 全局解码器注册表 (目标类型 -> 解码器)，写时复制，读路径无锁
+	decoders   atomic.Pointer[map[reflect.Type]decodeFunc]
+	decodersMu sync.Mutex
+)
+
+// RegisterDecoder 为类型 T 注册解码器，Get[T]、Bind 的 T 类型字段等读取 T 时使用它代替 encoding/json。
+// 解码结果与 JSON 反序列化的结果一样按 (ValueHash, 类型) 缓存在 L2 中。
+//
+// 应在进程启动时、读取配置之前调用；重复注册同一类型会覆盖（包括内置解码器）。
+// raw 为配置值的 JSON 文本，JSON null 不调用解码器，保持零值。
+// 解码器返回的错误包装为 *TypeMismatchError。
+// 注意解码器只作用于读取的目标类型本身，结构体内部的字段仍按 encoding/json 解码。
+//
+// 内置解码器：time.Duration、time.Time、ByteSize、net.IP、*url.URL、*regexp.Regexp。
+func RegisterDecoder[T any](fn func(raw json.RawMessage) (T, error)) {
+	registerDecoder(typeOf[T](), func(raw json.RawMessage, out any) error {
+		v, err := fn(raw)
+		if err != nil {
+			return err
+		}
+		*out.(*T) = v
+		return nil
+	})
+}
+
+func registerDecoder(typ reflect.Type, fn decodeFunc) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+
+	next := make(map[reflect.Type]decodeFunc)
+	if cur := decoders.Load(); cur != nil {
+		for k, v := range *cur {
+			next[k] = v
+		}
+	}
+	next[typ] = fn
+	decoders.Store(&next)
+}
+
+func lookupDecoder(typ reflect.Type) (decodeFunc, bool) {
+	cur := decoders.Load()
+	if cur == nil {
+		return nil, false
+	}
+	fn, ok := (*cur)[typ]
+	return fn, ok
+}
+
+// decodeWith 使用注册的解码器解码 raw。
+func decodeWith(fn decodeFunc, raw string, out any, typ reflect.Type) error {
+	data := bytes.TrimSpace([]byte(raw))
+	if len(data) == 0 {
+		return fmt.Errorf("unmarshal failed: empty value")
+	}
+	if string(data) == "null" {
+		return nil
+	}
+	if err := fn(data, out); err != nil {
+		var tm *TypeMismatchError
+		if errors.As(err, &tm) {
+			return err
+		}
+		return &TypeMismatchError{Want: typ, Got: rawKind(data), Err: err}
+	}
+	return nil
+}
+
+// rawKind 返回 JSON 文本的类型描述，用于错误信息，与 TypeMismatchError.Got 的格式一致。
+func rawKind(data []byte) string {
+	if len(data) == 0 {
+		return "empty"
+	}
+	switch data[0] {
+	case '"':
+		return "string " + string(data)
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case 't', 'f':
+		return "bool"
+	case 'n':
+		return "null"
+	}
+	return "number " + string(data)
+}
+
+// ByteSize 字节数。除 JSON 数字（字节数）外，还可以读取带单位的字符串，如 "512KB"、"1.5GiB"；
+// 单位不区分大小写，KB/MB/GB/TB 按 1000 进位，KiB/MiB/GiB/TiB 按 1024 进位。
+type ByteSize int64
+
+var byteUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"kb":  1e3,
+	"mb":  1e6,
+	"gb":  1e9,
+	"tb":  1e12,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+}
+
+// ParseByteSize 解析带单位的字节数，规则见 ByteSize。
+func ParseByteSize(s string) (ByteSize, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i < 0 {
+		i = len(s)
+	}
+	num, unit := s[:i], strings.ToLower(strings.TrimSpace(s[i:]))
+	mult, ok := byteUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("invalid byte size %q: unknown unit %q", s, unit)
+	}
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid byte size %q", s)
+	}
+	n := f * mult
+	if n != math.Trunc(n) || n >= math.MaxInt64 {
+		return 0, fmt.Errorf("invalid byte size %q: not a whole number of bytes in range", s)
+	}
+	return ByteSize(n), nil
+}
+
+// decodeString 把 JSON 字符串解码为 Go 字符串，其他 JSON 类型返回 TypeMismatchError。
+func decodeString(raw json.RawMessage, want reflect.Type) (string, error) {
+	if len(raw) == 0 || raw[0] != '"' {
+		return "", &TypeMismatchError{Want: want, Got: rawKind(raw)}
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return "", err
+	}
+	return s, nil
+}
+
+// 内置解码器
+func init() {
+	RegisterDecoder(func(raw json.RawMessage) (time.Duration, error) {
+		// 数字按纳秒，与 encoding/json 对 time.Duration 的编码一致
+		if raw[0] != '"' {
+			var d time.Duration
+			err := unmarshalNumber(string(raw), reflect.ValueOf(&d).Elem())
+			return d, err
+		}
+		s, err := decodeString(raw, typeOf[time.Duration]())
+		if err != nil {
+			return 0, err
+		}
+		return time.ParseDuration(s)
+	})
+
+	RegisterDecoder(func(raw json.RawMessage) (time.Time, error) {
+		// 数字按 Unix 秒
+		if raw[0] != '"' {
+			var sec int64
+			if err := unmarshalNumber(string(raw), reflect.ValueOf(&sec).Elem()); err != nil {
+				return time.Time{}, err
+			}
+			return time.Unix(sec, 0), nil
+		}
+		s, err := decodeString(raw, typeOf[time.Time]())
+		if err != nil {
+			return time.Time{}, err
+		}
+		if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			return t, nil
+		}
+		return time.Parse(time.DateOnly, s)
+	})
+
+	RegisterDecoder(func(raw json.RawMessage) (ByteSize, error) {
+		if raw[0] != '"' {
+			var n ByteSize
+			err := unmarshalNumber(string(raw), reflect.ValueOf(&n).Elem())
+			return n, err
+		}
+		s, err := decodeString(raw, typeOf[ByteSize]())
+		if err != nil {
+			return 0, err
+		}
+		return ParseByteSize(s)
+	})
+
+	RegisterDecoder(func(raw json.RawMessage) (net.IP, error) {
+		s, err := decodeString(raw, typeOf[net.IP]())
+		if err != nil {
+			return nil, err
+		}
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %q", s)
+		}
+		return ip, nil
+	})
+
+	RegisterDecoder(func(raw json.RawMessage) (*url.URL, error) {
+		s, err := decodeString(raw, typeOf[*url.URL]())
+		if err != nil {
+			return nil, err
+		}
+		return url.Parse(s)
+	})
+
+	RegisterDecoder(func(raw json.RawMessage) (*regexp.Regexp, error) {
+		s, err := decodeString(raw, typeOf[*regexp.Regexp]())
+		if err != nil {
+			return nil, err
+		}
+		return regexp.Compile(s)
+	})
+}
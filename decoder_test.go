@@ -0,0 +1,172 @@
+package bttsetting
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestDecoders_Builtin(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testdecoder:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	err := p.Publish(ctx, PublishRequest{FullReplace: true, Items: map[string][]RuleInput{
+		"timeout":     {{Value: "1500ms"}},
+		"timeout_ns":  {{Value: 2000000}},
+		"bad_timeout": {{Value: "1500xs"}},
+		"deadline":    {{Value: "2025-06-01T08:00:00Z"}},
+		"launch_day":  {{Value: "2025-06-01"}},
+		"epoch":       {{Value: 1748764800}},
+		"cache_size":  {{Value: "1.5GiB"}},
+		"body_limit":  {{Value: 4096}},
+		"ip":          {{Value: "10.0.0.1"}},
+		"bad_ip":      {{Value: "10.0.0"}},
+		"endpoint":    {{Value: "https://api.example.com/v1?x=1"}},
+		"pattern":     {{Value: "^user-[0-9]+$"}},
+		"bad_pattern": {{Value: "("}},
+		"object":      {{Value: map[string]any{"a": 1}}},
+	}})
+	if err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	cfg, _ := New(rdb, 1)
+	g := cfg.WithTags(nil)
+
+	if d, err := Get[time.Duration](g, "timeout"); err != nil || d != 1500*time.Millisecond {
+		t.Errorf("Expected 1.5s, got %v, %v", d, err)
+	}
+	if d, _ := Get[time.Duration](g, "timeout_ns"); d != 2*time.Millisecond {
+		t.Errorf("Expected numbers as nanoseconds, got %v", d)
+	}
+	var tm *TypeMismatchError
+	if _, err := Get[time.Duration](g, "bad_timeout"); !errors.As(err, &tm) || tm.Key != "bad_timeout" || tm.Err == nil {
+		t.Errorf("Expected TypeMismatchError, got %v", err)
+	}
+	if _, err := Get[time.Duration](g, "object"); !errors.As(err, &tm) || tm.Got != "object" {
+		t.Errorf("Expected object mismatch, got %v", err)
+	}
+
+	want := time.Date(2025, 6, 1, 8, 0, 0, 0, time.UTC)
+	if v, _ := Get[time.Time](g, "deadline"); !v.Equal(want) {
+		t.Errorf("Unexpected time %v", v)
+	}
+	if v, _ := Get[time.Time](g, "launch_day"); !v.Equal(want.Add(-8 * time.Hour)) {
+		t.Errorf("Unexpected date %v", v)
+	}
+	if v, _ := Get[time.Time](g, "epoch"); !v.Equal(want) {
+		t.Errorf("Unexpected unix time %v", v)
+	}
+
+	if v, _ := Get[ByteSize](g, "cache_size"); v != 3<<29 {
+		t.Errorf("Unexpected size %d", v)
+	}
+	if v, _ := Get[ByteSize](g, "body_limit"); v != 4096 {
+		t.Errorf("Unexpected size %d", v)
+	}
+
+	if v, _ := Get[net.IP](g, "ip"); !v.Equal(net.IPv4(10, 0, 0, 1)) {
+		t.Errorf("Unexpected IP %v", v)
+	}
+	if _, err := Get[net.IP](g, "bad_ip"); !errors.As(err, &tm) {
+		t.Errorf("Expected TypeMismatchError, got %v", err)
+	}
+	if v, _ := Get[*url.URL](g, "endpoint"); v == nil || v.Host != "api.example.com" || v.Query().Get("x") != "1" {
+		t.Errorf("Unexpected URL %v", v)
+	}
+	re, err := Get[*regexp.Regexp](g, "pattern")
+	if err != nil || !re.MatchString("user-42") {
+		t.Errorf("Unexpected regexp %v, %v", re, err)
+	}
+	if _, err := Get[*regexp.Regexp](g, "bad_pattern"); !errors.As(err, &tm) {
+		t.Errorf("Expected TypeMismatchError, got %v", err)
+	}
+
+	// 解码结果缓存在 L2，新的 Getter 复用同一个编译好的正则
+	re2, ex, _ := GetDetailed[*regexp.Regexp](cfg.WithTags(nil), "pattern")
+	if ex.Source != SourceL2 || re2 != re {
+		t.Errorf("Expected L2 hit with the same value, got %s", ex.Source)
+	}
+}
+
+type celsius float64
+
+func TestRegisterDecoder(t *testing.T) {
+	RegisterDecoder(func(raw json.RawMessage) (celsius, error) {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return 0, err
+		}
+		var v float64
+		if err := json.Unmarshal([]byte(strings.TrimSuffix(s, "C")), &v); err != nil {
+			return 0, err
+		}
+		return celsius(v), nil
+	})
+
+	var c celsius
+	if err := unmarshalValue(`"36.6C"`, &c, typeOf[celsius]()); err != nil || c != 36.6 {
+		t.Errorf("Expected 36.6, got %v, %v", c, err)
+	}
+	// null 不调用解码器
+	c = 1
+	if err := unmarshalValue(`null`, &c, typeOf[celsius]()); err != nil || c != 1 {
+		t.Errorf("Expected unchanged value, got %v, %v", c, err)
+	}
+	var tm *TypeMismatchError
+	if err := unmarshalValue(`36.6`, &c, typeOf[celsius]()); !errors.As(err, &tm) || tm.Got != "number 36.6" {
+		t.Errorf("Expected TypeMismatchError, got %v", err)
+	}
+}
+
+type ringNode struct {
+	Next *ringNode
+	Name string
+}
+
+func TestEstimateSize_Cycle(t *testing.T) {
+	// 自定义解码器的结果可能含环，估算大小时不能无限递归
+	n := &ringNode{Name: "a"}
+	n.Next = n
+	if size := estimateSize(reflect.ValueOf(n)); size <= 0 {
+		t.Errorf("Expected positive size, got %d", size)
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	cases := []struct {
+		in   string
+		want ByteSize
+		ok   bool
+	}{
+		{"512", 512, true},
+		{"512B", 512, true},
+		{"64KB", 64000, true},
+		{"64 kib", 65536, true},
+		{"1.5GiB", 3 << 29, true},
+		{"2TB", 2e12, true},
+		{"0.5B", 0, false},
+		{"10XB", 0, false},
+		{"MB", 0, false},
+		{"-1KB", 0, false},
+	}
+	for _, c := range cases {
+		got, err := ParseByteSize(c.in)
+		if (err == nil) != c.ok || got != c.want {
+			t.Errorf("ParseByteSize(%q) = %d, %v", c.in, got, err)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package bttsetting
+
+import (
+	"fmt"
+	"strings"
+)
+
+// normalize 按定义对单个标签值做规范化（目前仅处理字符串及字符串切片）。
+// 返回值与是否发生了变化，未变化时不产生新对象。
+func (d *TagDef) normalize(val any) (any, bool) {
+	if !d.Lowercase && !d.Trim {
+		return val, false
+	}
+	switch v := val.(type) {
+	case string:
+		n := d.normalizeString(v)
+		return n, n != v
+	case []string:
+		var out []string
+		for i, s := range v {
+			n := d.normalizeString(s)
+			if n != s && out == nil {
+				out = make([]string, len(v))
+				copy(out, v)
+			}
+			if out != nil {
+				out[i] = n
+			}
+		}
+		if out == nil {
+			return val, false
+		}
+		return out, true
+	}
+	return val, false
+}
+
+func (d *TagDef) normalizeString(s string) string {
+	if d.Trim {
+		s = strings.TrimSpace(s)
+	}
+	if d.Lowercase {
+		s = strings.ToLower(s)
+	}
+	return s
+}
+
+// validate 检查规则中的标签值是否符合定义的类型与取值范围。
+func (d *TagDef) validate(val any) error {
+	switch d.Type {
+	case "":
+	case TagTypeString:
+		if _, ok := val.(string); !ok {
+			return fmt.Errorf("expected string, got %T", val)
+		}
+	case TagTypeNumber:
+		if _, ok := toFloat64(val); !ok {
+			return fmt.Errorf("expected number, got %T", val)
+		}
+	case TagTypeBool:
+		if _, ok := val.(bool); !ok {
+			return fmt.Errorf("expected bool, got %T", val)
+		}
+	default:
+		return fmt.Errorf("unknown tag type %q", d.Type)
+	}
+
+	if len(d.Values) == 0 {
+		return nil
+	}
+	for _, allowed := range d.Values {
+		if valuesEqual(allowed, val) {
+			return nil
+		}
+	}
+	return fmt.Errorf("value %v not allowed", val)
+}
+
+// normalizeRuleTags 按字典规范化并校验规则标签，字典为空时原样返回。
+// 未在字典中定义的标签 Key 会被拒绝（防止 enviroment=prod 之类的拼写错误）。
+func normalizeRuleTags(dict map[string]TagDef, tags map[string]any) (map[string]any, error) {
+	if len(dict) == 0 || len(tags) == 0 {
+		return tags, nil
+	}
+	out := make(map[string]any, len(tags))
+	for k, v := range tags {
+		def, ok := dict[k]
+		if !ok {
+			return nil, fmt.Errorf("unknown tag key %q", k)
+		}
+		v, _ = def.normalize(v)
+		if err := def.validate(v); err != nil {
+			return nil, fmt.Errorf("invalid tag %s: %w", k, err)
+		}
+		out[k] = v
+	}
+	return out, nil
+}
+
+// checkConditionTags 检查灰度、实验与人群包条件引用的输入标签是否在字典中定义。
+func checkConditionTags(dict map[string]TagDef, rule *Rule) error {
+	check := func(cond, tag string) error {
+		if _, ok := dict[tag]; !ok {
+			return fmt.Errorf("%s: unknown tag key %q", cond, tag)
+		}
+		return nil
+	}
+	if rule.Rollout != nil {
+		if err := check("rollout", rule.Rollout.Tag); err != nil {
+			return err
+		}
+	}
+	if rule.Experiment != nil {
+		if err := check("experiment", rule.Experiment.Tag); err != nil {
+			return err
+		}
+	}
+	if rule.Segment != nil {
+		return check("segment", rule.Segment.Tag)
+	}
+	return nil
+}
+
+// NormalizeTags 按快照中的标签字典规范化输入标签（如转小写）。
+// onUnknown 在遇到字典中未定义的标签 Key 时被调用（用于诊断计数），可为 nil。
+// 没有任何变化时返回原 map（不复制）。
+func (s *Snapshot) NormalizeTags(tags map[string]any, onUnknown func(key string)) map[string]any {
+	dict := s.Meta.Dictionary
+	if len(dict) == 0 || len(tags) == 0 {
+		return tags
+	}
+	var out map[string]any
+	for k, v := range tags {
+		def, ok := dict[k]
+		if !ok {
+			if onUnknown != nil {
+				onUnknown(k)
+			}
+			continue
+		}
+		n, changed := def.normalize(v)
+		if !changed {
+			continue
+		}
+		if out == nil {
+			// 写时复制，避免修改调用方的 map
+			out = make(map[string]any, len(tags))
+			for k2, v2 := range tags {
+				out[k2] = v2
+			}
+		}
+		out[k] = n
+	}
+	if out == nil {
+		return tags
+	}
+	return out
+}
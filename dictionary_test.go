@@ -0,0 +1,177 @@
+package bttsetting
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func testDictionary() map[string]TagDef {
+	return map[string]TagDef{
+		"environment": {Type: TagTypeString, Values: []any{"prod", "staging"}, Lowercase: true, Trim: true},
+		"level":       {Type: TagTypeNumber},
+		"vip":         {Type: TagTypeBool},
+		"groups":      {Type: TagTypeString, Lowercase: true},
+	}
+}
+
+func TestNormalizeRuleTags(t *testing.T) {
+	dict := testDictionary()
+	tests := []struct {
+		name    string
+		tags    map[string]any
+		want    map[string]any
+		wantErr string
+	}{
+		{"normalize", map[string]any{"environment": " PROD "}, map[string]any{"environment": "prod"}, ""},
+		{"unknown_key", map[string]any{"enviroment": "prod"}, nil, "unknown tag key"},
+		{"not_allowed", map[string]any{"environment": "dev"}, nil, "not allowed"},
+		{"wrong_type", map[string]any{"level": "3"}, nil, "expected number"},
+		{"number_ok", map[string]any{"level": 3, "vip": true}, map[string]any{"level": 3, "vip": true}, ""},
+		{"empty", map[string]any{}, map[string]any{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeRuleTags(dict, tt.tags)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !MatchTagsExact(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnapshot_NormalizeTags(t *testing.T) {
+	ss := &Snapshot{Meta: SnapshotMeta{Dictionary: testDictionary()}}
+	var unknown []string
+	in := map[string]any{"environment": "Prod", "groups": []string{"Beta", "staff"}, "enviroment": "prod"}
+	got := ss.NormalizeTags(in, func(k string) { unknown = append(unknown, k) })
+
+	if got["environment"] != "prod" {
+		t.Errorf("Expected lowercased environment, got %v", got["environment"])
+	}
+	if groups := got["groups"].([]string); groups[0] != "beta" {
+		t.Errorf("Expected lowercased groups, got %v", groups)
+	}
+	if in["environment"] != "Prod" {
+		t.Error("Input map should not be modified")
+	}
+	if len(unknown) != 1 || unknown[0] != "enviroment" {
+		t.Errorf("Expected unknown enviroment, got %v", unknown)
+	}
+
+	// 无变化时返回原 map
+	same := map[string]any{"environment": "prod"}
+	got = ss.NormalizeTags(same, nil)
+	got["marker"] = true
+	if _, ok := same["marker"]; !ok {
+		t.Error("Expected the original map when nothing changed")
+	}
+}
+
+func TestDictionary_PublishAndGet(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testdict:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	err := p.Publish(ctx, PublishRequest{
+		FullReplace: true,
+		Items: map[string][]RuleInput{
+			"timeout": {
+				{Tags: map[string]any{"environment": "PROD"}, Value: 100},
+				{Value: 200},
+			},
+		},
+		TagDictionary: testDictionary(),
+	})
+	if err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	// 拼写错误的标签被拒绝
+	err = p.Publish(ctx, PublishRequest{
+		Items: map[string][]RuleInput{
+			"timeout": {{Tags: map[string]any{"enviroment": "prod"}, Value: 1}},
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "unknown tag key") {
+		t.Fatalf("Expected unknown tag error, got %v", err)
+	}
+
+	// 灰度、实验与人群包条件引用的标签同样按字典校验
+	for name, in := range map[string]RuleInput{
+		"rollout":    {Value: 1, Rollout: RolloutPercent("usr_id", 10)},
+		"experiment": {Experiment: &ExperimentInput{ID: "exp", Tag: "usr_id", Variants: []VariantInput{{Name: "a", Weight: 100, Value: 1}}}},
+		"segment":    {Value: 1, Segment: &SegmentCond{Name: "vip", Tag: "usr_id"}},
+	} {
+		err = p.Publish(ctx, PublishRequest{Items: map[string][]RuleInput{"timeout": {in}}})
+		if err == nil || !strings.Contains(err.Error(), name+`: unknown tag key "usr_id"`) {
+			t.Errorf("Expected unknown %s tag error, got %v", name, err)
+		}
+	}
+
+	// 客户端开启规范化后，输入 Prod 可以匹配规则 prod
+	cfg, _ := New(rdb, 1, WithTagNormalization())
+	g := cfg.WithTags(map[string]any{"environment": "Prod", "enviroment": "x"})
+	v, err := Get[int](g, "timeout")
+	if err != nil || v != 100 {
+		t.Errorf("Expected 100 with normalized tags, got %v (err: %v)", v, err)
+	}
+	if n := cfg.UnknownTagCounts()["enviroment"]; n != 1 {
+		t.Errorf("Expected 1 unknown tag count, got %d", n)
+	}
+
+	// 未开启规范化时，大小写不同不匹配
+	cfg2, _ := New(rdb, 1)
+	v, _ = Get[int](cfg2.WithTags(map[string]any{"environment": "Prod"}), "timeout")
+	if v != 200 {
+		t.Errorf("Expected 200 without normalization, got %v", v)
+	}
+	if len(cfg2.UnknownTagCounts()) != 0 {
+		t.Error("Unknown tags should not be counted without normalization")
+	}
+}
+
+func TestDictionary_RepublishKeepsSalt(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testdict2:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	rollout := RolloutPercent("level", 10)
+	rollout.Salt = "checkout-v1"
+	p.Publish(ctx, PublishRequest{
+		FullReplace:   true,
+		Items:         map[string][]RuleInput{"checkout": {{Tags: map[string]any{"environment": "prod"}, Value: true, Rollout: rollout}}},
+		TagDictionary: testDictionary(),
+	})
+
+	// 重新发布时标签大小写与空白不同，规范化后是同一条规则，沿用已有盐值
+	err := p.Publish(ctx, PublishRequest{Items: map[string][]RuleInput{
+		"checkout": {{Tags: map[string]any{"environment": " PROD "}, Value: true, Rollout: RolloutPercent("level", 20)}},
+	}})
+	if err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	cfg, _ := New(rdb, 1)
+	rules := cfg.snapshot.Load().(*Snapshot).Rules["checkout"]
+	if len(rules) != 1 || rules[0].Tags["environment"] != "prod" || rules[0].Rollout.Salt != "checkout-v1" {
+		t.Errorf("Expected salt to be kept, got %+v", rules)
+	}
+}
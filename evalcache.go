@@ -0,0 +1,187 @@
+package bttsetting
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultEvalCacheSize 默认的求值缓存条目上限。
+const DefaultEvalCacheSize = 10000
+
+// WithEvalCacheSize 设置跨 Getter 的求值缓存条目上限，n <= 0 表示关闭。
+//
+// 求值缓存以 (Key, 解析后标签的规范编码) 为键记录规则匹配结果，随 AllHash 整体失效。
+// 每个请求新建的 Getter 只要标签组合相同，就可以跳过规则匹配。
+// 依赖人群包、时间窗口的结果同样可以缓存（按人群包版本与窗口边界校验）；
+// 求值过程中调用了自定义匹配器的结果不缓存，因为匹配器可能依赖外部数据。
+func WithEvalCacheSize(n int) Option {
+	return func(c *Config) {
+		if n <= 0 {
+			c.evals = nil
+			return
+		}
+		c.evals = newEvalCache(n)
+	}
+}
+
+// EvalCacheStats 求值缓存统计。
+type EvalCacheStats struct {
+	Hits   uint64
+	Misses uint64
+	Size   int // 当前快照下的条目数
+}
+
+// HitRate 命中率，没有请求时为 0。
+func (s EvalCacheStats) HitRate() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// EvalCacheStats 返回求值缓存统计，未开启时返回零值。
+func (c *Config) EvalCacheStats() EvalCacheStats {
+	e := c.evals
+	if e == nil {
+		return EvalCacheStats{}
+	}
+	e.mu.RLock()
+	size := len(e.entries)
+	e.mu.RUnlock()
+	return EvalCacheStats{Hits: e.hits.Load(), Misses: e.misses.Load(), Size: size}
+}
+
+// evalKey 求值缓存的键。
+type evalKey struct {
+	key string
+	fp  string // canonicalTags(解析后的标签)
+}
+
+// evalResult 缓存的规则匹配结果。
+type evalResult struct {
+	ruleIndex  int    // -1 表示没有规则匹配
+	segmentGen uint64 // 同 CacheEntry
+	expiresAt  int64  // 同 CacheEntry
+}
+
+// evalCache Config 级的有界求值缓存，只保存一个 AllHash 下的结果。
+type evalCache struct {
+	max int
+
+	mu      sync.RWMutex
+	hash    string
+	entries map[evalKey]evalResult
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+func newEvalCache(max int) *evalCache {
+	return &evalCache{max: max}
+}
+
+// lookup 查找快照 ss 下的匹配结果，并校验人群包版本与时间窗口。
+func (e *evalCache) lookup(c *Config, ss *Snapshot, key, fp string) (evalResult, bool) {
+	if e == nil {
+		return evalResult{}, false
+	}
+	e.mu.RLock()
+	res, ok := e.entries[evalKey{key, fp}]
+	ok = ok && e.hash == ss.AllHash
+	e.mu.RUnlock()
+
+	if ok &&
+		(res.segmentGen == 0 || res.segmentGen == c.segments.gen.Load()) &&
+		(res.expiresAt == 0 || c.now().UnixNano() < res.expiresAt) {
+		e.hits.Add(1)
+		return res, true
+	}
+	e.misses.Add(1)
+	return evalResult{}, false
+}
+
+// store 记录快照 ss 下的匹配结果。ss 只能是 Config 的当前快照，快照变化时清空旧结果；
+// 达到上限时淘汰任意一个条目（map 遍历顺序随机），避免有界缓存退化为只读。
+func (e *evalCache) store(c *Config, ss *Snapshot, key, fp string, res evalResult) {
+	if e == nil {
+		return
+	}
+	// 固定了旧快照的 Getter 不写入，避免与新快照的结果来回清空
+	if ss.AllHash != c.snapshot.Load().(*Snapshot).AllHash {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.entries == nil || e.hash != ss.AllHash {
+		e.hash = ss.AllHash
+		e.entries = make(map[evalKey]evalResult)
+	}
+	if len(e.entries) >= e.max {
+		for k := range e.entries {
+			delete(e.entries, k)
+			break
+		}
+	}
+	e.entries[evalKey{key, fp}] = res
+}
+
+// canonicalTags 把标签编码为与 map 遍历顺序无关的字符串，作为求值缓存键的一部分。
+// 编码带类型与长度前缀，不同的标签组合不会得到相同的结果；
+// 常见类型以外的值退化为 TagsFingerprint（JSON 的哈希）。
+// 与 TagsFingerprint 相比不做序列化与哈希，开销小得多，但只适合进程内使用。
+func canonicalTags(tags map[string]any) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		writeCanonical(&b, 's', k)
+		if !appendCanonicalValue(&b, tags[k]) {
+			return "#" + TagsFingerprint(tags)
+		}
+	}
+	return b.String()
+}
+
+func writeCanonical(b *strings.Builder, kind byte, s string) {
+	b.WriteByte(kind)
+	b.WriteString(strconv.Itoa(len(s)))
+	b.WriteByte(':')
+	b.WriteString(s)
+}
+
+func appendCanonicalValue(b *strings.Builder, v any) bool {
+	switch x := v.(type) {
+	case string:
+		writeCanonical(b, 's', x)
+	case bool:
+		writeCanonical(b, 'b', strconv.FormatBool(x))
+	case int:
+		writeCanonical(b, 'i', strconv.Itoa(x))
+	case int64:
+		writeCanonical(b, 'i', strconv.FormatInt(x, 10))
+	case float64:
+		writeCanonical(b, 'f', strconv.FormatFloat(x, 'g', -1, 64))
+	case []string:
+		b.WriteByte('l')
+		b.WriteString(strconv.Itoa(len(x)))
+		b.WriteByte(':')
+		for _, s := range x {
+			writeCanonical(b, 's', s)
+		}
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,174 @@
+package bttsetting
+
+import (
+	"testing"
+	"time"
+)
+
+func newEvalCacheTestConfig(size int) *Config {
+	cfg := &Config{segments: newSegmentStore(nil), now: time.Now, evals: newEvalCache(size)}
+	cfg.snapshot.Store(&Snapshot{
+		Version: 1,
+		AllHash: "hash1",
+		Rules: map[string][]Rule{
+			"timeout": {
+				{Tags: map[string]any{"env": "prod"}, ValueHash: "t1"},
+				{ValueHash: "t0"},
+			},
+			"tier": {
+				{Matchers: []MatcherCond{{Name: "test_evalcache_matcher"}}, ValueHash: "t1"},
+				{ValueHash: "t0"},
+			},
+		},
+		Values: map[string]string{"t1": "100", "t0": "50"},
+	})
+	return cfg
+}
+
+func TestEvalCache(t *testing.T) {
+	cfg := newEvalCacheTestConfig(100)
+
+	if v, _ := Get[int](cfg.WithTags(map[string]any{"env": "prod"}), "timeout"); v != 100 {
+		t.Fatalf("Expected 100, got %d", v)
+	}
+	if s := cfg.EvalCacheStats(); s.Hits != 0 || s.Misses != 1 || s.Size != 1 {
+		t.Errorf("Unexpected stats after first Get: %+v", s)
+	}
+
+	// 新 Getter、相同标签组合：命中求值缓存
+	if v, _ := Get[int](cfg.WithTags(map[string]any{"env": "prod"}), "timeout"); v != 100 {
+		t.Errorf("Expected 100, got %d", v)
+	}
+	// 不同标签组合：未命中；未匹配 (默认规则) 同样缓存
+	if v, _ := Get[int](cfg.WithTags(map[string]any{"env": "dev"}), "timeout"); v != 50 {
+		t.Errorf("Expected 50, got %d", v)
+	}
+	s := cfg.EvalCacheStats()
+	if s.Hits != 1 || s.Misses != 2 || s.Size != 2 {
+		t.Errorf("Unexpected stats: %+v", s)
+	}
+	if s.HitRate() < 0.33 || s.HitRate() > 0.34 {
+		t.Errorf("Unexpected hit rate %f", s.HitRate())
+	}
+
+	// 快照变化后整体失效
+	ss := cfg.snapshot.Load().(*Snapshot)
+	next := *ss
+	next.AllHash = "hash2"
+	next.Rules = map[string][]Rule{"timeout": {{ValueHash: "t0"}}}
+	cfg.snapshot.Store(&next)
+	if v, _ := Get[int](cfg.WithTags(map[string]any{"env": "prod"}), "timeout"); v != 50 {
+		t.Errorf("Expected 50 after reload, got %d", v)
+	}
+	if s := cfg.EvalCacheStats(); s.Misses != 3 || s.Size != 1 {
+		t.Errorf("Expected reset after reload, got %+v", s)
+	}
+}
+
+func TestEvalCache_Volatile(t *testing.T) {
+	calls := 0
+	RegisterMatcher("test_evalcache_matcher", func(arg any, tags map[string]any) bool {
+		calls++
+		return true
+	})
+	cfg := newEvalCacheTestConfig(100)
+
+	for i := 0; i < 3; i++ {
+		if v, _ := Get[int](cfg.WithTags(nil), "tier"); v != 100 {
+			t.Fatalf("Expected 100, got %d", v)
+		}
+	}
+	// 调用了自定义匹配器的结果不缓存，每个 Getter 都重新求值
+	if calls != 3 {
+		t.Errorf("Expected matcher called 3 times, got %d", calls)
+	}
+	if s := cfg.EvalCacheStats(); s.Size != 0 {
+		t.Errorf("Volatile result should not be cached, got %+v", s)
+	}
+}
+
+func TestEvalCache_Bounds(t *testing.T) {
+	cfg := newEvalCacheTestConfig(2)
+	for _, env := range []string{"a", "b", "c", "d"} {
+		Get[int](cfg.WithTags(map[string]any{"env": env}), "timeout")
+	}
+	if s := cfg.EvalCacheStats(); s.Size != 2 {
+		t.Errorf("Expected size bounded to 2, got %+v", s)
+	}
+
+	// 固定旧快照的 Getter 不写入
+	g := cfg.WithTags(map[string]any{"env": "e"})
+	g.pinned = &Snapshot{AllHash: "old", Rules: map[string][]Rule{"timeout": {{ValueHash: "t0"}}}, Values: map[string]string{"t0": "1"}}
+	Get[int](g, "timeout")
+	if cfg.evals.hash != "hash1" {
+		t.Errorf("Stale snapshot should not reset cache, got %s", cfg.evals.hash)
+	}
+
+	// 关闭
+	WithEvalCacheSize(0)(cfg)
+	Get[int](cfg.WithTags(map[string]any{"env": "prod"}), "timeout")
+	if s := cfg.EvalCacheStats(); s != (EvalCacheStats{}) {
+		t.Errorf("Expected zero stats when disabled, got %+v", s)
+	}
+}
+
+func TestEvalCache_TimeWindow(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	cfg := &Config{segments: newSegmentStore(nil), now: func() time.Time { return now }, evals: newEvalCache(10)}
+	cfg.snapshot.Store(&Snapshot{
+		Version: 1,
+		AllHash: "hash1",
+		Rules: map[string][]Rule{
+			"banner": {
+				{ValidUntil: now.Unix() + 60, ValueHash: "on"},
+				{ValueHash: "off"},
+			},
+		},
+		Values: map[string]string{"on": "true", "off": "false"},
+	})
+
+	if v, _ := Get[bool](cfg.WithTags(nil), "banner"); !v {
+		t.Fatal("Expected banner on")
+	}
+	if v, _ := Get[bool](cfg.WithTags(nil), "banner"); !v || cfg.EvalCacheStats().Hits != 1 {
+		t.Errorf("Expected cached banner on, stats %+v", cfg.EvalCacheStats())
+	}
+	// 窗口结束后缓存结果过期
+	now = now.Add(2 * time.Minute)
+	if v, _ := Get[bool](cfg.WithTags(nil), "banner"); v {
+		t.Error("Expected banner off after window")
+	}
+}
+
+func TestCanonicalTags(t *testing.T) {
+	distinct := []map[string]any{
+		nil,
+		{"a": "1"},
+		{"a": 1},
+		{"a": 1.5},
+		{"a": true},
+		{"a": "true"},
+		{"a": []string{"x", "y"}},
+		{"a": []string{"xy"}},
+		{"a": "x", "b": "y"},
+		{"a": "xs1:by"},
+		{"ab": "c"},
+		{"a": "bc"},
+	}
+	seen := make(map[string]int)
+	for i, tags := range distinct {
+		k := canonicalTags(tags)
+		if j, dup := seen[k]; dup {
+			t.Errorf("Tags %v and %v share key %q", distinct[j], tags, k)
+		}
+		seen[k] = i
+	}
+
+	if canonicalTags(map[string]any{"a": "x", "b": 2}) != canonicalTags(map[string]any{"b": 2, "a": "x"}) {
+		t.Error("Key should not depend on map order")
+	}
+	// 不支持的类型退化为指纹
+	if k := canonicalTags(map[string]any{"a": map[string]int{"x": 1}}); k == "" || k[0] != '#' {
+		t.Errorf("Expected fingerprint fallback, got %q", k)
+	}
+}
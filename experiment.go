@@ -0,0 +1,87 @@
+package bttsetting
+
+import "fmt"
+
+// pick 根据输入标签选择变体。缺少分桶标签或没有有效权重时返回 nil。
+func (e *Experiment) pick(inputTags map[string]any) *Variant {
+	val, ok := inputTags[e.Tag]
+	if !ok {
+		return nil
+	}
+	id, ok := bucketKey(val)
+	if !ok {
+		return nil
+	}
+
+	total := 0
+	for i := range e.Variants {
+		total += e.Variants[i].Weight
+	}
+	if total <= 0 {
+		return nil
+	}
+
+	// 将桶号等比映射到权重区间 [0, total)
+	target := RolloutBucket(e.Salt, id) * total / RolloutBuckets
+	for i := range e.Variants {
+		target -= e.Variants[i].Weight
+		if target < 0 {
+			return &e.Variants[i]
+		}
+	}
+	return nil
+}
+
+// validate 校验实验定义。
+func (e *Experiment) validate() error {
+	if e.ID == "" {
+		return fmt.Errorf("experiment id is empty")
+	}
+	if e.Tag == "" {
+		return fmt.Errorf("experiment %s: bucketing tag is empty", e.ID)
+	}
+	if len(e.Variants) == 0 {
+		return fmt.Errorf("experiment %s: no variants", e.ID)
+	}
+	total := 0
+	names := make(map[string]struct{}, len(e.Variants))
+	for _, v := range e.Variants {
+		if v.Weight < 0 {
+			return fmt.Errorf("experiment %s: negative weight for variant %s", e.ID, v.Name)
+		}
+		if _, dup := names[v.Name]; dup {
+			return fmt.Errorf("experiment %s: duplicate variant %s", e.ID, v.Name)
+		}
+		names[v.Name] = struct{}{}
+		total += v.Weight
+	}
+	if total <= 0 {
+		return fmt.Errorf("experiment %s: total weight must be positive", e.ID)
+	}
+	return nil
+}
+
+// resolve 返回规则最终生效的 ValueHash，实验规则同时返回选中的变体。
+// 实验规则在 Match 阶段已确认分桶标签存在，这里 pick 为 nil 仅在数据异常时发生。
+func (r *Rule) resolve(inputTags map[string]any) (string, *Variant) {
+	if r.Experiment == nil {
+		return r.ValueHash, nil
+	}
+	v := r.Experiment.pick(inputTags)
+	if v == nil {
+		return "", nil
+	}
+	return v.ValueHash, v
+}
+
+// valueHashes 返回规则引用的全部 ValueHash（含实验变体），用于加载值。
+func (r *Rule) valueHashes(fn func(hash string)) {
+	if r.ValueHash != "" {
+		fn(r.ValueHash)
+	}
+	if r.Experiment != nil {
+		for i := range r.Experiment.Variants {
+			fn(r.Experiment.Variants[i].ValueHash)
+		}
+	}
+}
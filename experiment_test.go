@@ -0,0 +1,182 @@
+package bttsetting
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// memorySink 是测试用的内存曝光接收者。
+type memorySink struct {
+	mu     sync.Mutex
+	events []ExposureEvent
+}
+
+func (s *memorySink) Expose(ev ExposureEvent) {
+	s.mu.Lock()
+	s.events = append(s.events, ev)
+	s.mu.Unlock()
+}
+
+func TestExperiment_Pick(t *testing.T) {
+	exp := &Experiment{
+		ID:   "exp1",
+		Tag:  "user_id",
+		Salt: "exp1",
+		Variants: []Variant{
+			{Name: "control", Weight: 50, ValueHash: "a"},
+			{Name: "treatment", Weight: 30, ValueHash: "b"},
+			{Name: "zero", Weight: 0, ValueHash: "z"},
+			{Name: "other", Weight: 20, ValueHash: "c"},
+		},
+	}
+	counts := make(map[string]int)
+	const n = 20000
+	for i := 0; i < n; i++ {
+		tags := map[string]any{"user_id": i}
+		v := exp.pick(tags)
+		if v == nil {
+			t.Fatal("Expected a variant")
+		}
+		// 同一用户多次选择结果稳定
+		if v2 := exp.pick(tags); v2 != v {
+			t.Fatal("Variant should be sticky")
+		}
+		counts[v.Name]++
+	}
+	if counts["zero"] != 0 {
+		t.Errorf("Zero weight variant should never be picked")
+	}
+	for name, want := range map[string]float64{"control": 0.5, "treatment": 0.3, "other": 0.2} {
+		got := float64(counts[name]) / n
+		if got < want-0.03 || got > want+0.03 {
+			t.Errorf("Variant %s ratio %.3f, want about %.2f", name, got, want)
+		}
+	}
+
+	if exp.pick(map[string]any{"other": 1}) != nil {
+		t.Error("Expected nil without bucketing tag")
+	}
+}
+
+func TestExperiment_Validate(t *testing.T) {
+	tests := []struct {
+		name string
+		exp  Experiment
+		ok   bool
+	}{
+		{"ok", Experiment{ID: "e", Tag: "uid", Variants: []Variant{{Name: "a", Weight: 1}}}, true},
+		{"no_id", Experiment{Tag: "uid", Variants: []Variant{{Name: "a", Weight: 1}}}, false},
+		{"no_tag", Experiment{ID: "e", Variants: []Variant{{Name: "a", Weight: 1}}}, false},
+		{"no_variants", Experiment{ID: "e", Tag: "uid"}, false},
+		{"zero_total", Experiment{ID: "e", Tag: "uid", Variants: []Variant{{Name: "a"}}}, false},
+		{"negative", Experiment{ID: "e", Tag: "uid", Variants: []Variant{{Name: "a", Weight: -1}, {Name: "b", Weight: 2}}}, false},
+		{"duplicate", Experiment{ID: "e", Tag: "uid", Variants: []Variant{{Name: "a", Weight: 1}, {Name: "a", Weight: 1}}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.exp.validate(); (err == nil) != tt.ok {
+				t.Errorf("validate() = %v, want ok=%v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestExperiment_PublishAndGet(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testexp:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	err := p.Publish(ctx, PublishRequest{
+		FullReplace: true,
+		Items: map[string][]RuleInput{
+			"button_color": {
+				{
+					Tags: map[string]any{"env": "prod"},
+					Experiment: &ExperimentInput{
+						ID:  "btn_2026",
+						Tag: "user_id",
+						Variants: []VariantInput{
+							{Name: "control", Weight: 1, Value: "blue"},
+							{Name: "red", Weight: 1, Value: "red"},
+						},
+					},
+				},
+				{Value: "gray"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	sink := &memorySink{}
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	cfg, err := New(rdb, 1, WithExposureSink(sink), WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		g := cfg.WithTags(map[string]any{"env": "prod", "user_id": fmt.Sprintf("u%d", i)})
+		v, err := Get[string](g, "button_color")
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		seen[v] = true
+		// L1 命中时不重复曝光
+		Get[string](g, "button_color")
+	}
+	if !seen["blue"] || !seen["red"] || seen["gray"] {
+		t.Errorf("Unexpected variants: %v", seen)
+	}
+	if len(sink.events) != 100 {
+		t.Fatalf("Expected 100 exposures, got %d", len(sink.events))
+	}
+	ev := sink.events[0]
+	if ev.Experiment != "btn_2026" || ev.Key != "button_color" || ev.TagsFingerprint == "" || ev.Version != 1 || ev.Timestamp != now.UnixMilli() {
+		t.Errorf("Unexpected exposure: %+v", ev)
+	}
+
+	// 缺少分桶标签时回退到默认规则，且不曝光
+	v, _ := Get[string](cfg.WithTags(map[string]any{"env": "prod"}), "button_color")
+	if v != "gray" {
+		t.Errorf("Expected gray without user_id, got %s", v)
+	}
+	if len(sink.events) != 100 {
+		t.Errorf("Default rule should not emit exposure")
+	}
+
+	// 非法实验定义被拒绝
+	err = p.Publish(ctx, PublishRequest{
+		Items: map[string][]RuleInput{
+			"bad": {{Experiment: &ExperimentInput{ID: "x", Tag: "user_id"}}},
+		},
+	})
+	if err == nil {
+		t.Error("Expected error for experiment without variants")
+	}
+}
+
+func TestTagsFingerprint(t *testing.T) {
+	a := TagsFingerprint(map[string]any{"a": 1, "b": "x"})
+	b := TagsFingerprint(map[string]any{"b": "x", "a": 1})
+	if a == "" || a != b {
+		t.Errorf("Fingerprint should be order independent: %s vs %s", a, b)
+	}
+	if a == TagsFingerprint(map[string]any{"a": 2, "b": "x"}) {
+		t.Error("Different tags should have different fingerprints")
+	}
+	if TagsFingerprint(nil) != "" {
+		t.Error("Empty tags should have empty fingerprint")
+	}
+}
@@ -0,0 +1,141 @@
+package bttsetting
+
+import "fmt"
+
+// MatchReason 单条规则的求值结果。
+type MatchReason int
+
+const (
+	ReasonMatched         MatchReason = iota // 规则匹配
+	ReasonMissingTag                         // 输入中缺少规则要求的标签
+	ReasonValueMismatch                      // 标签值不匹配
+	ReasonConditionFailed                    // 附加条件（灰度、实验、人群包、时间窗口等）未满足
+	ReasonNotEvaluated                       // 之前的规则已匹配，未求值
+)
+
+func (r MatchReason) String() string {
+	switch r {
+	case ReasonMatched:
+		return "matched"
+	case ReasonMissingTag:
+		return "missing_tag"
+	case ReasonValueMismatch:
+		return "value_mismatch"
+	case ReasonConditionFailed:
+		return "condition_failed"
+	case ReasonNotEvaluated:
+		return "not_evaluated"
+	}
+	return fmt.Sprintf("MatchReason(%d)", int(r))
+}
+
+// MarshalText 使 MatchReason 在 JSON 中以字符串输出，便于日志与调试接口阅读。
+func (r MatchReason) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// ValueSource 配置值的来源。
+type ValueSource string
+
+const (
+	SourceL1      ValueSource = "l1"      // Getter 本地缓存
+	SourceL2      ValueSource = "l2"      // 全局反序列化缓存
+	SourceDecode  ValueSource = "decode"  // 本次调用反序列化
+	SourceDefault ValueSource = "default" // Key 缺失，使用 Register 声明的默认值
+)
+
+// RuleTrace 单条规则的求值记录。
+type RuleTrace struct {
+	Index int `json:"index"`
+	// Level 求值使用的标签层级，0 为输入标签本身；定义了标签层级时，同一条规则在各级上的求值各记录一条
+	Level  int            `json:"level,omitempty"`
+	Tags   map[string]any `json:"tags,omitempty"`
+	Reason MatchReason    `json:"reason"`
+	// Field 未匹配的标签 Key，或未满足的条件名 (rollout、experiment、segment、time_window、matcher、prerequisite)
+	Field string `json:"field,omitempty"`
+	// Detail 条件的补充信息，如灰度标签、实验 ID、人群包名、匹配器名、前置开关 Key
+	Detail string `json:"detail,omitempty"`
+}
+
+// Explanation 一次求值的详细信息，可直接输出到日志或调试接口。
+type Explanation struct {
+	Key       string         `json:"key"`
+	Version   int            `json:"version"`
+	AllHash   string         `json:"all_hash"`
+	Tags      map[string]any `json:"tags,omitempty"` // 匹配时使用的输入标签（规范化，按层级回退展开到的一级）
+	Matched   bool           `json:"matched"`
+	RuleIndex int            `json:"rule_index"` // 匹配规则的下标，未匹配为 -1
+	RuleTags  map[string]any `json:"rule_tags,omitempty"`
+	ValueHash string         `json:"value_hash,omitempty"`
+	Variant   string         `json:"variant,omitempty"` // 实验规则选中的变体
+	Source    ValueSource    `json:"source,omitempty"`  // Explain 不读取值，为空
+	Rules     []RuleTrace    `json:"rules,omitempty"`
+}
+
+// GetDetailed 与 Get 相同，同时返回求值详情。即使返回错误（如未匹配），详情也会尽量填充。
+// 逐条记录规则需要重新求值，开销高于 Get，适合排查问题时使用。
+func GetDetailed[T any](g *Getter, key string) (T, *Explanation, error) {
+	ex := &Explanation{Key: key, RuleIndex: -1}
+	v, err := get[T](g, key, ex)
+	return v, ex, err
+}
+
+// GetDetailedShared 与 GetDetailed 相同，从 SharedGetter 读取。
+func GetDetailedShared[T any](sg *SharedGetter, key string) (T, *Explanation, error) {
+	ex := &Explanation{Key: key, RuleIndex: -1}
+	var (
+		v   T
+		err error
+	)
+	sg.locked(sg.current(), true, func(g *Getter) {
+		v, err = get[T](g, key, ex)
+	})
+	return v, ex, err
+}
+
+// Explain 只执行规则匹配并返回求值详情，不读取、不反序列化值；包括前置开关在内都不发送实验曝光，也不写入 L1 缓存。
+// Key 不存在时返回 ErrNotFound；存在但没有规则匹配时 Matched 为 false，error 为 nil。
+func Explain(g *Getter, key string) (*Explanation, error) {
+	return explain(g, key)
+}
+
+// ExplainShared 与 Explain 相同，使用 SharedGetter 的标签求值。
+func ExplainShared(sg *SharedGetter, key string) (*Explanation, error) {
+	var (
+		ex  *Explanation
+		err error
+	)
+	sg.locked(sg.current(), false, func(g *Getter) {
+		ex, err = explain(g, key)
+	})
+	return ex, err
+}
+
+func explain(g *Getter, key string) (*Explanation, error) {
+	ss := g.snapshot()
+	ex := &Explanation{Key: key, Version: ss.Version, AllHash: ss.AllHash, RuleIndex: -1}
+
+	rules, ok := ss.Rules[key]
+	if !ok {
+		return ex, ErrNotFound
+	}
+	tags := g.resolveTags(ss)
+	defer g.quietly()()
+	ec := evalContext{getter: g, segments: g.cfg.segments, clock: g.cfg.now}
+	if i := traceLevels(rules, g.levels, &ec, ex); i >= 0 {
+		valueHash, variant := rules[i].resolve(tags)
+		ex.setMatch(&rules[i], i, valueHash, variant)
+	}
+	return ex, nil
+}
+
+// setMatch 记录匹配的规则。
+func (ex *Explanation) setMatch(rule *Rule, idx int, valueHash string, variant *Variant) {
+	ex.Matched = true
+	ex.RuleIndex = idx
+	ex.RuleTags = rule.Tags
+	ex.ValueHash = valueHash
+	if variant != nil {
+		ex.Variant = variant.Name
+	}
+}
@@ -0,0 +1,237 @@
+package bttsetting
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestGetDetailed(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testexplain:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	err := p.Publish(ctx, PublishRequest{
+		FullReplace: true,
+		Items: map[string][]RuleInput{
+			"timeout": {
+				{Tags: map[string]any{"region": "us"}, Value: 100},
+				{Tags: map[string]any{"env": "prod"}, Value: 200},
+				{Tags: map[string]any{"env": "staging"}, Value: 300, Rollout: RolloutPercent("user_id", 0)},
+				{Tags: map[string]any{"env": "staging"}, Value: 400},
+				{Value: 500},
+			},
+			"only_prod": {
+				{Tags: map[string]any{"env": "prod"}, Value: true},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	cfg, _ := New(rdb, 1)
+	ss := cfg.snapshot.Load().(*Snapshot)
+
+	g := cfg.WithTags(map[string]any{"env": "staging", "user_id": "u1"})
+	v, ex, err := GetDetailed[int](g, "timeout")
+	if err != nil || v != 400 {
+		t.Fatalf("Expected 400, got %d, %v", v, err)
+	}
+	if !ex.Matched || ex.RuleIndex != 3 || ex.RuleTags["env"] != "staging" {
+		t.Errorf("Unexpected match: %+v", ex)
+	}
+	if ex.AllHash != ss.AllHash || ex.Version != 1 || ex.Key != "timeout" {
+		t.Errorf("Unexpected snapshot info: %+v", ex)
+	}
+	if ex.ValueHash != ss.Rules["timeout"][3].ValueHash {
+		t.Errorf("Unexpected value hash %s", ex.ValueHash)
+	}
+	if ex.Source != SourceDecode {
+		t.Errorf("Expected decode, got %s", ex.Source)
+	}
+
+	want := []struct {
+		reason MatchReason
+		field  string
+	}{
+		{ReasonMissingTag, "region"},
+		{ReasonValueMismatch, "env"},
+		{ReasonConditionFailed, condRollout},
+		{ReasonMatched, ""},
+		{ReasonNotEvaluated, ""},
+	}
+	if len(ex.Rules) != len(want) {
+		t.Fatalf("Expected %d traces, got %d", len(want), len(ex.Rules))
+	}
+	for i, w := range want {
+		tr := ex.Rules[i]
+		if tr.Index != i || tr.Reason != w.reason || tr.Field != w.field {
+			t.Errorf("Rule %d: got %+v, want %v/%s", i, tr, w.reason, w.field)
+		}
+	}
+	if ex.Rules[2].Detail != "user_id" {
+		t.Errorf("Expected rollout detail user_id, got %q", ex.Rules[2].Detail)
+	}
+
+	// 第二次命中 L1，详情保持一致
+	_, ex2, _ := GetDetailed[int](g, "timeout")
+	if ex2.Source != SourceL1 || ex2.RuleIndex != 3 || ex2.ValueHash != ex.ValueHash || len(ex2.Rules) != 5 {
+		t.Errorf("Unexpected L1 explanation: %+v", ex2)
+	}
+
+	// 新的 Getter 命中 L2
+	g2 := cfg.WithTags(map[string]any{"env": "staging"})
+	_, ex3, _ := GetDetailed[int](g2, "timeout")
+	if ex3.Source != SourceL2 {
+		t.Errorf("Expected l2, got %s", ex3.Source)
+	}
+	// 缺少 user_id，灰度条件无法分桶
+	if ex3.Rules[2].Reason != ReasonConditionFailed {
+		t.Errorf("Expected rollout failure, got %+v", ex3.Rules[2])
+	}
+
+	// 未匹配：返回 ErrNotFound，但详情仍可用
+	_, ex4, err := GetDetailed[bool](g, "only_prod")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if ex4.Matched || ex4.RuleIndex != -1 || len(ex4.Rules) != 1 || ex4.Rules[0].Reason != ReasonValueMismatch {
+		t.Errorf("Unexpected explanation: %+v", ex4)
+	}
+
+	// 详情可直接序列化输出
+	b, err := json.Marshal(ex)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if !strings.Contains(string(b), `"reason":"missing_tag"`) || !strings.Contains(string(b), `"source":"decode"`) {
+		t.Errorf("Unexpected JSON: %s", b)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testexplain2:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	err := p.Publish(ctx, PublishRequest{
+		FullReplace: true,
+		Items: map[string][]RuleInput{
+			"checkout": {
+				{
+					Tags: map[string]any{"env": "prod"},
+					Experiment: &ExperimentInput{
+						ID:  "exp1",
+						Tag: "user_id",
+						Variants: []VariantInput{
+							{Name: "control", Weight: 50, Value: "old"},
+							{Name: "treatment", Weight: 50, Value: "new"},
+						},
+					},
+				},
+				{Value: "old"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	sink := &memorySink{}
+	cfg, _ := New(rdb, 1, WithExposureSink(sink))
+
+	g := cfg.WithTags(map[string]any{"env": "prod", "user_id": "u1"})
+	ex, err := Explain(g, "checkout")
+	if err != nil {
+		t.Fatalf("Explain failed: %v", err)
+	}
+	if !ex.Matched || ex.RuleIndex != 0 || ex.Variant == "" || ex.ValueHash == "" {
+		t.Errorf("Unexpected explanation: %+v", ex)
+	}
+	if ex.Source != "" {
+		t.Errorf("Explain should not read value, got source %s", ex.Source)
+	}
+	// Explain 不发送曝光，也不写入 L1
+	if len(sink.events) != 0 {
+		t.Errorf("Explain should not expose, got %d events", len(sink.events))
+	}
+	if len(g.cache) != 0 {
+		t.Error("Explain should not populate L1")
+	}
+
+	// 与 Get 的结果一致
+	v, _ := Get[string](g, "checkout")
+	rawJSON := cfg.snapshot.Load().(*Snapshot).Values[ex.ValueHash]
+	var want string
+	json.Unmarshal([]byte(rawJSON), &want)
+	if v != want {
+		t.Errorf("Explain value %s differs from Get %s", want, v)
+	}
+
+	if _, err := Explain(g, "not_exist"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestExplain_Quiet(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testexplain3:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	p.Publish(ctx, PublishRequest{Items: map[string][]RuleInput{
+		"gate": {{Experiment: &ExperimentInput{ID: "exp", Tag: "uid", Variants: []VariantInput{
+			{Name: "on", Weight: 100, Value: true},
+		}}}},
+		"pool": {{Value: 10, Prerequisites: []Prerequisite{{Key: "gate", Want: true}}}},
+	}})
+	sink := &memorySink{}
+	cfg, _ := New(rdb, 1, WithExposureSink(sink))
+
+	// 前置开关是实验：Explain 不发送曝光，也不把未曝光的结果写入 L1
+	g := cfg.WithTags(map[string]any{"uid": "u1"})
+	if ex, err := Explain(g, "pool"); err != nil || !ex.Matched {
+		t.Fatalf("Expected match, got %+v (err: %v)", ex, err)
+	}
+	sink.mu.Lock()
+	n := len(sink.events)
+	sink.mu.Unlock()
+	if n != 0 {
+		t.Errorf("Expected no exposures from Explain, got %d", n)
+	}
+	if len(g.cache) != 0 {
+		t.Errorf("Expected Explain to leave L1 untouched, got %v", g.cache)
+	}
+
+	// 之后的 Get 正常求值并发送曝光
+	if v, err := Get[bool](g, "gate"); err != nil || !v {
+		t.Fatalf("Expected true, got %v (err: %v)", v, err)
+	}
+	sink.mu.Lock()
+	n = len(sink.events)
+	sink.mu.Unlock()
+	if n != 1 {
+		t.Errorf("Expected 1 exposure from Get, got %d", n)
+	}
+}
+
+func TestMatchReason_String(t *testing.T) {
+	if ReasonConditionFailed.String() != "condition_failed" {
+		t.Errorf("Unexpected string %s", ReasonConditionFailed)
+	}
+	if MatchReason(99).String() != "MatchReason(99)" {
+		t.Errorf("Unexpected string %s", MatchReason(99))
+	}
+}
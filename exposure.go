@@ -0,0 +1,185 @@
+package bttsetting
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ExposureEvent 实验曝光事件：某个 Getter 在一次 Get 中被分到了某个实验变体。
+type ExposureEvent struct {
+	Experiment      string // 实验 ID
+	Variant         string // 变体名
+	Key             string // 配置 Key
+	TagsFingerprint string // 标签集合指纹 (TagsFingerprint)
+	Version         int    // 应用版本
+	AllHash         string // 快照 Hash
+	Timestamp       int64  // 毫秒时间戳
+}
+
+// ExposureSink 接收曝光事件。Expose 在 Get 的调用路径上执行，实现必须是非阻塞且并发安全的。
+type ExposureSink interface {
+	Expose(ev ExposureEvent)
+}
+
+// WithExposureSink 设置实验曝光事件的接收者。未设置时不记录曝光。
+func WithExposureSink(sink ExposureSink) Option {
+	return func(c *Config) {
+		c.exposureSink = sink
+	}
+}
+
+// StreamSinkOptions 是 StreamExposureSink 的配置，零值字段使用默认值。
+type StreamSinkOptions struct {
+	BufferSize    int           // 内存缓冲事件数，满时丢弃新事件 (默认 4096)
+	BatchSize     int           // 单批写入的最大事件数 (默认 256)
+	FlushInterval time.Duration // 最长刷新间隔 (默认 1s)
+	MaxLen        int64         // Stream 近似最大长度，0 表示不限制
+}
+
+// StreamExposureSink 将曝光事件批量写入 Redis Stream (KeyExposures)，供分析方与业务结果关联。
+// Expose 只做一次非阻塞 channel 发送；写入在后台协程中按批次通过 Pipeline 完成。
+type StreamExposureSink struct {
+	rdb     *redis.Client
+	opts    StreamSinkOptions
+	ch      chan ExposureEvent
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+	dropped atomic.Int64
+	written atomic.Int64
+}
+
+// NewStreamExposureSink 创建并启动曝光事件写入器，使用完毕后需调用 Close 刷新剩余事件。
+func NewStreamExposureSink(client *redis.Client, opts StreamSinkOptions) *StreamExposureSink {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 4096
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 256
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+	s := &StreamExposureSink{
+		rdb:     client,
+		opts:    opts,
+		ch:      make(chan ExposureEvent, opts.BufferSize),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Expose 实现 ExposureSink。缓冲区满或已关闭时丢弃事件并计数，绝不阻塞调用方。
+func (s *StreamExposureSink) Expose(ev ExposureEvent) {
+	select {
+	case <-s.done:
+		s.dropped.Add(1)
+		return
+	default:
+	}
+	select {
+	case s.ch <- ev:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// Dropped 返回因缓冲区满、关闭或写入失败而丢弃的事件数。
+func (s *StreamExposureSink) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Written 返回已成功写入 Redis 的事件数。
+func (s *StreamExposureSink) Written() int64 {
+	return s.written.Load()
+}
+
+// Close 停止后台协程并刷新缓冲中的剩余事件。ctx 用于限制最后一次刷新的等待时间。
+func (s *StreamExposureSink) Close(ctx context.Context) error {
+	s.once.Do(func() { close(s.done) })
+	select {
+	case <-s.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *StreamExposureSink) run() {
+	defer close(s.stopped)
+	ticker := time.NewTicker(s.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]ExposureEvent, 0, s.opts.BatchSize)
+	for {
+		select {
+		case ev := <-s.ch:
+			batch = append(batch, ev)
+			if len(batch) >= s.opts.BatchSize {
+				batch = s.flush(batch)
+			}
+		case <-ticker.C:
+			batch = s.flush(batch)
+		case <-s.done:
+			// 取出缓冲中剩余的事件后最后刷新一次
+			for {
+				select {
+				case ev := <-s.ch:
+					batch = append(batch, ev)
+					if len(batch) >= s.opts.BatchSize {
+						batch = s.flush(batch)
+					}
+				default:
+					s.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush 通过 Pipeline 批量 XADD，返回清空后的 batch 以便复用。
+func (s *StreamExposureSink) flush(batch []ExposureEvent) []ExposureEvent {
+	if len(batch) == 0 {
+		return batch
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	streamKey := KeyExposures()
+	pipe := s.rdb.Pipeline()
+	for _, ev := range batch {
+		args := &redis.XAddArgs{
+			Stream: streamKey,
+			Values: []any{
+				"experiment", ev.Experiment,
+				"variant", ev.Variant,
+				"key", ev.Key,
+				"tags_fp", ev.TagsFingerprint,
+				"version", strconv.Itoa(ev.Version),
+				"all_hash", ev.AllHash,
+				"ts", strconv.FormatInt(ev.Timestamp, 10),
+			},
+		}
+		if s.opts.MaxLen > 0 {
+			args.MaxLen = s.opts.MaxLen
+			args.Approx = true
+		}
+		pipe.XAdd(ctx, args)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		slog.Error("write exposures failed", "err", err, "count", len(batch))
+		s.dropped.Add(int64(len(batch)))
+	} else {
+		s.written.Add(int64(len(batch)))
+	}
+	return batch[:0]
+}
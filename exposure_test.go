@@ -0,0 +1,66 @@
+package bttsetting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestStreamExposureSink(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testexpo:")
+	ctx := context.Background()
+
+	sink := NewStreamExposureSink(rdb, StreamSinkOptions{BatchSize: 10, FlushInterval: time.Hour})
+	for i := 0; i < 25; i++ {
+		sink.Expose(ExposureEvent{Experiment: "e1", Variant: "a", Key: "k", TagsFingerprint: "fp", Version: 1, Timestamp: int64(i)})
+	}
+
+	// 批次满时写入，剩余的在 Close 时刷新
+	if err := sink.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	n, err := rdb.XLen(ctx, KeyExposures()).Result()
+	if err != nil {
+		t.Fatalf("XLen failed: %v", err)
+	}
+	if n != 25 || sink.Written() != 25 {
+		t.Errorf("Expected 25 exposures, got %d (written %d)", n, sink.Written())
+	}
+
+	msgs, _ := rdb.XRange(ctx, KeyExposures(), "-", "+").Result()
+	if msgs[0].Values["experiment"] != "e1" || msgs[0].Values["tags_fp"] != "fp" {
+		t.Errorf("Unexpected message: %v", msgs[0].Values)
+	}
+
+	// 关闭后不再接收
+	sink.Expose(ExposureEvent{Experiment: "e1"})
+	if sink.Dropped() != 1 {
+		t.Errorf("Expected 1 dropped, got %d", sink.Dropped())
+	}
+}
+
+func TestStreamExposureSink_FlushInterval(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testexpo2:")
+	ctx := context.Background()
+
+	sink := NewStreamExposureSink(rdb, StreamSinkOptions{FlushInterval: 20 * time.Millisecond})
+	defer sink.Close(ctx)
+	sink.Expose(ExposureEvent{Experiment: "e1", Variant: "b"})
+
+	for i := 0; i < 50; i++ {
+		if n, _ := rdb.XLen(ctx, KeyExposures()).Result(); n == 1 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("Exposure should be flushed by interval")
+}
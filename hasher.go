@@ -4,6 +4,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"sort"
 )
 
@@ -31,6 +32,12 @@ func ComputeValueHash(val any) (string, []byte, error) {
 // ComputeAllHash 计算配置集的全局 Hash。
 // 它遍历所有配置项，按 Key 排序，并对它们的元数据组合进行 Hash。
 func ComputeAllHash(items map[string][]Rule) string {
+	return ComputeSnapshotHash(items, nil)
+}
+
+// ComputeSnapshotHash 计算包含快照元数据在内的全局 Hash。
+// meta 为空时结果与 ComputeAllHash 一致，保证引入元数据前发布的快照 Hash 不变。
+func ComputeSnapshotHash(items map[string][]Rule, meta *SnapshotMeta) string {
 	keys := make([]string, 0, len(items))
 	for k := range items {
 		keys = append(keys, k)
@@ -45,6 +52,46 @@ func ComputeAllHash(items map[string][]Rule) string {
 		data, _ := json.Marshal(rules)
 		h.Write(data)
 	}
+	if meta != nil && !meta.IsEmpty() {
+		data, _ := json.Marshal(meta)
+		h.Write(data)
+	}
 	sum := h.Sum(nil)
 	return hex.EncodeToString(sum)[:8]
 }
+
+// RolloutBucket 计算标签值在指定盐值下的灰度桶号 (0 ~ RolloutBuckets-1)。
+// 使用 FNV-1a 64 位 Hash，结果跨进程、跨版本稳定，且不产生内存分配。
+func RolloutBucket(salt, value string) int {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	var h uint64 = offset64
+	for i := 0; i < len(salt); i++ {
+		h ^= uint64(salt[i])
+		h *= prime64
+	}
+	// 分隔符，避免 salt="a", value="bc" 与 salt="ab", value="c" 冲突
+	h ^= ':'
+	h *= prime64
+	for i := 0; i < len(value); i++ {
+		h ^= uint64(value[i])
+		h *= prime64
+	}
+	return int(h % RolloutBuckets)
+}
+
+// TagsFingerprint 计算标签集合的规范化指纹 (与 Key 顺序无关)。
+// encoding/json 对 map keys 排序，因此相同的标签集合总是得到相同的指纹。
+func TagsFingerprint(tags map[string]any) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(tags)
+	if err != nil {
+		// 不可序列化的值（如 chan）退化为 fmt 输出，fmt 同样对 map keys 排序
+		data = []byte(fmt.Sprint(tags))
+	}
+	return CalculateHash16(data)
+}
@@ -0,0 +1,187 @@
+package bttsetting
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ExpandTags 根据快照中的标签层级，为输入标签补充所有上级标签。
+// 例如 city=haidian 会补充 province=beijing、country=cn，
+// 这样无需调用方自行计算祖先标签即可匹配更宽泛的规则。
+// 输入中已显式给出的标签不会被覆盖；若没有可展开的标签，直接返回原 map（不复制）。
+// Getter 匹配每条规则时按层级逐级回退（见 matchLevels），而不是直接使用完全展开的结果。
+func (s *Snapshot) ExpandTags(tags map[string]any) map[string]any {
+	levels := s.tagLevels(tags)
+	return levels[len(levels)-1]
+}
+
+// tagLevels 返回从输入标签开始逐级补充上级标签的各级标签：第 0 级为输入标签本身，
+// 第 i 级在第 i-1 级的基础上为每条层级链补充上一级标签，最后一级即完全展开的结果。
+// 没有可展开的标签时只有一级（原 map，不复制）。
+func (s *Snapshot) tagLevels(tags map[string]any) []map[string]any {
+	levels := []map[string]any{tags}
+	hier := s.Meta.Hierarchies
+	if len(hier) == 0 || len(tags) == 0 {
+		return levels
+	}
+
+	// 每条层级链当前展开到的标签，按 Key 排序，保证不同链路推导出同一个上级标签时结果确定
+	type chain struct {
+		key string
+		val any
+	}
+	var chains []chain
+	for k, v := range tags {
+		if _, ok := hier[k]; ok {
+			chains = append(chains, chain{k, v})
+		}
+	}
+	if len(chains) == 0 {
+		return levels
+	}
+	sort.Slice(chains, func(i, j int) bool { return chains[i].key < chains[j].key })
+
+	// 层级链长度不会超过层级定义数量，以此防止错误数据导致死循环
+	prev := tags
+	for depth := 0; depth < len(hier); depth++ {
+		var next map[string]any
+		for i := range chains {
+			c := &chains[i]
+			if c.key == "" {
+				continue
+			}
+			h, ok := hier[c.key]
+			if !ok {
+				c.key = ""
+				continue
+			}
+			parent, ok := h.parentOf(c.val)
+			if !ok {
+				c.key = ""
+				continue
+			}
+			if next == nil {
+				next = make(map[string]any, len(prev)+len(chains))
+				for k, v := range prev {
+					next[k] = v
+				}
+			}
+			if _, exists := next[h.Parent]; exists {
+				// 已显式给出或已由其他链路推导，保持不变
+				c.key = ""
+				continue
+			}
+			next[h.Parent] = parent
+			c.key, c.val = h.Parent, parent
+		}
+		if next == nil || len(next) == len(prev) {
+			break
+		}
+		levels = append(levels, next)
+		prev = next
+	}
+	return levels
+}
+
+// matchLevels 按规则顺序匹配（列表顺序即优先级），返回匹配规则的下标（未匹配为 -1）与匹配时使用的层级。
+// 每条规则先用输入标签本身匹配，不匹配时再逐级使用补充了上级标签的各级标签：
+// 标签层级只扩大单条规则能匹配的范围，不改变规则之间的优先级。只有一级时与 matchIndex 相同。
+func matchLevels(rules []Rule, levels []map[string]any, ec *evalContext) (int, int) {
+	last := len(levels) - 1
+	if last == 0 {
+		return matchIndex(rules, levels[0], ec), 0
+	}
+	for i := range rules {
+		for k := range levels {
+			if matchOne(&rules[i], levels[k], ec) {
+				return i, k
+			}
+		}
+	}
+	return -1, last
+}
+
+// traceLevels 按与 matchLevels 相同的顺序逐条记录规则的求值结果，返回匹配规则下标（未匹配为 -1）。
+// 规则在每一级标签上的求值各记录一条（RuleTrace.Level），匹配之后的规则记为 ReasonNotEvaluated；
+// ex.Tags 记录匹配时使用的一级标签，未匹配时为完全展开的标签。
+func traceLevels(rules []Rule, levels []map[string]any, ec *evalContext, ex *Explanation) int {
+	idx, last := -1, len(levels)-1
+	ex.Tags = levels[last]
+	ex.Rules = make([]RuleTrace, 0, len(rules))
+	for i := range rules {
+		if idx >= 0 {
+			ex.Rules = append(ex.Rules, RuleTrace{Index: i, Tags: rules[i].Tags, Reason: ReasonNotEvaluated})
+			continue
+		}
+		for k := range levels {
+			tr := RuleTrace{Index: i, Level: k, Tags: rules[i].Tags}
+			tr.Reason, tr.Field, tr.Detail = checkRule(&rules[i], levels[k], ec)
+			ex.Rules = append(ex.Rules, tr)
+			if tr.Reason == ReasonMatched {
+				idx = i
+				ex.Tags = levels[k]
+				break
+			}
+		}
+	}
+	return idx
+}
+
+// parentOf 返回标签值对应的上级值。
+// 多值标签（[]string / []any）会逐个映射并去重，结果仍为 []string，保持“包含”语义。
+func (h *TagHierarchy) parentOf(val any) (any, bool) {
+	switch v := val.(type) {
+	case string:
+		p, ok := h.Values[v]
+		return p, ok
+	case []string:
+		return h.parentsOf(v)
+	case []any:
+		strs := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				strs = append(strs, s)
+			}
+		}
+		return h.parentsOf(strs)
+	}
+	return nil, false
+}
+
+func (h *TagHierarchy) parentsOf(vals []string) (any, bool) {
+	var parents []string
+	seen := make(map[string]struct{}, len(vals))
+	for _, s := range vals {
+		p, ok := h.Values[s]
+		if !ok {
+			continue
+		}
+		if _, dup := seen[p]; dup {
+			continue
+		}
+		seen[p] = struct{}{}
+		parents = append(parents, p)
+	}
+	return parents, len(parents) > 0
+}
+
+// validateHierarchies 检查标签层级是否存在环（如 city -> province -> city）。
+func validateHierarchies(hier map[string]TagHierarchy) error {
+	for start := range hier {
+		key := start
+		for depth := 0; depth <= len(hier); depth++ {
+			h, ok := hier[key]
+			if !ok {
+				break
+			}
+			if h.Parent == "" {
+				return fmt.Errorf("hierarchy %s: empty parent", key)
+			}
+			if h.Parent == start {
+				return fmt.Errorf("hierarchy cycle detected at %s", start)
+			}
+			key = h.Parent
+		}
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package bttsetting
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func testHierarchies() map[string]TagHierarchy {
+	return map[string]TagHierarchy{
+		"district": {Parent: "city", Values: map[string]string{"zhongguancun": "haidian"}},
+		"city":     {Parent: "province", Values: map[string]string{"haidian": "beijing", "pudong": "shanghai"}},
+		"province": {Parent: "country", Values: map[string]string{"beijing": "cn", "shanghai": "cn"}},
+	}
+}
+
+func TestSnapshot_ExpandTags(t *testing.T) {
+	ss := &Snapshot{Meta: SnapshotMeta{Hierarchies: testHierarchies()}}
+
+	got := ss.ExpandTags(map[string]any{"district": "zhongguancun", "uid": 1})
+	want := map[string]any{"district": "zhongguancun", "city": "haidian", "province": "beijing", "country": "cn", "uid": 1}
+	if !MatchTagsExact(got, want) {
+		t.Errorf("ExpandTags() = %v, want %v", got, want)
+	}
+
+	// 显式给出的上级标签不被覆盖
+	got = ss.ExpandTags(map[string]any{"city": "haidian", "province": "hebei"})
+	if got["province"] != "hebei" {
+		t.Errorf("Explicit province overwritten: %v", got)
+	}
+	if _, ok := got["country"]; ok {
+		t.Errorf("Expansion should stop at explicit tag: %v", got)
+	}
+
+	// 未知值不展开，且返回原 map
+	in := map[string]any{"city": "unknown"}
+	if got = ss.ExpandTags(in); len(got) != 1 {
+		t.Errorf("Unknown value should not expand: %v", got)
+	}
+
+	// 多值标签
+	got = ss.ExpandTags(map[string]any{"city": []string{"haidian", "pudong"}})
+	parents, ok := got["province"].([]string)
+	if !ok || len(parents) != 2 {
+		t.Errorf("Multi-valued expansion failed: %v", got)
+	}
+	if got["country"] == nil {
+		t.Errorf("Multi-valued expansion should continue upward: %v", got)
+	}
+}
+
+func TestValidateHierarchies(t *testing.T) {
+	if err := validateHierarchies(testHierarchies()); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	cyclic := map[string]TagHierarchy{
+		"a": {Parent: "b"},
+		"b": {Parent: "c"},
+		"c": {Parent: "b"},
+	}
+	if err := validateHierarchies(cyclic); err == nil {
+		t.Error("Expected cycle error")
+	}
+}
+
+func TestHierarchy_PublishAndGet(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testhier:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	err := p.Publish(ctx, PublishRequest{
+		FullReplace: true,
+		Items: map[string][]RuleInput{
+			"limit": {
+				{Tags: map[string]any{"city": "pudong"}, Value: 1},
+				{Tags: map[string]any{"province": "beijing"}, Value: 2},
+				{Tags: map[string]any{}, Value: 3},
+			},
+		},
+		Hierarchies: testHierarchies(),
+	})
+	if err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	cfg, err := New(rdb, 1)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	v, err := Get[int](cfg.WithTags(map[string]any{"city": "haidian"}), "limit")
+	if err != nil || v != 2 {
+		t.Errorf("Expected 2 via province fallback, got %v (err: %v)", v, err)
+	}
+
+	// 增量发布不带 Hierarchies 时保留层级
+	if err := p.Publish(ctx, PublishRequest{
+		Items: map[string][]RuleInput{"other": {{Value: "x"}}},
+	}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	hash2, _ := rdb.HGet(ctx, KeyVersions(), "1").Result()
+	cfg.Load(ctx)
+	v, _ = Get[int](cfg.WithTags(map[string]any{"district": "zhongguancun"}), "limit")
+	if v != 2 {
+		t.Errorf("Hierarchy should be kept on incremental publish, got %v", v)
+	}
+
+	// 层级变更会改变 AllHash
+	if err := p.Publish(ctx, PublishRequest{Hierarchies: map[string]TagHierarchy{}}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	hash3, _ := rdb.HGet(ctx, KeyVersions(), "1").Result()
+	if hash3 == hash2 {
+		t.Error("AllHash should change with hierarchy")
+	}
+	cfg.Load(ctx)
+	v, _ = Get[int](cfg.WithTags(map[string]any{"city": "haidian"}), "limit")
+	if v != 3 {
+		t.Errorf("Expected default after clearing hierarchy, got %v", v)
+	}
+
+	// 带环的层级应被拒绝
+	err = p.Publish(ctx, PublishRequest{Hierarchies: map[string]TagHierarchy{"a": {Parent: "a"}}})
+	if err == nil {
+		t.Error("Expected cycle error")
+	}
+}
+
+func TestHierarchy_ListOrder(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testhier2:")
+	ctx := context.Background()
+
+	// broad 中更宽泛的规则排在前面，narrow 中更具体的规则排在前面：
+	// 层级只扩大规则能匹配的范围，优先级仍由列表顺序决定
+	p := NewPublisher(rdb, 1)
+	if err := p.Publish(ctx, PublishRequest{
+		Items: map[string][]RuleInput{
+			"broad": {
+				{Tags: map[string]any{}, Value: 0, Rollout: RolloutPercent("uid", 0)},
+				{Tags: map[string]any{"province": "beijing"}, Value: 1},
+				{Tags: map[string]any{"city": "haidian"}, Value: 2},
+				{Tags: map[string]any{}, Value: 3},
+			},
+			"narrow": {
+				{Tags: map[string]any{"city": "haidian"}, Value: 2},
+				{Tags: map[string]any{"province": "beijing"}, Value: 1},
+				{Tags: map[string]any{"country": "cn"}, Value: 0},
+				{Tags: map[string]any{}, Value: 3},
+			},
+		},
+		Hierarchies: testHierarchies(),
+	}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	cfg, _ := New(rdb, 1)
+
+	tests := []struct {
+		key  string
+		tags map[string]any
+		want int
+	}{
+		{"broad", map[string]any{"city": "haidian"}, 1}, // 列表顺序与层级顺序不一致时按列表顺序
+		{"broad", map[string]any{"district": "zhongguancun"}, 1},
+		{"broad", map[string]any{"city": "pudong"}, 3},
+		{"narrow", map[string]any{"district": "zhongguancun"}, 2}, // 逐级回退到 city
+		{"narrow", map[string]any{"city": "chaoyang", "province": "beijing"}, 1},
+		{"narrow", map[string]any{"city": "pudong"}, 0},
+		{"narrow", map[string]any{"city": "unknown"}, 3},
+	}
+	for _, tt := range tests {
+		g := cfg.WithTags(tt.tags)
+		if v, err := Get[int](g, tt.key); err != nil || v != tt.want {
+			t.Errorf("%s %v: expected %d, got %d (err: %v)", tt.key, tt.tags, tt.want, v, err)
+		}
+	}
+
+	// 求值详情记录匹配规则使用的一级标签
+	ex, _ := Explain(cfg.WithTags(map[string]any{"district": "zhongguancun"}), "narrow")
+	if ex.RuleIndex != 0 || ex.Tags["city"] != "haidian" {
+		t.Errorf("Expected rule 0 matched at the city level, got %+v", ex)
+	}
+	if _, ok := ex.Tags["province"]; ok {
+		t.Errorf("Expected the city level, got %v", ex.Tags)
+	}
+	ex, _ = Explain(cfg.WithTags(map[string]any{"city": "haidian"}), "broad")
+	if ex.RuleIndex != 1 {
+		t.Errorf("Expected rule 1 matched in list order, got %+v", ex)
+	}
+	// 每条规则在各级标签上的求值各记录一条，不被后面的层级覆盖
+	want := []struct {
+		index, level int
+		reason       MatchReason
+	}{
+		{0, 0, ReasonConditionFailed}, {0, 1, ReasonConditionFailed}, {0, 2, ReasonConditionFailed},
+		{1, 0, ReasonMissingTag}, {1, 1, ReasonMatched},
+		{2, 0, ReasonNotEvaluated}, {3, 0, ReasonNotEvaluated},
+	}
+	if len(ex.Rules) != len(want) {
+		t.Fatalf("Expected %d traces, got %+v", len(want), ex.Rules)
+	}
+	for i, w := range want {
+		if tr := ex.Rules[i]; tr.Index != w.index || tr.Level != w.level || tr.Reason != w.reason {
+			t.Errorf("trace %d: expected %+v, got %+v", i, w, tr)
+		}
+	}
+}
+
+func TestHierarchy_FullReplaceKeepsMeta(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testhier3:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	if err := p.Publish(ctx, PublishRequest{
+		Items:         map[string][]RuleInput{"limit": {{Tags: map[string]any{"province": "beijing"}, Value: 2}}},
+		Hierarchies:   testHierarchies(),
+		TagDictionary: map[string]TagDef{"province": {Type: TagTypeString}, "city": {Type: TagTypeString}},
+		KeyMeta:       map[string]KeyMetadata{"limit": {Static: true}},
+	}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	// FullReplace 只替换规则，未给出的元数据保持不变
+	if err := p.Publish(ctx, PublishRequest{
+		FullReplace: true,
+		Items:       map[string][]RuleInput{"limit": {{Tags: map[string]any{"province": "beijing"}, Value: 3}}},
+	}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	cfg, _ := New(rdb, 1)
+	ss := cfg.snapshot.Load().(*Snapshot)
+	if len(ss.Meta.Hierarchies) != 3 || len(ss.Meta.Dictionary) != 2 || !ss.Meta.Keys["limit"].Static {
+		t.Errorf("Expected meta to be kept on FullReplace, got %+v", ss.Meta)
+	}
+	if v, _ := Get[int](cfg.WithTags(map[string]any{"city": "haidian"}), "limit"); v != 3 {
+		t.Errorf("Expected 3 via province fallback, got %d", v)
+	}
+	if err := p.Publish(ctx, PublishRequest{
+		FullReplace: true,
+		Items:       map[string][]RuleInput{"limit": {{Tags: map[string]any{"unknown": "x"}, Value: 1}}},
+	}); err == nil {
+		t.Error("Expected dictionary to still apply on FullReplace")
+	}
+}
@@ -99,7 +99,8 @@ func TestIntegration(t *testing.T) {
 	time.Sleep(500 * time.Millisecond) // Miniredis is fast/local
 
 	// 9. 验证更新
-	// 应该已更新缓存/快照
+	// 应该已更新缓存/快照；g 固定了首次读取的快照，需要 Refresh
+	g.Refresh()
 	val2, err := Get[int](g, "timeout")
 	if err != nil || val2 != 2000 {
 		t.Errorf("Get timeout updated failed, expected 2000, got %v (err: %v)", val2, err)
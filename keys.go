@@ -0,0 +1,102 @@
+package bttsetting
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Keys 返回当前快照中以 prefix 开头的配置 Key（已排序），prefix 为空时返回全部 Key。
+// prefix 可以带通配后缀，如 "payment.*" 与 "payment." 等价。
+func (c *Config) Keys(prefix string) []string {
+	return c.snapshot.Load().(*Snapshot).keysWithPrefix(prefix)
+}
+
+// GetAll 读取以 prefix 开头的所有 Key（规则同 Config.Keys），按访问器的标签求值，r 可以是 *Getter 或 *SharedGetter。
+// 所有 Key 读自同一个快照，并包括通过 Register 声明的 Key（缺失时使用默认值）。
+// 没有规则匹配且没有默认值的 Key 不出现在结果中，也不视为错误；
+// 其他错误（如类型不匹配）与 GetMany 一样以 "key: err" 的形式合并返回，成功的 Key 仍写入结果。
+func GetAll[T any, R Reader](r R, prefix string) (map[string]T, error) {
+	var (
+		cfg  *Config
+		ss   *Snapshot
+		read func(key string) (T, error)
+	)
+	if g, ok := any(r).(*Getter); ok {
+		cfg, ss = g.cfg, g.snapshot()
+		read = func(key string) (T, error) { return get[T](g, key, nil) }
+	} else {
+		sg := any(r).(*SharedGetter)
+		cfg, ss = sg.cfg, sg.current()
+		read = func(key string) (T, error) { return getShared[T](sg, ss, key) }
+	}
+
+	// 注册了默认值但尚未发布的 Key 同样读取（使用默认值）
+	keys := mergeKeys(ss.keysWithPrefix(prefix), cfg.registeredKeys(prefix))
+	out := make(map[string]T, len(keys))
+	var errs []error
+	for _, key := range keys {
+		v, err := read(key)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			continue
+		}
+		out[key] = v
+	}
+	return out, errors.Join(errs...)
+}
+
+// keysWithPrefix 返回以 prefix 开头的 Key（已排序），去掉 prefix 末尾的 "*"。
+func (s *Snapshot) keysWithPrefix(prefix string) []string {
+	prefix = strings.TrimSuffix(prefix, "*")
+	all := s.keys
+	if all == nil {
+		// 非 Load 构建的快照
+		all = sortedRuleKeys(s.Rules)
+	}
+	i := sort.SearchStrings(all, prefix)
+	j := i
+	for j < len(all) && strings.HasPrefix(all[j], prefix) {
+		j++
+	}
+	out := make([]string, j-i)
+	copy(out, all[i:j])
+	return out
+}
+
+// mergeKeys 合并两个已排序的 Key 列表并去重。
+func mergeKeys(a, b []string) []string {
+	if len(b) == 0 {
+		return a
+	}
+	out := make([]string, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case j == len(b) || (i < len(a) && a[i] < b[j]):
+			out = append(out, a[i])
+			i++
+		case i == len(a) || b[j] < a[i]:
+			out = append(out, b[j])
+			j++
+		default:
+			out = append(out, a[i])
+			i, j = i+1, j+1
+		}
+	}
+	return out
+}
+
+// sortedRuleKeys 返回规则中的全部 Key（已排序）。
+func sortedRuleKeys(rules map[string][]Rule) []string {
+	keys := make([]string, 0, len(rules))
+	for k := range rules {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,65 @@
+package bttsetting
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestKeysAndGetAll(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testkeys:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	err := p.Publish(ctx, PublishRequest{FullReplace: true, Items: map[string][]RuleInput{
+		"payment.alipay": {{Tags: map[string]any{"env": "prod"}, Value: "https://alipay"}, {Value: "https://alipay-test"}},
+		"payment.stripe": {{Value: "https://stripe"}},
+		"payment.paypal": {{Tags: map[string]any{"region": "us"}, Value: "https://paypal"}},
+		"payment.retry":  {{Value: 3}},
+		"paymentx":       {{Value: "x"}},
+		"timeout":        {{Value: 10}},
+	}})
+	if err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	cfg, _ := New(rdb, 1)
+
+	want := []string{"payment.alipay", "payment.paypal", "payment.retry", "payment.stripe"}
+	if got := cfg.Keys("payment.*"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected keys %v", got)
+	}
+	if got := cfg.Keys("payment."); !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected keys %v", got)
+	}
+	if got := cfg.Keys(""); len(got) != 6 {
+		t.Errorf("Expected all keys, got %v", got)
+	}
+	if got := cfg.Keys("nope"); len(got) != 0 {
+		t.Errorf("Expected no keys, got %v", got)
+	}
+
+	// 未匹配的 Key 跳过；类型不匹配的 Key 返回错误，其他 Key 仍然返回
+	g := cfg.WithTags(map[string]any{"env": "prod"})
+	got, err := GetAll[string](g, "payment.*")
+	wantVals := map[string]string{"payment.alipay": "https://alipay", "payment.stripe": "https://stripe"}
+	if !reflect.DeepEqual(got, wantVals) {
+		t.Errorf("Unexpected values %v", got)
+	}
+	var tm *TypeMismatchError
+	if !errors.As(err, &tm) || tm.Key != "payment.retry" || errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected type mismatch for payment.retry only, got %v", err)
+	}
+
+	sg := cfg.WithSharedTags(map[string]any{"region": "us"})
+	got, _ = GetAll[string](sg, "payment.")
+	if got["payment.paypal"] != "https://paypal" || got["payment.alipay"] != "https://alipay-test" || len(got) != 3 {
+		t.Errorf("Unexpected shared values %v", got)
+	}
+}
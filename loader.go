@@ -6,7 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
-	"strings"
+	"sort"
 
 	"github.com/redis/go-redis/v9"
 )
@@ -33,7 +33,7 @@ func (c *Config) Load(ctx context.Context) error {
 	}
 
 	configItems := make(map[string][]Rule)
-	neededHashes := make(map[string]bool)
+	ruleHashes := make(map[string]string, len(rulesMap))
 
 	for k, v := range rulesMap {
 		var rules []Rule
@@ -42,13 +42,39 @@ func (c *Config) Load(ctx context.Context) error {
 		}
 		// 确保 Key 匹配
 		configItems[k] = rules
+		ruleHashes[k] = CalculateHash16([]byte(v))
+	}
 
-		for _, rule := range rules {
-			neededHashes[rule.ValueHash] = true
+	// 2.1 加载快照元数据 (标签层级等)，不存在时为空
+	var meta SnapshotMeta
+	metaJSON, err := c.rdb.Get(ctx, KeyMeta(allHash)).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return fmt.Errorf("get meta failed: %w", err)
+	}
+	if metaJSON != "" {
+		if err := json.Unmarshal([]byte(metaJSON), &meta); err != nil {
+			return fmt.Errorf("unmarshal meta failed: %w", err)
 		}
 	}
 
+	// 2.2 静态 Key 保持进程启动时的规则，记录等待重启生效的变更
+	c.mu.RLock()
+	static := c.static
+	c.mu.RUnlock()
+	var pending map[string]string
+	if static != nil {
+		pending = static.pin(configItems, ruleHashes)
+	}
+
 	// 3. 加载 Values
+	neededHashes := make(map[string]bool)
+	for _, rules := range configItems {
+		for i := range rules {
+			rules[i].valueHashes(func(h string) {
+				neededHashes[h] = true
+			})
+		}
+	}
 	valuesMap := make(map[string]string)
 	missingHashes := make([]string, 0)
 
@@ -61,6 +87,8 @@ func (c *Config) Load(ctx context.Context) error {
 	for h := range neededHashes {
 		if val, ok := oldValues[h]; ok {
 			valuesMap[h] = val
+		} else if val, ok := static.value(h); ok {
+			valuesMap[h] = val
 		} else {
 			missingHashes = append(missingHashes, h)
 		}
@@ -83,35 +111,117 @@ func (c *Config) Load(ctx context.Context) error {
 		}
 	}
 
+	// 3.1 同步规则引用的人群包 (增量：版本未变的人群包直接复用)
+	if err := c.segments.sync(ctx, segmentNames(configItems)); err != nil {
+		return err
+	}
+
 	// 4. 构建快照
 	ss := &Snapshot{
 		Version: c.version,
 		AllHash: allHash,
 		Rules:   configItems,
 		Values:  valuesMap,
-	}
+		Meta:    meta,
 
-	// 5. 原子更新
-	c.snapshot.Store(ss)
+		ruleHashes: ruleHashes,
+		keys:       sortedRuleKeys(configItems),
+	}
 
-	// 6. 清理 L2 缓存 (GC)
-	// 移除不在新快照中的 Hash 对应的值，防止内存泄漏
-	c.valueCache.Range(func(key, _ any) bool {
-		kStr, ok := key.(string)
-		if !ok {
-			return true
-		}
-		// Key format: Hash|Type
-		if idx := strings.Index(kStr, "|"); idx > 0 {
-			hash := kStr[:idx]
-			if _, exists := ss.Values[hash]; !exists {
-				c.valueCache.Delete(key)
+	// 5. 原子更新 (并发 Load 之间串行，保证变更按快照顺序投递)
+	c.mu.Lock()
+	oldSS, _ := c.snapshot.Swap(ss).(*Snapshot)
+	if c.static == nil {
+		// 第一次加载到的快照即进程启动时的配置
+		c.static = captureStatic(ss)
+	}
+	restartChanged := !samePending(c.pending, pending)
+	c.pending = pending
+
+	// 6. 快照变化时轮换 L2 缓存代际，不在新快照中的值在下一次轮换时释放
+	changed := oldSS == nil || oldSS.AllHash != ss.AllHash
+	if changed {
+		c.valueCache.rotate()
+		// 有订阅者时计算差异，交给后台协程投递；New 初始化的空快照 (AllHash 为空) 不参与比较
+		if oldSS != nil && oldSS.AllHash != "" && c.changes.active() {
+			changes := diffSnapshots(oldSS, ss)
+			if len(changes) > 0 || restartChanged {
+				c.changes.publish(&ChangeSet{
+					Version:        ss.Version,
+					OldHash:        oldSS.AllHash,
+					NewHash:        ss.AllHash,
+					Changes:        changes,
+					PendingRestart: sortedKeys(pending),
+					restartChanged: restartChanged,
+					old:            oldSS,
+					new:            ss,
+				})
 			}
 		}
-		return true
-	})
+	}
+	c.mu.Unlock()
+
+	// 7. 释放 mu 之后再通知重载回调：回调会重新求值（可能访问 Redis），不应阻塞 Status 等读取
+	if changed {
+		c.runReloadHooks(oldSS, ss)
+	}
 
 	slog.Info("load config success", "version", c.version, "allHash", allHash)
 
 	return nil
 }
+
+// reloadHook 快照 AllHash 变化后在 Load 中同步调用的回调（不持有 mu），old 可能为 nil。
+// 回调之间按注册顺序执行，不应长时间阻塞；回调应读取 Config 的当前快照，而不是依赖 new。
+type reloadHook func(old, new *Snapshot)
+
+// addReloadHook 注册重载回调，返回取消注册的函数。
+func (c *Config) addReloadHook(h reloadHook) (remove func()) {
+	c.hooksMu.Lock()
+	defer c.hooksMu.Unlock()
+	if c.hooks == nil {
+		c.hooks = make(map[uint64]reloadHook)
+	}
+	c.hookSeq++
+	id := c.hookSeq
+	c.hooks[id] = h
+	return func() {
+		c.hooksMu.Lock()
+		delete(c.hooks, id)
+		c.hooksMu.Unlock()
+	}
+}
+
+// runReloadHooks 按注册顺序调用重载回调。回调 Panic 只记录日志，不影响重载。
+// 并发 Load 的回调由 hooksRun 串行执行；new 已被更新的快照替换时跳过，由之后的 Load 通知。
+// 调用期间不持有 hooksMu，回调中可以注册或取消回调。
+func (c *Config) runReloadHooks(old, new *Snapshot) {
+	c.hooksRun.Lock()
+	defer c.hooksRun.Unlock()
+	if c.snapshot.Load().(*Snapshot).AllHash != new.AllHash {
+		return
+	}
+
+	c.hooksMu.Lock()
+	ids := make([]uint64, 0, len(c.hooks))
+	for id := range c.hooks {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	hooks := make([]reloadHook, len(ids))
+	for i, id := range ids {
+		hooks[i] = c.hooks[id]
+	}
+	c.hooksMu.Unlock()
+
+	for _, h := range hooks {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					slog.Error("reload hook panicked", "panic", r)
+				}
+			}()
+			h(old, new)
+		}()
+	}
+}
@@ -1,60 +1,266 @@
 package bttsetting
 
+import (
+	"reflect"
+	"time"
+)
+
+// evalContext 规则求值依赖的外部环境（如人群包、时钟、Getter），并记录求值过程中用到的可变依赖。
+// Match 使用空环境，此时依赖外部环境的条件（如人群包）一律视为不匹配。
+type evalContext struct {
+	getter   *Getter // 求值前置开关所用的 Getter，nil 表示不支持前置开关
+	segments *segmentStore
+	// segmentGen 首次检查人群包时的人群包版本，0 表示未使用人群包
+	segmentGen uint64
+
+	clock  func() time.Time // 时间窗口求值使用的时钟，nil 表示 time.Now
+	nowT   time.Time        // 本次求值固定使用的当前时间，首次使用时获取
+	hasNow bool
+	// expiresAt 求值结果可能变化的最早时间 (UnixNano)，0 表示不随时间变化
+	expiresAt int64
+	// volatile 求值调用了自定义匹配器，结果可能依赖外部数据，不能跨 Getter 复用
+	volatile bool
+}
+
+// now 返回本次求值的当前时间，同一次求值中的所有规则使用同一时刻。
+func (ec *evalContext) now() time.Time {
+	if !ec.hasNow {
+		if ec.clock != nil {
+			ec.nowT = ec.clock()
+		} else {
+			ec.nowT = time.Now()
+		}
+		ec.hasNow = true
+	}
+	return ec.nowT
+}
+
+// expireAt 记录求值结果可能变化的时间点，保留最早的一个。
+func (ec *evalContext) expireAt(t time.Time) {
+	n := t.UnixNano()
+	if ec.expiresAt == 0 || n < ec.expiresAt {
+		ec.expiresAt = n
+	}
+}
+
+// inSegment 检查输入标签是否属于条件中的人群包。
+func (ec *evalContext) inSegment(cond *SegmentCond, inputTags map[string]any) bool {
+	if ec.segments == nil {
+		return false
+	}
+	if ec.segmentGen == 0 {
+		// 先记录版本再检查成员：若检查期间人群包变化，版本已递增，缓存会被判定为过期
+		ec.segmentGen = ec.segments.gen.Load()
+	}
+	val, ok := inputTags[cond.Tag]
+	if !ok {
+		return false
+	}
+	member, ok := bucketKey(val)
+	if !ok {
+		return false
+	}
+	in, err := ec.segments.contains(cond.Name, member)
+	if err != nil {
+		// 未能确认时按不属于处理，但结果立即过期：L1、求值缓存与 ValueOf 都不保留，下次读取重新确认
+		ec.expireAt(ec.now())
+	}
+	return in
+}
+
 // Match 为给定的输入标签查找最佳匹配规则。
 // 规则按照 Slice 顺序匹配，一旦匹配成功立即返回（列表顺序即优先级）。
+// 依赖外部环境的条件（如人群包、前置开关）视为不匹配，时间窗口按 time.Now 求值。
 func Match(rules []Rule, inputTags map[string]any) *Rule {
+	var ec evalContext
+	if i := matchIndex(rules, inputTags, &ec); i >= 0 {
+		return &rules[i]
+	}
+	return nil
+}
+
+// matchIndex 在给定求值环境下查找匹配规则，返回规则下标，未匹配时返回 -1。
+func matchIndex(rules []Rule, inputTags map[string]any, ec *evalContext) int {
 	for i := range rules {
-		rule := &rules[i]
-		if matchOne(rule, inputTags) {
-			return rule
+		if matchOne(&rules[i], inputTags, ec) {
+			return i
 		}
 	}
 	// 如果存在但未匹配到，则回退到空标签规则（默认规则）
 	// (如果列表中包含空标签规则，应该在循环中处理。
 	// 通常空标签规则优先级最低)
-	return nil
+	return -1
 }
 
-// MatchTagsExact 检查两个 Tag map 是否完全相等
+// MatchTagsExact 检查两个 Tag map 是否完全相等。
+// 值按 reflect.DeepEqual 比较，切片、map 等不可比较的标签值不会 Panic。
 func MatchTagsExact(a, b map[string]any) bool {
 	if len(a) != len(b) {
 		return false
 	}
 	for k, v := range a {
-		if v2, ok := b[k]; !ok || v != v2 {
+		if v2, ok := b[k]; !ok || !reflect.DeepEqual(v, v2) {
 			return false
 		}
 	}
 	return true
 }
 
-// matchOne 检查 rule.Tags 是否是 inputTags 的子集且值相等。
-func matchOne(rule *Rule, inputTags map[string]any) bool {
-	// 如果规则没有标签，它匹配所有情况（默认规则）
+// matchOne 检查 rule.Tags 是否是 inputTags 的子集且值相等，并检查规则的附加条件（如百分比灰度）。
+func matchOne(rule *Rule, inputTags map[string]any, ec *evalContext) bool {
+	reason, _, _ := checkRule(rule, inputTags, ec)
+	return reason == ReasonMatched
+}
+
+// checkRule 检查单条规则，返回匹配结果及未匹配的原因：
+// field 为缺失/不匹配的标签 Key 或失败的条件名，detail 为条件的补充信息（如匹配器名）。
+// 返回的字符串均引用已有数据，不产生内存分配。
+func checkRule(rule *Rule, inputTags map[string]any, ec *evalContext) (reason MatchReason, field, detail string) {
+	// 如果规则没有标签，它匹配所有情况（默认规则），但仍需满足附加条件
 	if len(rule.Tags) == 0 {
-		return true
+		return checkConditions(rule, inputTags, ec)
 	}
 
 	// 如果输入的标签少于规则的标签，则无法匹配
 	if len(inputTags) < len(rule.Tags) {
-		return false
+		for key := range rule.Tags {
+			if _, ok := inputTags[key]; !ok {
+				return ReasonMissingTag, key, ""
+			}
+		}
 	}
 
 	for key, ruleVal := range rule.Tags {
 		inputVal, ok := inputTags[key]
 		if !ok {
-			return false // 输入中缺少标签 Key
+			return ReasonMissingTag, key, "" // 输入中缺少标签 Key
 		}
 
-		// 简单的相等性检查
-		if ruleVal != inputVal {
-			// 处理数字类型不匹配 (例如 int vs float64 来自 JSON)
-			if !valuesEqual(ruleVal, inputVal) {
-				return false
+		if !tagValueMatch(ruleVal, inputVal) {
+			return ReasonValueMismatch, key, ""
+		}
+	}
+	return checkConditions(rule, inputTags, ec)
+}
+
+// 条件名，用于解释未匹配原因
+const (
+	condTimeWindow   = "time_window"
+	condRollout      = "rollout"
+	condExperiment   = "experiment"
+	condSegment      = "segment"
+	condMatcher      = "matcher"
+	condPrerequisite = "prerequisite"
+)
+
+// checkConditions 检查标签以外的规则条件，均为空时直接通过。
+func checkConditions(rule *Rule, inputTags map[string]any, ec *evalContext) (MatchReason, string, string) {
+	if rule.hasTimeWindow() && !rule.matchTime(ec) {
+		return ReasonConditionFailed, condTimeWindow, ""
+	}
+	if rule.Rollout != nil && !rule.Rollout.match(inputTags) {
+		return ReasonConditionFailed, condRollout, rule.Rollout.Tag
+	}
+	// 实验规则要求输入中存在可分桶的标签，否则无法分组，视为不匹配
+	if rule.Experiment != nil && rule.Experiment.pick(inputTags) == nil {
+		return ReasonConditionFailed, condExperiment, rule.Experiment.ID
+	}
+	if rule.Segment != nil && !ec.inSegment(rule.Segment, inputTags) {
+		return ReasonConditionFailed, condSegment, rule.Segment.Name
+	}
+	for i := range rule.Matchers {
+		if !ec.checkMatcher(&rule.Matchers[i], inputTags) {
+			return ReasonConditionFailed, condMatcher, rule.Matchers[i].Name
+		}
+	}
+	for i := range rule.Prerequisites {
+		if !ec.checkPrereq(&rule.Prerequisites[i]) {
+			return ReasonConditionFailed, condPrerequisite, rule.Prerequisites[i].Key
+		}
+	}
+	return ReasonMatched, "", ""
+}
+
+// tagValueMatch 检查单个规则标签值是否与输入标签值匹配。
+// 输入值可以是标量（相等语义），也可以是切片/数组/集合（包含语义），
+// 例如输入 groups=[beta, staff] 可以匹配规则 groups=beta。
+// 注意：原先的 ruleVal != inputVal 在两侧都是同类型不可比较值（如 []any）时会 Panic，
+// 因此这里改为先走类型分支，任何情况下都不会 Panic。
+func tagValueMatch(ruleVal, inputVal any) bool {
+	switch iv := inputVal.(type) {
+	case string:
+		// 快速路径：最常见的字符串标签，直接比较，无需反射
+		if rv, ok := ruleVal.(string); ok {
+			return rv == iv
+		}
+		return false
+	case []string:
+		rv, ok := ruleVal.(string)
+		if !ok {
+			return false
+		}
+		for _, s := range iv {
+			if s == rv {
+				return true
 			}
 		}
+		return false
+	case []any:
+		for _, v := range iv {
+			if valuesEqual(ruleVal, v) {
+				return true
+			}
+		}
+		return false
+	case map[string]struct{}:
+		rv, ok := ruleVal.(string)
+		if !ok {
+			return false
+		}
+		_, ok = iv[rv]
+		return ok
+	case map[string]bool:
+		rv, ok := ruleVal.(string)
+		return ok && iv[rv]
 	}
-	return true
+
+	// 其他标量：处理数字类型不匹配 (例如 int vs float64 来自 JSON)
+	if valuesEqual(ruleVal, inputVal) {
+		return true
+	}
+
+	// 慢速路径：其他类型的切片/数组/集合通过反射处理（如 []int, []int64, map[int]struct{}）
+	return containsReflect(ruleVal, inputVal)
+}
+
+// containsReflect 通过反射检查 inputVal 容器中是否包含 ruleVal。
+// 对于 Map，仅在 Key 类型可以由 ruleVal 转换而来时进行查找，且值为 false 的 bool 集合项视为不包含。
+func containsReflect(ruleVal, inputVal any) bool {
+	if inputVal == nil || ruleVal == nil {
+		return false
+	}
+	rv := reflect.ValueOf(inputVal)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if valuesEqual(ruleVal, rv.Index(i).Interface()) {
+				return true
+			}
+		}
+	case reflect.Map:
+		iter := rv.MapRange()
+		for iter.Next() {
+			if !valuesEqual(ruleVal, iter.Key().Interface()) {
+				continue
+			}
+			// map[T]bool 形式的集合，false 表示不在集合中
+			if v := iter.Value(); v.Kind() == reflect.Bool {
+				return v.Bool()
+			}
+			return true
+		}
+	}
+	return false
 }
 
 func valuesEqual(a, b any) bool {
@@ -1,7 +1,11 @@
 package bttsetting
 
 import (
+	"context"
 	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
 )
 
 func TestMatch(t *testing.T) {
@@ -181,6 +185,24 @@ func TestMatchTagsExact(t *testing.T) {
 			map[string]any{"a": 1.0},
 			false,
 		},
+		{
+			"Equal slice values",
+			map[string]any{"groups": []any{"beta", "staff"}},
+			map[string]any{"groups": []any{"beta", "staff"}},
+			true,
+		},
+		{
+			"Different slice values",
+			map[string]any{"groups": []any{"beta"}},
+			map[string]any{"groups": []any{"staff"}},
+			false,
+		},
+		{
+			"Equal map values",
+			map[string]any{"m": map[string]any{"a": 1}},
+			map[string]any{"m": map[string]any{"a": 1}},
+			true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -191,3 +213,79 @@ func TestMatchTagsExact(t *testing.T) {
 		})
 	}
 }
+
+func TestMatchTagsExact_SliceRuleTags(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testramp2:")
+	ctx := context.Background()
+
+	// 规则标签值为切片时，查找规则与沿用盐值的比较不能 Panic
+	tags := map[string]any{"regions": []any{"cn", "us"}}
+	p := NewPublisher(rdb, 1)
+	input := func(percent float64) PublishRequest {
+		return PublishRequest{Items: map[string][]RuleInput{
+			"new_checkout": {
+				{Tags: tags, Value: true, Rollout: RolloutPercent("user_id", percent)},
+				{Value: false},
+			},
+		}}
+	}
+	if err := p.Publish(ctx, input(1)); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	if err := p.Publish(ctx, input(10)); err != nil {
+		t.Fatalf("Republish failed: %v", err)
+	}
+	if err := p.Ramp(ctx, "new_checkout", tags, 50); err != nil {
+		t.Fatalf("Ramp failed: %v", err)
+	}
+}
+
+func TestMatch_MultiValuedInput(t *testing.T) {
+	rules := []Rule{
+		{Tags: map[string]any{"groups": "beta"}, ValueHash: "beta"},
+		{Tags: map[string]any{"level": 3}, ValueHash: "level3"},
+		{Tags: map[string]any{}, ValueHash: "default"},
+	}
+
+	tests := []struct {
+		name  string
+		input map[string]any
+		want  string
+	}{
+		{"scalar", map[string]any{"groups": "beta"}, "beta"},
+		{"string_slice", map[string]any{"groups": []string{"staff", "beta"}}, "beta"},
+		{"string_slice_miss", map[string]any{"groups": []string{"staff"}}, "default"},
+		{"any_slice", map[string]any{"groups": []any{"staff", "beta"}}, "beta"},
+		{"set", map[string]any{"groups": map[string]struct{}{"beta": {}}}, "beta"},
+		{"bool_set_false", map[string]any{"groups": map[string]bool{"beta": false}}, "default"},
+		{"bool_set_true", map[string]any{"groups": map[string]bool{"beta": true}}, "beta"},
+		{"int_slice_numeric", map[string]any{"level": []int{1, 3}}, "level3"},
+		{"float_array_numeric", map[string]any{"level": [2]float64{2, 3.0}}, "level3"},
+		{"int_set", map[string]any{"level": map[int]struct{}{3: {}}}, "level3"},
+		{"empty_slice", map[string]any{"groups": []string{}}, "default"},
+		{"unhashable_nested", map[string]any{"groups": []any{[]any{"beta"}, map[string]any{"a": 1}}}, "default"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Match(rules, tt.input)
+			if r == nil || r.ValueHash != tt.want {
+				t.Errorf("Expected %s, got %v", tt.want, r)
+			}
+		})
+	}
+}
+
+func TestMatch_UncomparableNoPanic(t *testing.T) {
+	// 规则值和输入值都是不可比较类型时不应 Panic
+	rules := []Rule{
+		{Tags: map[string]any{"k": []any{"a"}}, ValueHash: "v1"},
+		{Tags: map[string]any{"m": map[string]any{"a": 1}}, ValueHash: "v2"},
+	}
+	if r := Match(rules, map[string]any{"k": []any{"a"}, "m": map[string]any{"a": 1}}); r != nil {
+		t.Errorf("Expected nil, got %v", r)
+	}
+}
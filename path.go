@@ -0,0 +1,183 @@
+package bttsetting
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ErrPathNotFound 配置 Key 存在，但值中没有指定的路径（与 Key 不存在的 ErrNotFound 区分）。
+var ErrPathNotFound = errors.New("config path not found")
+
+// GetPath 读取对象类型配置值中的一个字段，r 可以是 *Getter 或 *SharedGetter。
+//
+// path 可以是以 "." 分隔的路径（如 "pool.max_open"、"hosts.0"），
+// 也可以是以 "/" 开头的 JSON Pointer（如 "/pool/max_open"，字段名中含 "." 时使用）。
+// 空路径表示整个值。数组按下标访问。
+//
+// 只反序列化路径指向的子树，结果按 (ValueHash, 路径, 类型) 缓存在 L2 中。
+// Key 不存在或未匹配时按 Register 声明的默认值读取，没有默认值时返回 ErrNotFound；路径不存在时返回 ErrPathNotFound。
+func GetPath[T any, R Reader](r R, key, path string) (T, error) {
+	if g, ok := any(r).(*Getter); ok {
+		return getPath[T](g, g.snapshot(), key, path)
+	}
+	sg := any(r).(*SharedGetter)
+	ss := sg.current()
+	// 已发布的 L1 缓存记录了该 Key 的求值结果，可以跳过求值且不加锁
+	if st := sg.state.Load(); st != nil && st.hash == ss.AllHash {
+		if e, ok := st.load(key).evaluated(sg.cfg, ss); ok {
+			return decodeEvaluated[T](sg.cfg, ss, key, e, path)
+		}
+	}
+	var (
+		v   T
+		err error
+	)
+	sg.locked(ss, true, func(g *Getter) {
+		v, err = getPath[T](g, ss, key, path)
+	})
+	return v, err
+}
+
+// getPath 是 GetPath 的 Getter 实现。
+func getPath[T any](g *Getter, ss *Snapshot, key, path string) (T, error) {
+	// L1 中同一个 Key 的任意条目都记录了求值结果
+	if e, ok := g.entries(key).evaluated(g.cfg, ss); ok {
+		return decodeEvaluated[T](g.cfg, ss, key, e, path)
+	}
+	ev, err := g.evaluate(ss, key, nil)
+	if errors.Is(err, ErrNotFound) {
+		g.storeNotFound(ss, key, &ev)
+		return defaultValue[T](g.cfg, key, path)
+	}
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	// 只记录求值结果（子树的解码结果在 L2 中），之后的读取不再求值，也不重复发送曝光
+	g.store(key, ev.cacheEntry(ss, nil, nil))
+	return decodePath[T](g.cfg, key, ev.valueHash, ev.rawJSON, path)
+}
+
+// decodeEvaluated 按 L1 缓存条目记录的求值结果读取 path 指向的子树。
+func decodeEvaluated[T any](c *Config, ss *Snapshot, key string, e *CacheEntry, path string) (T, error) {
+	if e.notFound {
+		return defaultValue[T](c, key, path)
+	}
+	return decodePath[T](c, key, e.valueHash, ss.Values[e.valueHash], path)
+}
+
+// decodePath 从 L2 缓存读取值中 path 指向的子树，未命中时提取并反序列化子树。
+func decodePath[T any](c *Config, key, valueHash, rawJSON, path string) (T, error) {
+	var zero T
+	if c.recordTypes {
+		c.recordType(key, path, typeOf[T]())
+	}
+	if path == "" {
+		v, _, err := decodeValue[T](c, valueHash, rawJSON)
+		if err != nil {
+			var tm *TypeMismatchError
+			if errors.As(err, &tm) {
+				tm.Key = key
+			}
+		}
+		return v, err
+	}
+
+	vc := &c.valueCache
+	k := valueKey{hash: valueHash, path: path, typ: typeOf[T]()}
+	if cached, ok := vc.get(k); ok {
+		return cached.(T), nil
+	}
+
+	tokens, err := parsePath(path)
+	if err != nil {
+		return zero, err
+	}
+	sub, err := extractPath([]byte(rawJSON), tokens)
+	if err != nil {
+		return zero, fmt.Errorf("key %s path %s: %w", key, path, err)
+	}
+
+	var val T
+	if err := vc.unmarshal(string(sub), &val, k.typ); err != nil {
+		var tm *TypeMismatchError
+		if errors.As(err, &tm) {
+			tm.Key = key
+			tm.Field = joinField(path, tm.Field)
+		}
+		return zero, err
+	}
+	vc.put(k, val, vc.entrySize(reflect.ValueOf(&val).Elem()))
+	return val, nil
+}
+
+// joinField 把子树内的字段路径拼接到 path 之后，用于错误信息。
+func joinField(path, field string) string {
+	if field == "" {
+		return path
+	}
+	return path + "." + field
+}
+
+// parsePath 把点分路径或 JSON Pointer 拆分为逐级的字段名（或数组下标）。
+func parsePath(path string) ([]string, error) {
+	if !strings.HasPrefix(path, "/") {
+		tokens := strings.Split(path, ".")
+		for _, t := range tokens {
+			if t == "" {
+				return nil, fmt.Errorf("invalid path %q: empty segment", path)
+			}
+		}
+		return tokens, nil
+	}
+	// JSON Pointer (RFC 6901)：~1 表示 "/"，~0 表示 "~"
+	tokens := strings.Split(path[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// extractPath 逐级定位 tokens 指向的 JSON 子树，只解析沿途的对象与数组，不解码其他字段。
+func extractPath(data []byte, tokens []string) ([]byte, error) {
+	for _, t := range tokens {
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			return nil, ErrPathNotFound
+		}
+		switch data[0] {
+		case '{':
+			var obj map[string]json.RawMessage
+			if err := json.Unmarshal(data, &obj); err != nil {
+				return nil, err
+			}
+			next, ok := obj[t]
+			if !ok {
+				return nil, ErrPathNotFound
+			}
+			data = next
+		case '[':
+			i, err := strconv.Atoi(t)
+			if err != nil || i < 0 {
+				return nil, ErrPathNotFound
+			}
+			var arr []json.RawMessage
+			if err := json.Unmarshal(data, &arr); err != nil {
+				return nil, err
+			}
+			if i >= len(arr) {
+				return nil, ErrPathNotFound
+			}
+			data = arr[i]
+		default:
+			// 标量没有子路径
+			return nil, ErrPathNotFound
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,148 @@
+package bttsetting
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestGetPath(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testpath:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	err := p.Publish(ctx, PublishRequest{FullReplace: true, Items: map[string][]RuleInput{
+		"db": {
+			{Tags: map[string]any{"env": "prod"}, Value: map[string]any{
+				"pool":    map[string]any{"max_open": 100, "idle_timeout": "30s"},
+				"hosts":   []string{"a", "b"},
+				"a.b":     "dotted",
+				"timeout": 5,
+			}},
+		},
+	}})
+	if err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	cfg, _ := New(rdb, 1)
+	g := cfg.WithTags(map[string]any{"env": "prod"})
+
+	if v, err := GetPath[int](g, "db", "pool.max_open"); err != nil || v != 100 {
+		t.Errorf("Expected 100, got %d, %v", v, err)
+	}
+	if v, _ := GetPath[int](g, "db", "/pool/max_open"); v != 100 {
+		t.Errorf("Expected 100 via JSON Pointer, got %d", v)
+	}
+	// 子树同样使用注册的解码器
+	if v, _ := GetPath[time.Duration](g, "db", "pool.idle_timeout"); v != 30*time.Second {
+		t.Errorf("Expected 30s, got %v", v)
+	}
+	if v, _ := GetPath[string](g, "db", "hosts.1"); v != "b" {
+		t.Errorf("Expected b, got %s", v)
+	}
+	if v, _ := GetPath[string](g, "db", "/a.b"); v != "dotted" {
+		t.Errorf("Expected dotted, got %s", v)
+	}
+	if v, _ := GetPath[map[string]int](g, "db", "pool"); v != nil {
+		t.Errorf("Expected type mismatch for idle_timeout, got %v", v)
+	}
+	if v, _ := GetPath[[]string](g, "db", ""); v != nil {
+		t.Errorf("Expected empty path to read whole object, got %v", v)
+	}
+
+	for _, path := range []string{"pool.max_idle", "hosts.2", "hosts.x", "timeout.value", "/missing"} {
+		if _, err := GetPath[int](g, "db", path); !errors.Is(err, ErrPathNotFound) || errors.Is(err, ErrNotFound) {
+			t.Errorf("Path %s: expected ErrPathNotFound, got %v", path, err)
+		}
+	}
+	if _, err := GetPath[int](g, "missing", "a"); !errors.Is(err, ErrNotFound) || errors.Is(err, ErrPathNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if _, err := GetPath[int](cfg.WithTags(nil), "db", "timeout"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for unmatched tags, got %v", err)
+	}
+	var tm *TypeMismatchError
+	if _, err := GetPath[int](g, "db", "hosts"); !errors.As(err, &tm) || tm.Key != "db" || tm.Field != "hosts" {
+		t.Errorf("Expected TypeMismatchError, got %v", err)
+	}
+
+	// 按 (ValueHash, 路径, 类型) 缓存在 L2
+	hash := cfg.snapshot.Load().(*Snapshot).Rules["db"][0].ValueHash
+	if cur, _ := valueCacheHas(&cfg.valueCache, valueKey{hash: hash, path: "pool.max_open", typ: reflect.TypeOf(0)}); !cur {
+		t.Error("Expected path value in L2")
+	}
+	decodes := cfg.ValueCacheStats().Decodes
+	if v, _ := GetPath[int](cfg.WithTags(map[string]any{"env": "prod"}), "db", "pool.max_open"); v != 100 {
+		t.Errorf("Expected 100, got %d", v)
+	}
+	if cfg.ValueCacheStats().Decodes != decodes {
+		t.Error("Expected L2 hit without decoding")
+	}
+
+	// SharedGetter
+	sg := cfg.WithSharedTags(map[string]any{"env": "prod"})
+	if v, _ := GetPath[string](sg, "db", "hosts.0"); v != "a" {
+		t.Errorf("Expected a, got %s", v)
+	}
+	GetShared[map[string]any](sg, "db")
+	if v, _ := GetPath[int](sg, "db", "timeout"); v != 5 {
+		t.Errorf("Expected 5 via published L1, got %d", v)
+	}
+}
+
+func TestGetPath_CachesEvaluation(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testpath2:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	p.Publish(ctx, PublishRequest{FullReplace: true, Items: map[string][]RuleInput{
+		"ui": {{Experiment: &ExperimentInput{ID: "exp", Tag: "uid", Variants: []VariantInput{
+			{Name: "a", Weight: 100, Value: map[string]any{"color": "red"}},
+		}}}},
+	}})
+	sink := &memorySink{}
+	cfg, _ := New(rdb, 1, WithExposureSink(sink))
+
+	// 重复读取只求值一次：只发送一次曝光，之后按其他路径、类型读取同样复用
+	g := cfg.WithTags(map[string]any{"uid": "u1"})
+	for i := 0; i < 3; i++ {
+		if v, err := GetPath[string](g, "ui", "color"); err != nil || v != "red" {
+			t.Fatalf("Expected red, got %q, %v", v, err)
+		}
+	}
+	GetPath[any](g, "ui", "")
+	Get[map[string]string](g, "ui")
+	if len(sink.events) != 1 {
+		t.Errorf("Expected 1 exposure, got %d", len(sink.events))
+	}
+
+	// SharedGetter 发布求值结果后按路径读取不加锁
+	sg := cfg.WithSharedTags(map[string]any{"uid": "u2"})
+	GetPath[string](sg, "ui", "color")
+	if _, ok := sg.state.Load().load("ui").evaluated(cfg, cfg.snapshot.Load().(*Snapshot)); !ok {
+		t.Error("Expected evaluation to be published")
+	}
+	GetPath[string](sg, "ui", "color")
+	if len(sink.events) != 2 {
+		t.Errorf("Expected 2 exposures, got %d", len(sink.events))
+	}
+
+	// 不存在的 Key 同样缓存
+	if _, err := GetPath[string](g, "missing", "x"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if e, ok := g.cache["missing"].evaluated(cfg, g.snapshot()); !ok || !e.notFound {
+		t.Error("Expected negative L1 entry")
+	}
+}
@@ -0,0 +1,108 @@
+package bttsetting
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+// MatcherFunc 自定义匹配器：ruleArg 为规则中发布的参数 (经 JSON 往返，数字为 float64)，
+// tags 为 Getter 解析后的输入标签 (只读)。实现必须是并发安全的。
+type MatcherFunc func(ruleArg any, tags map[string]any) bool
+
+// MatcherCond 规则中对自定义匹配器的引用。
+type MatcherCond struct {
+	Name string `json:"name"`          // 通过 RegisterMatcher 注册的名称
+	Arg  any    `json:"arg,omitempty"` // 传给匹配器的参数
+}
+
+var (
+	// matchers 全局匹配器注册表，写时复制，读路径无锁
+	matchers   atomic.Pointer[map[string]MatcherFunc]
+	matchersMu sync.Mutex
+)
+
+// RegisterMatcher 注册自定义匹配器 (如 IP -> 地区、商户等级查表)。
+// 应在进程启动时、加载引用该匹配器的配置之前调用；重复注册同名匹配器会覆盖。
+func RegisterMatcher(name string, fn MatcherFunc) {
+	matchersMu.Lock()
+	defer matchersMu.Unlock()
+
+	next := make(map[string]MatcherFunc)
+	if cur := matchers.Load(); cur != nil {
+		for k, v := range *cur {
+			next[k] = v
+		}
+	}
+	next[name] = fn
+	matchers.Store(&next)
+}
+
+func lookupMatcher(name string) (MatcherFunc, bool) {
+	cur := matchers.Load()
+	if cur == nil {
+		return nil, false
+	}
+	fn, ok := (*cur)[name]
+	return fn, ok
+}
+
+// checkMatcher 调用自定义匹配器。未注册的匹配器视为不匹配并上报；匹配器 Panic 时视为不匹配。
+func (ec *evalContext) checkMatcher(cond *MatcherCond, inputTags map[string]any) (ok bool) {
+	ec.volatile = true
+	fn, found := lookupMatcher(cond.Name)
+	if !found {
+		if ec.getter != nil {
+			ec.getter.cfg.reportUnknownMatcher(cond.Name)
+		}
+		return false
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("matcher panicked", "matcher", cond.Name, "panic", r)
+			ok = false
+		}
+	}()
+	return fn(cond.Arg, inputTags)
+}
+
+// UnknownMatcherCounts 返回快照规则中引用了、但当前进程未注册的匹配器及其被求值的次数。
+func (c *Config) UnknownMatcherCounts() map[string]int64 {
+	out := make(map[string]int64)
+	c.unknownMatchers.Range(func(k, v any) bool {
+		out[k.(string)] = v.(*atomic.Int64).Load()
+		return true
+	})
+	return out
+}
+
+// reportUnknownMatcher 记录一次未知匹配器，首次出现时输出警告日志。
+func (c *Config) reportUnknownMatcher(name string) {
+	v, ok := c.unknownMatchers.Load(name)
+	if !ok {
+		var loaded bool
+		v, loaded = c.unknownMatchers.LoadOrStore(name, new(atomic.Int64))
+		if !loaded {
+			slog.Warn("unknown matcher referenced by rule, treating as non-matching", "matcher", name)
+		}
+	}
+	v.(*atomic.Int64).Add(1)
+}
+
+// validateMatchers 检查规则引用的匹配器是否都在声明列表中。declared 为 nil 时不检查。
+func validateMatchers(items map[string][]Rule, declared map[string]struct{}) error {
+	if declared == nil {
+		return nil
+	}
+	for key, rules := range items {
+		for i := range rules {
+			for _, m := range rules[i].Matchers {
+				if _, ok := declared[m.Name]; !ok {
+					return fmt.Errorf("key %s rule %d: undeclared matcher %q", key, i, m.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
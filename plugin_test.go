@@ -0,0 +1,97 @@
+package bttsetting
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestMatch_CustomMatcher(t *testing.T) {
+	// 商户等级查表：arg 为最低等级
+	tiers := map[string]float64{"m1": 3, "m2": 1}
+	RegisterMatcher("test_merchant_tier", func(arg any, tags map[string]any) bool {
+		id, _ := tags["merchant"].(string)
+		min, _ := arg.(float64)
+		return tiers[id] >= min
+	})
+	RegisterMatcher("test_panic", func(arg any, tags map[string]any) bool {
+		panic("boom")
+	})
+
+	rules := []Rule{
+		{Tags: map[string]any{"env": "prod"}, ValueHash: "vip", Matchers: []MatcherCond{{Name: "test_merchant_tier", Arg: float64(2)}}},
+		{ValueHash: "panic", Matchers: []MatcherCond{{Name: "test_panic"}}},
+		{ValueHash: "unknown", Matchers: []MatcherCond{{Name: "test_not_registered"}}},
+		{ValueHash: "default"},
+	}
+	if r := Match(rules, map[string]any{"env": "prod", "merchant": "m1"}); r == nil || r.ValueHash != "vip" {
+		t.Errorf("Expected vip, got %v", r)
+	}
+	// 匹配器与普通标签组合
+	if r := Match(rules, map[string]any{"env": "dev", "merchant": "m1"}); r == nil || r.ValueHash != "default" {
+		t.Errorf("Expected default, got %v", r)
+	}
+	// 匹配器 Panic 与未注册的匹配器都视为不匹配
+	if r := Match(rules, map[string]any{"env": "prod", "merchant": "m2"}); r == nil || r.ValueHash != "default" {
+		t.Errorf("Expected default, got %v", r)
+	}
+}
+
+func TestGet_UnknownMatcherReported(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testmatcher:")
+	ctx := context.Background()
+
+	RegisterMatcher("test_ip_region", func(arg any, tags map[string]any) bool {
+		ip, _ := tags["ip"].(string)
+		return strings.HasPrefix(ip, "10.") && arg == "internal"
+	})
+
+	p := NewPublisher(rdb, 1, WithDeclaredMatchers("test_ip_region", "test_future_matcher"))
+	err := p.Publish(ctx, PublishRequest{
+		FullReplace: true,
+		Items: map[string][]RuleInput{
+			"debug": {
+				{Value: "future", Matchers: []MatcherCond{{Name: "test_future_matcher"}}},
+				{Value: "internal", Matchers: []MatcherCond{{Name: "test_ip_region", Arg: "internal"}}},
+				{Value: "public"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	cfg, _ := New(rdb, 1)
+	if v, _ := Get[string](cfg.WithTags(map[string]any{"ip": "10.0.0.1"}), "debug"); v != "internal" {
+		t.Errorf("Expected internal, got %s", v)
+	}
+	if v, _ := Get[string](cfg.WithTags(map[string]any{"ip": "8.8.8.8"}), "debug"); v != "public" {
+		t.Errorf("Expected public, got %s", v)
+	}
+	if n := cfg.UnknownMatcherCounts()["test_future_matcher"]; n != 2 {
+		t.Errorf("Expected unknown matcher reported twice, got %d", n)
+	}
+
+	// 引用未声明的匹配器被拒绝
+	err = p.Publish(ctx, PublishRequest{
+		Items: map[string][]RuleInput{
+			"debug": {{Value: 1, Matchers: []MatcherCond{{Name: "test_typo"}}}},
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "undeclared matcher") {
+		t.Errorf("Expected undeclared matcher error, got %v", err)
+	}
+
+	// 未声明列表时不校验
+	if err := NewPublisher(rdb, 1).Publish(ctx, PublishRequest{
+		Items: map[string][]RuleInput{"other": {{Value: 1, Matchers: []MatcherCond{{Name: "test_typo"}}}}},
+	}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
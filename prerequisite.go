@@ -0,0 +1,105 @@
+package bttsetting
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+)
+
+// Prerequisite 前置开关条件：同一个 Getter 下 Key 的求值结果 (bool) 等于 Want 时才匹配。
+// 前置 Key 不存在、未匹配到规则或不是 bool 时视为 false。
+type Prerequisite struct {
+	Key  string `json:"key"`  // 前置开关 Key
+	Want bool   `json:"want"` // 期望值，通常为 true
+}
+
+// maxPrereqDepth 运行时前置链的最大深度。发布时已做环检测，这里仅防御异常数据导致的无限递归。
+const maxPrereqDepth = 16
+
+// checkPrereq 在 Getter 中求值前置开关，并把前置结果的缓存依赖合并到当前求值环境。
+// 前置结果通过 get 写入 Getter 的 L1 缓存，同一请求中的开关链只会求值一次。
+func (ec *evalContext) checkPrereq(p *Prerequisite) bool {
+	g := ec.getter
+	if g == nil {
+		// Match 没有 Getter，无法求值前置开关
+		return false
+	}
+	if g.depth >= maxPrereqDepth {
+		slog.Warn("prerequisite chain too deep", "key", p.Key)
+		return false
+	}
+
+	g.depth++
+	v, err := get[bool](g, p.Key, nil)
+	g.depth--
+
+	// 前置结果依赖的人群包、时间窗口同样决定当前结果的有效期，是否可跨 Getter 复用同理
+	if entry, ok := g.entries(p.Key).evaluated(g.cfg, g.snapshot()); ok {
+		if entry.segmentGen != 0 && (ec.segmentGen == 0 || entry.segmentGen < ec.segmentGen) {
+			ec.segmentGen = entry.segmentGen
+		}
+		if entry.expiresAt != 0 && (ec.expiresAt == 0 || entry.expiresAt < ec.expiresAt) {
+			ec.expiresAt = entry.expiresAt
+		}
+		ec.volatile = ec.volatile || entry.volatile
+	}
+	if err != nil {
+		return !p.Want
+	}
+	return v == p.Want
+}
+
+// validatePrerequisites 检查前置开关依赖图中是否存在环 (如 A -> B -> A)。
+func validatePrerequisites(items map[string][]Rule) error {
+	graph := make(map[string][]string)
+	for key, rules := range items {
+		for i := range rules {
+			for _, p := range rules[i].Prerequisites {
+				if p.Key == "" {
+					return fmt.Errorf("key %s: prerequisite key is empty", key)
+				}
+				graph[key] = append(graph[key], p.Key)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int, len(graph))
+	var path []string
+	var visit func(key string) error
+	visit = func(key string) error {
+		switch state[key] {
+		case visiting:
+			return fmt.Errorf("prerequisite cycle detected: %v -> %s", path, key)
+		case done:
+			return nil
+		}
+		state[key] = visiting
+		path = append(path, key)
+		for _, dep := range graph[key] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[key] = done
+		return nil
+	}
+
+	// 按 Key 排序遍历，保证错误信息稳定
+	keys := make([]string, 0, len(graph))
+	for k := range graph {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := visit(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
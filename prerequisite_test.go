@@ -0,0 +1,128 @@
+package bttsetting
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestValidatePrerequisites(t *testing.T) {
+	ok := map[string][]Rule{
+		"a": {{Prerequisites: []Prerequisite{{Key: "b", Want: true}}}},
+		"b": {{Prerequisites: []Prerequisite{{Key: "c", Want: true}}}},
+		"c": {{}},
+		"d": {{Prerequisites: []Prerequisite{{Key: "b", Want: true}, {Key: "c", Want: true}}}},
+	}
+	if err := validatePrerequisites(ok); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	cyclic := map[string][]Rule{
+		"a": {{Prerequisites: []Prerequisite{{Key: "b", Want: true}}}},
+		"b": {{}, {Prerequisites: []Prerequisite{{Key: "c", Want: true}}}},
+		"c": {{Prerequisites: []Prerequisite{{Key: "a", Want: true}}}},
+	}
+	if err := validatePrerequisites(cyclic); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("Expected cycle error, got %v", err)
+	}
+
+	self := map[string][]Rule{"a": {{Prerequisites: []Prerequisite{{Key: "a", Want: true}}}}}
+	if err := validatePrerequisites(self); err == nil {
+		t.Error("Expected self cycle error")
+	}
+}
+
+func TestGet_Prerequisites(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testprereq:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	err := p.Publish(ctx, PublishRequest{
+		FullReplace: true,
+		Items: map[string][]RuleInput{
+			"feature_a": {
+				{Tags: map[string]any{"group": "beta"}, Value: true},
+				{Value: false},
+			},
+			"feature_b": {
+				{Value: true, Prerequisites: []Prerequisite{{Key: "feature_a", Want: true}}},
+				{Value: false},
+			},
+			"feature_c": {
+				{Value: "new", Prerequisites: []Prerequisite{{Key: "feature_b", Want: true}}},
+				{Value: "old"},
+			},
+			"legacy_only": {
+				{Value: true, Prerequisites: []Prerequisite{{Key: "feature_a", Want: false}}},
+				{Value: false},
+			},
+			"missing_dep": {
+				{Value: true, Prerequisites: []Prerequisite{{Key: "not_exist", Want: true}}},
+				{Value: false},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	cfg, _ := New(rdb, 1)
+
+	beta := cfg.WithTags(map[string]any{"group": "beta"})
+	if v, _ := Get[string](beta, "feature_c"); v != "new" {
+		t.Errorf("Expected new for beta, got %s", v)
+	}
+	// 前置链的结果已记入 L1 缓存
+	if _, ok := beta.cache["feature_a"].find(typeID[bool]()); !ok {
+		t.Error("Prerequisite result should be memoised in L1")
+	}
+	if v, _ := Get[bool](beta, "legacy_only"); v {
+		t.Error("Expected legacy_only false for beta")
+	}
+
+	other := cfg.WithTags(map[string]any{"group": "staff"})
+	if v, _ := Get[string](other, "feature_c"); v != "old" {
+		t.Errorf("Expected old for staff, got %s", v)
+	}
+	if v, _ := Get[bool](other, "legacy_only"); !v {
+		t.Error("Expected legacy_only true for staff")
+	}
+	if v, _ := Get[bool](other, "missing_dep"); v {
+		t.Error("Missing prerequisite should be treated as off")
+	}
+
+	// 发布时拒绝依赖环
+	err = p.Publish(ctx, PublishRequest{
+		Items: map[string][]RuleInput{
+			"feature_a": {{Value: true, Prerequisites: []Prerequisite{{Key: "feature_c", Want: true}}}},
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("Expected cycle error, got %v", err)
+	}
+}
+
+func TestGet_PrerequisiteRuntimeCycle(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	cfg, _ := New(rdb, 1)
+
+	// 绕过发布校验直接构造带环的快照，运行时不应无限递归
+	cfg.snapshot.Store(&Snapshot{
+		AllHash: "cyclic",
+		Rules: map[string][]Rule{
+			"a": {{ValueHash: "t", Prerequisites: []Prerequisite{{Key: "b", Want: true}}}, {ValueHash: "f"}},
+			"b": {{ValueHash: "t", Prerequisites: []Prerequisite{{Key: "a", Want: true}}}, {ValueHash: "f"}},
+		},
+		Values: map[string]string{"t": "true", "f": "false"},
+	})
+	if _, err := Get[bool](cfg.WithTags(nil), "a"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
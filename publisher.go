@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"time"
 
 	"encoding/json"
@@ -15,22 +16,45 @@ import (
 type Publisher struct {
 	rdb     *redis.Client
 	version int
+
+	// matchers 声明的自定义匹配器名称，nil 表示不校验
+	matchers map[string]struct{}
+}
+
+// PublisherOption 是 NewPublisher 的可选配置项。
+type PublisherOption func(*Publisher)
+
+// WithDeclaredMatchers 声明客户端已注册的自定义匹配器名称，
+// Publish 会拒绝引用了未声明匹配器的规则。
+func WithDeclaredMatchers(names ...string) PublisherOption {
+	return func(p *Publisher) {
+		p.matchers = make(map[string]struct{}, len(names))
+		for _, n := range names {
+			p.matchers[n] = struct{}{}
+		}
+	}
 }
 
 // NewPublisher 创建发布者。
 // client: Redis 客户端实例（外部传入，DI）。
 // version: 本次操作针对的目标版本。
-func NewPublisher(client *redis.Client, version int) *Publisher {
-	return &Publisher{
+// opts: 可选配置项。
+func NewPublisher(client *redis.Client, version int, opts ...PublisherOption) *Publisher {
+	p := &Publisher{
 		rdb:     client,
 		version: version,
 	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
 }
 
 // PublishRequest 代表发布新配置的请求。
 type PublishRequest struct {
-	// FullReplace 如果为 true，忽略当前版本已有内容，直接使用 Items 作为该版本的全部内容。
-	// 如果 Items 为空且 FullReplace 为 true，则相当于创建一个空版本。
+	// FullReplace 如果为 true，忽略当前版本已有的规则，直接使用 Items 作为该版本的全部规则。
+	// 如果 Items 为空且 FullReplace 为 true，则相当于创建一个没有规则的版本。
+	// 元数据（Hierarchies、TagDictionary、KeyMeta）不受影响，仍按各字段的规则保持或替换。
 	FullReplace bool
 
 	// Items 要更新或新增的 ConfigKey -> RuleList。
@@ -39,6 +63,22 @@ type PublishRequest struct {
 
 	// Deletes 要删除的 ConfigKey 或特定的 Tag 组合。
 	Deletes []DeleteOp
+
+	// Hierarchies 标签层级定义（标签 Key -> 层级），随快照一起发布。
+	// nil 表示保持当前版本的层级不变；非 nil 时整体替换（空 map 表示清空）。
+	Hierarchies map[string]TagHierarchy
+
+	// TagDictionary 标签字典（允许的标签 Key -> 定义），随快照一起发布。
+	// 字典非空时，所有规则的标签都必须在字典中定义且符合类型与取值约束，否则拒绝发布。
+	// nil 表示保持当前版本的字典不变；非 nil 时整体替换（空 map 表示清空）。
+	TagDictionary map[string]TagDef
+
+	// KeyMeta 配置 Key 的元数据（如静态 Key），按 Key 合并到当前版本：
+	// 只修改其中出现的 Key，零值表示清除该 Key 的元数据。
+	KeyMeta map[string]KeyMetadata
+
+	// Force 为 true 时跳过客户端类型校验：即使值无法读取为客户端上报的类型（见 Config.ReportSchemas）也发布。
+	Force bool
 }
 
 // DeleteOp 删除操作
@@ -56,10 +96,51 @@ type RuleInput struct {
 	Tags      map[string]any
 	Value     any
 	ValueType int
+	// Rollout 百分比灰度条件 (可选)。Salt 为空时沿用该 Key 下相同 Tags 的已有规则的盐值，
+	// 没有已有规则时使用配置 Key，保证调整比例时不会重新洗牌用户。
+	Rollout *Rollout
+	// Experiment 多变体实验 (可选)。设置后忽略 Value/ValueType，值由各变体提供。
+	Experiment *ExperimentInput
+	// Segment 人群包条件 (可选)，人群包成员通过 SegmentAdd / SegmentRemove 维护。
+	Segment *SegmentCond
+	// ValidFrom / ValidUntil 规则生效的时间窗口 (可选，零值表示不限制)，精度为秒。
+	ValidFrom  time.Time
+	ValidUntil time.Time
+	// Schedule 周期性生效窗口 (可选)。
+	Schedule *Schedule
+	// Prerequisites 前置开关 (可选)，发布时检测依赖环。
+	Prerequisites []Prerequisite
+	// Matchers 自定义匹配器 (可选)，可通过 WithDeclaredMatchers 在发布时校验名称。
+	Matchers []MatcherCond
 }
 
-// Publish 将新版本的配置推送到 Redis。
-func (p *Publisher) Publish(ctx context.Context, req PublishRequest) error {
+// ExperimentInput 发布实验规则时的输入。
+type ExperimentInput struct {
+	ID       string // 实验 ID
+	Tag      string // 分桶依据的输入标签
+	Salt     string // 分桶盐值，为空时使用实验 ID
+	Variants []VariantInput
+}
+
+// VariantInput 实验变体输入。
+type VariantInput struct {
+	Name      string
+	Weight    int
+	Value     any
+	ValueType int
+}
+
+// publishState 是一次发布过程中的中间状态：基础版本 + 应用变更后的规则与元数据。
+type publishState struct {
+	baseHash string            // CAS 基准 Hash
+	items    map[string][]Rule // 变更后的全部规则
+	meta     SnapshotMeta      // 变更后的快照元数据
+	values   map[string][]byte // 本次新增的值 Hash -> RawJSON
+}
+
+// loadState 读取当前版本的基础 Hash 以及规则和元数据。
+// fullReplace 为 true 时忽略当前版本已有的规则（但仍读取 baseHash 用于 CAS，元数据照常读取）。
+func (p *Publisher) loadState(ctx context.Context, fullReplace bool) (*publishState, error) {
 	// 1. 获取当前版本的基础 Hash (用于 CAS 和增量更新)
 	versionsKey := KeyVersions()
 	baseHash, err := p.rdb.HGet(ctx, versionsKey, fmt.Sprintf("%d", p.version)).Result()
@@ -68,30 +149,185 @@ func (p *Publisher) Publish(ctx context.Context, req PublishRequest) error {
 		err = nil
 	}
 	if err != nil {
-		return fmt.Errorf("get current version failed: %w", err)
+		return nil, fmt.Errorf("get current version failed: %w", err)
 	}
 
-	currentItems := make(map[string][]Rule)
+	st := &publishState{
+		baseHash: baseHash,
+		items:    make(map[string][]Rule),
+		values:   make(map[string][]byte),
+	}
+
+	if baseHash == "" {
+		return st, nil
+	}
 
-	if !req.FullReplace && baseHash != "" {
-		// 加载当前版本的规则 (仅当非 FullReplace 且存在旧版本时)
-		rulesKey := KeyRules(baseHash)
-		rawMap, err := p.rdb.HGetAll(ctx, rulesKey).Result()
+	// 加载当前版本的规则 (仅当非 FullReplace 时)
+	if !fullReplace {
+		rawMap, err := p.rdb.HGetAll(ctx, KeyRules(baseHash)).Result()
 		if err != nil && !errors.Is(err, redis.Nil) {
-			return fmt.Errorf("load current version rules failed: %w", err)
+			return nil, fmt.Errorf("load current version rules failed: %w", err)
 		}
 
 		for k, v := range rawMap {
 			var rules []Rule
 			if err := json.Unmarshal([]byte(v), &rules); err != nil {
-				return fmt.Errorf("unmarshal config item %s failed: %w", k, err)
+				return nil, fmt.Errorf("unmarshal config item %s failed: %w", k, err)
 			}
-			currentItems[k] = rules
+			st.items[k] = rules
+		}
+	}
+
+	// 加载当前版本的元数据 (FullReplace 时同样保留，见 PublishRequest 中元数据字段的 nil 语义)
+	metaJSON, err := p.rdb.Get(ctx, KeyMeta(baseHash)).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("load current version meta failed: %w", err)
+	}
+	if metaJSON != "" {
+		if err := json.Unmarshal([]byte(metaJSON), &st.meta); err != nil {
+			return nil, fmt.Errorf("unmarshal meta failed: %w", err)
+		}
+	}
+
+	return st, nil
+}
+
+// Publish 将新版本的配置推送到 Redis。
+func (p *Publisher) Publish(ctx context.Context, req PublishRequest) error {
+	st, err := p.loadState(ctx, req.FullReplace)
+	if err != nil {
+		return err
+	}
+	if err := p.apply(st, req); err != nil {
+		return err
+	}
+	if !req.Force {
+		incompatible, err := p.checkSchemas(ctx, st, req.Items)
+		if err != nil {
+			return err
+		}
+		if len(incompatible) > 0 {
+			return errors.Join(incompatible...)
 		}
 	}
+	return p.commit(ctx, st)
+}
+
+// PublishDiff 发布请求相对当前版本的差异，见 Publisher.Diff。
+type PublishDiff struct {
+	BaseHash string      `json:"baseHash"` // 当前版本的 AllHash，版本不存在时为空
+	NewHash  string      `json:"newHash"`  // 发布后的 AllHash
+	Changes  []KeyChange `json:"changes"`  // 规则有变化的 Key，按 Key 排序
+	// Warnings 需要人工确认的提示，如变更涉及静态 Key（客户端重启后才生效）
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Diff 预演发布请求，返回相对当前版本的差异，不写入 Redis。
+// 请求的校验与 Publish 相同，校验失败时返回错误。
+func (p *Publisher) Diff(ctx context.Context, req PublishRequest) (*PublishDiff, error) {
+	base, err := p.loadState(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	st, err := p.loadState(ctx, req.FullReplace)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.apply(st, req); err != nil {
+		return nil, err
+	}
+
+	d := &PublishDiff{
+		BaseHash: base.baseHash,
+		NewHash:  ComputeSnapshotHash(st.items, &st.meta),
+		Changes:  diffSnapshots(&Snapshot{Rules: base.items}, &Snapshot{Rules: st.items}),
+	}
+	for _, c := range d.Changes {
+		if base.meta.Keys[c.Key].Static || st.meta.Keys[c.Key].Static {
+			d.Warnings = append(d.Warnings, fmt.Sprintf("key %s is static: running clients apply this change after restart", c.Key))
+		}
+	}
+	for _, key := range staticFlagChanges(base.meta.Keys, st.meta.Keys) {
+		d.Warnings = append(d.Warnings, fmt.Sprintf("key %s: static flag change takes effect after client restart", key))
+	}
+
+	// 客户端通过 Register 声明为必填的 Key 不能缺失
+	registry, err := p.Registry(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var required []string
+	for key, r := range registry {
+		if _, ok := st.items[key]; r.Required && !ok {
+			required = append(required, key)
+		}
+	}
+	sort.Strings(required)
+	for _, key := range required {
+		d.Warnings = append(d.Warnings, fmt.Sprintf("key %s is required by clients but missing", key))
+	}
+
+	// 值无法读取为客户端上报的类型时，Publish 会拒绝（除非 Force）
+	incompatible, err := p.checkSchemas(ctx, st, req.Items)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range incompatible {
+		d.Warnings = append(d.Warnings, e.Error())
+	}
+	return d, nil
+}
+
+// staticFlagChanges 返回静态标记发生变化的 Key（已排序）。
+func staticFlagChanges(old, new map[string]KeyMetadata) []string {
+	changed := make(map[string]string)
+	for key, m := range old {
+		if m.Static != new[key].Static {
+			changed[key] = ""
+		}
+	}
+	for key, m := range new {
+		if m.Static != old[key].Static {
+			changed[key] = ""
+		}
+	}
+	return sortedKeys(changed)
+}
+
+// apply 将发布请求中的删除、更新和元数据变更应用到发布状态上。
+func (p *Publisher) apply(st *publishState, req PublishRequest) error {
+	currentItems := st.items
+
+	// 1.1 先应用元数据变更 (nil 表示保持不变)，后续规则按新的字典校验
+	if req.Hierarchies != nil {
+		if err := validateHierarchies(req.Hierarchies); err != nil {
+			return err
+		}
+		st.meta.Hierarchies = req.Hierarchies
+	}
+	if req.TagDictionary != nil {
+		st.meta.Dictionary = req.TagDictionary
+	}
+	for key, m := range req.KeyMeta {
+		if m == (KeyMetadata{}) {
+			delete(st.meta.Keys, key)
+			continue
+		}
+		if st.meta.Keys == nil {
+			st.meta.Keys = make(map[string]KeyMetadata)
+		}
+		st.meta.Keys[key] = m
+	}
+	dict := st.meta.Dictionary
 
 	// 2. 应用删除 (Deletes)
 	for _, del := range req.Deletes {
+		if del.Tags != nil {
+			// 删除条件同样按字典规范化，与已存储的规则标签保持一致
+			if normalized, err := normalizeRuleTags(dict, del.Tags); err == nil {
+				del.Tags = normalized
+			}
+		}
 		if del.Tags == nil {
 			// Tags 为 nil，删除整个 Key
 			delete(currentItems, del.Key)
@@ -114,47 +350,216 @@ func (p *Publisher) Publish(ctx context.Context, req PublishRequest) error {
 	}
 
 	// 3. 应用更新 (Items) - 覆盖/新增 Key 级别的规则列表
-	valueMap := make(map[string][]byte) // Hash -> RawJSON 收集新值
-
 	for key, inputs := range req.Items {
+		oldRules := currentItems[key]
 		var rules []Rule
 		for _, input := range inputs {
-			valToHash := input.Value
-
-			if input.ValueType == ValueTypeRawJSON {
-				// 如果是 Raw JSON，先反序列化为 any
-				// 支持 []byte 和 string
-				var rawBytes []byte
-				if b, ok := input.Value.([]byte); ok {
-					rawBytes = b
-				} else if s, ok := input.Value.(string); ok {
-					rawBytes = []byte(s)
-				} else {
-					return fmt.Errorf("invalid value type for RawJSON key %s: expected []byte or string", key)
-				}
-
-				if err := json.Unmarshal(rawBytes, &valToHash); err != nil {
-					return fmt.Errorf("invalid json bytes for key %s: %w", key, err)
+			var valHash string
+			var exp *Experiment
+			var err error
+			if input.Experiment != nil {
+				if exp, err = st.addExperiment(key, input.Experiment); err != nil {
+					return err
 				}
+			} else if valHash, err = st.addValue(key, input.Value, input.ValueType); err != nil {
+				return err
 			}
 
-			valHash, rawData, err := ComputeValueHash(valToHash)
+			// 已存储的规则标签已按字典规范化，沿用盐值时按规范化后的标签比较
+			tags := input.Tags
+			if normalized, err := normalizeRuleTags(dict, tags); err == nil {
+				tags = normalized
+			}
+			rollout, err := prepareRollout(key, input.Rollout, tags, oldRules)
 			if err != nil {
-				return fmt.Errorf("failed to hash value for key %s: %w", key, err)
+				return err
 			}
-			valueMap[valHash] = rawData
 
-			rules = append(rules, Rule{
-				Tags:      input.Tags,
-				ValueHash: valHash,
-			})
+			if input.Segment != nil && (input.Segment.Tag == "" || input.Segment.Name == "") {
+				return fmt.Errorf("key %s: segment tag and name are required", key)
+			}
+
+			rule := Rule{
+				Tags:       input.Tags,
+				ValueHash:  valHash,
+				Rollout:    rollout,
+				Experiment: exp,
+				Segment:    input.Segment,
+				Schedule:   input.Schedule,
+
+				Prerequisites: input.Prerequisites,
+				Matchers:      input.Matchers,
+			}
+			if err := setTimeWindow(&rule, input.ValidFrom, input.ValidUntil); err != nil {
+				return fmt.Errorf("key %s: %w", key, err)
+			}
+
+			rules = append(rules, rule)
 		}
 
 		currentItems[key] = rules
 	}
 
+	// 3.1 检测前置开关依赖环，校验自定义匹配器
+	if err := validatePrerequisites(currentItems); err != nil {
+		return err
+	}
+	if err := validateMatchers(currentItems, p.matchers); err != nil {
+		return err
+	}
+
+	// 3.2 按标签字典规范化并校验全部规则及其条件标签（字典可能在本次发布中变更，因此包括已有规则）
+	if len(dict) > 0 {
+		for key, rules := range currentItems {
+			for i := range rules {
+				tags, err := normalizeRuleTags(dict, rules[i].Tags)
+				if err != nil {
+					return fmt.Errorf("key %s rule %d: %w", key, i, err)
+				}
+				rules[i].Tags = tags
+				if err := checkConditionTags(dict, &rules[i]); err != nil {
+					return fmt.Errorf("key %s rule %d: %w", key, i, err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// prepareRollout 复制并补全灰度条件的盐值，然后校验区间。
+func prepareRollout(key string, in *Rollout, tags map[string]any, oldRules []Rule) (*Rollout, error) {
+	if in == nil {
+		return nil, nil
+	}
+	r := *in
+	if r.Salt == "" {
+		r.Salt = key
+		for _, old := range oldRules {
+			if old.Rollout != nil && old.Rollout.Tag == r.Tag && MatchTagsExact(old.Tags, tags) {
+				r.Salt = old.Rollout.Salt
+				break
+			}
+		}
+	}
+	if err := r.validate(); err != nil {
+		return nil, fmt.Errorf("key %s: %w", key, err)
+	}
+	return &r, nil
+}
+
+// setTimeWindow 设置并校验规则的时间窗口。
+func setTimeWindow(rule *Rule, from, until time.Time) error {
+	if !from.IsZero() {
+		rule.ValidFrom = from.Unix()
+	}
+	if !until.IsZero() {
+		rule.ValidUntil = until.Unix()
+	}
+	if rule.ValidFrom != 0 && rule.ValidUntil != 0 && rule.ValidFrom >= rule.ValidUntil {
+		return fmt.Errorf("valid_from must be before valid_until")
+	}
+	if rule.Schedule != nil {
+		if err := rule.Schedule.compile(); err != nil {
+			return fmt.Errorf("invalid schedule: %w", err)
+		}
+	}
+	return nil
+}
+
+// Ramp 调整指定 Key 下 Tags 完全相同的灰度规则的覆盖比例 (0-100)。
+// 仅修改区间终点，起点与盐值保持不变，因此扩量时已命中的用户保持命中，缩量时只移除区间尾部的用户。
+func (p *Publisher) Ramp(ctx context.Context, key string, tags map[string]any, percent float64) error {
+	st, err := p.loadState(ctx, false)
+	if err != nil {
+		return err
+	}
+	if normalized, err := normalizeRuleTags(st.meta.Dictionary, tags); err == nil {
+		tags = normalized
+	}
+
+	rules := st.items[key]
+	for i := range rules {
+		r := rules[i].Rollout
+		if r == nil || !MatchTagsExact(rules[i].Tags, tags) {
+			continue
+		}
+		ramped := *r
+		ramped.End = ramped.Start + percentToBuckets(percent)
+		if ramped.End > RolloutBuckets {
+			ramped.End = RolloutBuckets
+		}
+		if err := ramped.validate(); err != nil {
+			return fmt.Errorf("key %s: %w", key, err)
+		}
+		rules[i].Rollout = &ramped
+		return p.commit(ctx, st)
+	}
+	return fmt.Errorf("rollout rule not found for key %s", key)
+}
+
+// addExperiment 记录各变体的值并构建实验定义。
+func (st *publishState) addExperiment(key string, in *ExperimentInput) (*Experiment, error) {
+	exp := &Experiment{
+		ID:   in.ID,
+		Tag:  in.Tag,
+		Salt: in.Salt,
+	}
+	if exp.Salt == "" {
+		exp.Salt = in.ID
+	}
+	for _, v := range in.Variants {
+		valHash, err := st.addValue(key, v.Value, v.ValueType)
+		if err != nil {
+			return nil, err
+		}
+		exp.Variants = append(exp.Variants, Variant{
+			Name:      v.Name,
+			Weight:    v.Weight,
+			ValueHash: valHash,
+		})
+	}
+	if err := exp.validate(); err != nil {
+		return nil, fmt.Errorf("key %s: %w", key, err)
+	}
+	return exp, nil
+}
+
+// addValue 计算值的 Hash 并记录到待写入的值集合中，返回 ValueHash。
+func (st *publishState) addValue(key string, value any, valueType int) (string, error) {
+	valToHash := value
+
+	if valueType == ValueTypeRawJSON {
+		// 如果是 Raw JSON，先反序列化为 any
+		// 支持 []byte 和 string
+		var rawBytes []byte
+		if b, ok := value.([]byte); ok {
+			rawBytes = b
+		} else if s, ok := value.(string); ok {
+			rawBytes = []byte(s)
+		} else {
+			return "", fmt.Errorf("invalid value type for RawJSON key %s: expected []byte or string", key)
+		}
+
+		if err := json.Unmarshal(rawBytes, &valToHash); err != nil {
+			return "", fmt.Errorf("invalid json bytes for key %s: %w", key, err)
+		}
+	}
+
+	valHash, rawData, err := ComputeValueHash(valToHash)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash value for key %s: %w", key, err)
+	}
+	st.values[valHash] = rawData
+	return valHash, nil
+}
+
+// commit 写入规则、值与元数据，并通过 CAS 更新版本指针和发送通知。
+func (p *Publisher) commit(ctx context.Context, st *publishState) error {
+	currentItems := st.items
+
 	// 4. 计算新状态的 AllHash
-	allHash := ComputeAllHash(currentItems)
+	allHash := ComputeSnapshotHash(currentItems, &st.meta)
 
 	// 5. 存储 (分两步：1. 写入数据 2. CAS 更新版本与通知)
 
@@ -162,7 +567,7 @@ func (p *Publisher) Publish(ctx context.Context, req PublishRequest) error {
 	pipe := p.rdb.Pipeline()
 
 	// 写入 Values (NX)
-	for h, data := range valueMap {
+	for h, data := range st.values {
 		pipe.HSetNX(ctx, KeyValues(), h, data)
 	}
 
@@ -173,6 +578,12 @@ func (p *Publisher) Publish(ctx context.Context, req PublishRequest) error {
 		pipe.HSet(ctx, rulesKey, k, itemJSON)
 	}
 
+	// 写入元数据 (以 AllHash 为 Key，为空时不写)
+	if !st.meta.IsEmpty() {
+		metaJSON, _ := json.Marshal(st.meta)
+		pipe.Set(ctx, KeyMeta(allHash), metaJSON, 0)
+	}
+
 	if _, err := pipe.Exec(ctx); err != nil {
 		return fmt.Errorf("failed to save rules/values: %w", err)
 	}
@@ -242,13 +653,13 @@ func (p *Publisher) Publish(ctx context.Context, req PublishRequest) error {
 
 	argv := []any{
 		fmt.Sprintf("%d", p.version), // ARGV[1] Version
-		baseHash,                     // ARGV[2] OldHash
+		st.baseHash,                  // ARGV[2] OldHash
 		allHash,                      // ARGV[3] NewHash
 		string(histJSON),             // ARGV[4] Value
 		string(msgData),              // ARGV[5] Stream Data
 	}
 
-	_, err = p.rdb.Eval(ctx, luaScript, keys, argv...).Result()
+	_, err := p.rdb.Eval(ctx, luaScript, keys, argv...).Result()
 	if err != nil {
 		return fmt.Errorf("cas update failed: %w", err)
 	}
@@ -0,0 +1,242 @@
+package bttsetting
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrNotReady 客户端尚未就绪：还没有加载到快照，或缺少通过 Register 声明为必填的 Key。
+var ErrNotReady = errors.New("config not ready")
+
+// RegisteredKey 通过 Register 在代码中声明的配置 Key，可导出到 Redis 供发布端查看。
+type RegisteredKey struct {
+	Key         string          `json:"key"`
+	Type        string          `json:"type"`              // 读取的 Go 类型，如 "int"、"time.Duration"
+	Default     json.RawMessage `json:"default,omitempty"` // 默认值的 JSON
+	Required    bool            `json:"required,omitempty"`
+	Description string          `json:"description,omitempty"`
+
+	typ       reflect.Type
+	def       any
+	valueHash string // 默认值 JSON 的 ValueHash，按子路径读取默认值时作为 L2 缓存键
+}
+
+// RegisterOption 是 Register 的可选配置项。
+type RegisterOption func(*RegisteredKey)
+
+// Required 声明 Key 必须存在于快照中，缺失时 Status 与 WaitReady 报错。
+// Get 仍然返回注册的默认值。
+func Required() RegisterOption {
+	return func(r *RegisteredKey) {
+		r.Required = true
+	}
+}
+
+// Describe 为 Key 添加说明，随注册表一起导出。
+func Describe(desc string) RegisterOption {
+	return func(r *RegisteredKey) {
+		r.Description = desc
+	}
+}
+
+// Register 在代码中声明配置 Key 的类型、默认值与是否必填，应在进程启动时调用。
+//
+// 之后各读取接口在 Key 不存在或没有规则匹配时使用 def 而不是返回 ErrNotFound：
+// Get、GetMany、GetAll、ValueOf 与 Bind 仅当读取的类型与 T 相同时返回 def，GetPath 按 def 的 JSON 读取子路径。
+// 默认值被所有调用方共享，只读使用。重复注册同一个 Key 会覆盖，但类型必须一致。
+func Register[T any](cfg *Config, key string, def T, opts ...RegisterOption) error {
+	raw, err := json.Marshal(def)
+	if err != nil {
+		return fmt.Errorf("register %s: marshal default failed: %w", key, err)
+	}
+	typ := typeOf[T]()
+	r := &RegisteredKey{Key: key, Type: typ.String(), Default: raw, typ: typ, def: def, valueHash: CalculateHash16(raw)}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return cfg.registry.add(r)
+}
+
+// keyRegistry Config 的注册表，写时复制，读路径无锁，零值可用。
+type keyRegistry struct {
+	mu   sync.Mutex
+	keys atomic.Pointer[map[string]*RegisteredKey]
+}
+
+func (kr *keyRegistry) add(r *RegisteredKey) error {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	next := make(map[string]*RegisteredKey)
+	if cur := kr.keys.Load(); cur != nil {
+		if old, ok := (*cur)[r.Key]; ok && old.typ != r.typ {
+			return fmt.Errorf("register %s: already registered as %s, got %s", r.Key, old.typ, r.typ)
+		}
+		for k, v := range *cur {
+			next[k] = v
+		}
+	}
+	next[r.Key] = r
+	kr.keys.Store(&next)
+	return nil
+}
+
+func (kr *keyRegistry) lookup(key string) (*RegisteredKey, bool) {
+	cur := kr.keys.Load()
+	if cur == nil {
+		return nil, false
+	}
+	r, ok := (*cur)[key]
+	return r, ok
+}
+
+// all 返回全部注册项，按 Key 排序。
+func (kr *keyRegistry) all() []*RegisteredKey {
+	cur := kr.keys.Load()
+	if cur == nil {
+		return nil
+	}
+	out := make([]*RegisteredKey, 0, len(*cur))
+	for _, r := range *cur {
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+// defaultValue 返回 key 注册的默认值，所有读取接口在 Key 缺失（ErrNotFound）时都经由这里回退。
+// path 为空时仅当 T 与注册的类型相同才返回默认值本身；否则按默认值的 JSON 读取子路径（见 decodePath）。
+// 没有可用的默认值时返回 ErrNotFound。
+func defaultValue[T any](c *Config, key, path string) (T, error) {
+	var zero T
+	r, ok := c.registry.lookup(key)
+	if !ok {
+		return zero, ErrNotFound
+	}
+	if path != "" {
+		return decodePath[T](c, key, r.valueHash, string(r.Default), path)
+	}
+	if r.typ != typeOf[T]() {
+		return zero, ErrNotFound
+	}
+	return r.def.(T), nil
+}
+
+// defaultValueOf 与 defaultValue 相同（path 为空），按运行时类型 typ 查找（用于 Bind 的字段）。
+func defaultValueOf(c *Config, key string, typ reflect.Type) (reflect.Value, bool) {
+	if r, ok := c.registry.lookup(key); ok && r.typ == typ {
+		return valueOf(r.def, typ), true
+	}
+	return reflect.Value{}, false
+}
+
+// registeredKeys 返回以 prefix 开头的注册 Key（已排序），prefix 的规则同 Config.Keys。
+func (c *Config) registeredKeys(prefix string) []string {
+	prefix = strings.TrimSuffix(prefix, "*")
+	var keys []string
+	for _, r := range c.registry.all() {
+		if strings.HasPrefix(r.Key, prefix) {
+			keys = append(keys, r.Key)
+		}
+	}
+	return keys
+}
+
+// Registered 返回通过 Register 声明的全部 Key，按 Key 排序。
+func (c *Config) Registered() []RegisteredKey {
+	all := c.registry.all()
+	out := make([]RegisteredKey, len(all))
+	for i, r := range all {
+		out[i] = *r
+	}
+	return out
+}
+
+// missingRequired 返回快照中不存在的必填 Key（已排序）。
+func (c *Config) missingRequired(ss *Snapshot) []string {
+	var missing []string
+	for _, r := range c.registry.all() {
+		if _, ok := ss.Rules[r.Key]; r.Required && !ok {
+			missing = append(missing, r.Key)
+		}
+	}
+	return missing
+}
+
+// WaitReady 阻塞直到加载到快照且所有必填 Key 都存在，或 ctx 结束。
+// 快照由 Load 更新，通常需要同时运行 Watch；ctx 结束时返回的错误包含未就绪的原因。
+func (c *Config) WaitReady(ctx context.Context) error {
+	reloaded := make(chan struct{}, 1)
+	remove := c.addReloadHook(func(_, _ *Snapshot) {
+		select {
+		case reloaded <- struct{}{}:
+		default:
+		}
+	})
+	defer remove()
+
+	for {
+		err := c.Status().Err()
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", ctx.Err(), err)
+		case <-reloaded:
+		}
+	}
+}
+
+// ExportRegistry 把注册表写入 Redis (按版本号)，供发布端通过 Publisher.Registry 查看客户端期望的 Key。
+// 多个客户端导出的同名 Key 以最后一次写入为准。
+func (c *Config) ExportRegistry(ctx context.Context) error {
+	all := c.registry.all()
+	if len(all) == 0 {
+		return nil
+	}
+	fields := make([]any, 0, len(all)*2)
+	for _, r := range all {
+		data, _ := json.Marshal(r)
+		fields = append(fields, r.Key, data)
+	}
+	if err := c.rdb.HSet(ctx, KeyRegistry(c.version), fields...).Err(); err != nil {
+		return fmt.Errorf("export registry failed: %w", err)
+	}
+	return nil
+}
+
+// Registry 读取客户端导出的注册表 (Key -> 注册项)，没有导出时返回空 map。
+func (p *Publisher) Registry(ctx context.Context) (map[string]RegisteredKey, error) {
+	raw, err := p.rdb.HGetAll(ctx, KeyRegistry(p.version)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("get registry failed: %w", err)
+	}
+	out := make(map[string]RegisteredKey, len(raw))
+	for k, v := range raw {
+		var r RegisteredKey
+		if err := json.Unmarshal([]byte(v), &r); err != nil {
+			return nil, fmt.Errorf("unmarshal registry %s failed: %w", k, err)
+		}
+		out[k] = r
+	}
+	return out, nil
+}
+
+// statusErr 根据状态生成就绪错误。
+func statusErr(st *Status) error {
+	if st.AllHash == "" {
+		return fmt.Errorf("%w: version %d not loaded", ErrNotReady, st.Version)
+	}
+	if len(st.MissingRequired) > 0 {
+		return fmt.Errorf("%w: missing required keys %s", ErrNotReady, strings.Join(st.MissingRequired, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package bttsetting
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRegister(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testregistry:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	p.Publish(ctx, PublishRequest{FullReplace: true, Items: map[string][]RuleInput{
+		"timeout": {{Tags: map[string]any{"env": "prod"}, Value: 30}},
+	}})
+	cfg, _ := New(rdb, 1)
+
+	if err := Register(cfg, "timeout", 10, Describe("request timeout in seconds")); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if err := Register(cfg, "retries", 3); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if err := Register(cfg, "timeout", "10s"); err == nil {
+		t.Error("Expected error for conflicting type")
+	}
+
+	// 存在时使用配置值；未匹配或不存在时使用默认值
+	if v, _ := Get[int](cfg.WithTags(map[string]any{"env": "prod"}), "timeout"); v != 30 {
+		t.Errorf("Expected 30, got %d", v)
+	}
+	g := cfg.WithTags(nil)
+	if v, err := Get[int](g, "timeout"); err != nil || v != 10 {
+		t.Errorf("Expected default 10, got %d, %v", v, err)
+	}
+	if v, _ := Get[int](g, "retries"); v != 3 {
+		t.Errorf("Expected default 3, got %d", v)
+	}
+	_, ex, _ := GetDetailed[int](g, "retries")
+	if ex.Source != SourceDefault {
+		t.Errorf("Expected default source, got %s", ex.Source)
+	}
+	// 类型不同时不使用默认值
+	if _, err := Get[int64](g, "retries"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for other types, got %v", err)
+	}
+	if _, err := GetShared[int](cfg.WithSharedTags(nil), "retries"); err != nil {
+		t.Errorf("Expected default via SharedGetter, got %v", err)
+	}
+
+	want := []RegisteredKey{
+		{Key: "retries", Type: "int", Default: []byte("3")},
+		{Key: "timeout", Type: "int", Default: []byte("10"), Description: "request timeout in seconds"},
+	}
+	got := cfg.Registered()
+	for i := range got {
+		got[i].typ, got[i].def, got[i].valueHash = nil, nil, ""
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected registry %+v", got)
+	}
+}
+
+func TestRegister_DefaultsAllReaders(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testregistry4:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	p.Publish(ctx, PublishRequest{FullReplace: true, Items: map[string][]RuleInput{
+		"db.timeout": {{Value: 5}},
+	}})
+	cfg, _ := New(rdb, 1)
+
+	type pool struct {
+		MaxOpen int `json:"max_open"`
+	}
+	type db struct {
+		Pool pool `json:"pool"`
+	}
+	Register(cfg, "db.conn", db{Pool: pool{MaxOpen: 8}})
+	Register(cfg, "db.retries", 3)
+
+	// GetPath 按默认值的 JSON 读取子路径
+	g := cfg.WithTags(nil)
+	if v, err := GetPath[int](g, "db.conn", "pool.max_open"); err != nil || v != 8 {
+		t.Errorf("Expected default 8 from GetPath, got %d, %v", v, err)
+	}
+	if v, err := GetPath[int](cfg.WithSharedTags(nil), "db.conn", "pool.max_open"); err != nil || v != 8 {
+		t.Errorf("Expected default 8 from shared GetPath, got %d, %v", v, err)
+	}
+	if _, err := GetPath[int](g, "db.conn", "pool.missing"); !errors.Is(err, ErrPathNotFound) {
+		t.Errorf("Expected ErrPathNotFound, got %v", err)
+	}
+
+	// GetAll 包括尚未发布的注册 Key
+	got, err := GetAll[int](g, "db.")
+	if err != nil || !reflect.DeepEqual(got, map[string]int{"db.timeout": 5, "db.retries": 3}) {
+		t.Errorf("Unexpected GetAll result %v, %v", got, err)
+	}
+	got, err = GetAll[int](cfg.WithSharedTags(nil), "db.*")
+	if err != nil || !reflect.DeepEqual(got, map[string]int{"db.timeout": 5, "db.retries": 3}) {
+		t.Errorf("Unexpected shared GetAll result %v, %v", got, err)
+	}
+}
+
+func TestRegister_Required(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testregistry2:")
+	ctx := context.Background()
+
+	// 版本尚未发布
+	cfg, _ := New(rdb, 1)
+	if err := cfg.Status().Err(); !errors.Is(err, ErrNotReady) {
+		t.Errorf("Expected ErrNotReady before publish, got %v", err)
+	}
+	Register(cfg, "db.dsn", "", Required())
+	Register(cfg, "timeout", time.Second)
+
+	p := NewPublisher(rdb, 1)
+	p.Publish(ctx, PublishRequest{FullReplace: true, Items: map[string][]RuleInput{
+		"timeout": {{Value: "2s"}},
+	}})
+	cfg.Load(ctx)
+	st := cfg.Status()
+	if !reflect.DeepEqual(st.MissingRequired, []string{"db.dsn"}) || !strings.Contains(st.Err().Error(), "db.dsn") {
+		t.Errorf("Unexpected status %+v, %v", st, st.Err())
+	}
+
+	// WaitReady 超时返回原因
+	wctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	err := cfg.WaitReady(wctx)
+	cancel()
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, ErrNotReady) {
+		t.Errorf("Expected deadline and not ready, got %v", err)
+	}
+
+	// 发布端可以看到客户端导出的注册表，预演时提示缺失的必填 Key
+	if err := cfg.ExportRegistry(ctx); err != nil {
+		t.Fatalf("ExportRegistry failed: %v", err)
+	}
+	reg, err := p.Registry(ctx)
+	if err != nil || !reg["db.dsn"].Required || reg["timeout"].Type != "time.Duration" || string(reg["timeout"].Default) != "1000000000" {
+		t.Errorf("Unexpected registry %+v, %v", reg, err)
+	}
+	d, _ := p.Diff(ctx, PublishRequest{Items: map[string][]RuleInput{"timeout": {{Value: "3s"}}}})
+	if len(d.Warnings) != 1 || !strings.Contains(d.Warnings[0], "db.dsn is required") {
+		t.Errorf("Unexpected warnings %v", d.Warnings)
+	}
+
+	// 发布缺失的 Key 后 WaitReady 返回
+	done := make(chan error, 1)
+	go func() { done <- cfg.WaitReady(ctx) }()
+	p.Publish(ctx, PublishRequest{Items: map[string][]RuleInput{"db.dsn": {{Value: "mysql://a"}}}})
+	cfg.Load(ctx)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected ready, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("WaitReady did not return after reload")
+	}
+	if err := cfg.Status().Err(); err != nil {
+		t.Errorf("Expected ready status, got %v", err)
+	}
+}
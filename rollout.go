@@ -0,0 +1,71 @@
+package bttsetting
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// match 检查输入标签是否落在灰度区间内。缺少分桶标签时不匹配。
+func (r *Rollout) match(inputTags map[string]any) bool {
+	val, ok := inputTags[r.Tag]
+	if !ok {
+		return false
+	}
+	id, ok := bucketKey(val)
+	if !ok {
+		return false
+	}
+	b := RolloutBucket(r.Salt, id)
+	return b >= r.Start && b < r.End
+}
+
+// validate 校验灰度区间是否合法。
+func (r *Rollout) validate() error {
+	if r.Tag == "" {
+		return fmt.Errorf("rollout tag is empty")
+	}
+	if r.Start < 0 || r.End > RolloutBuckets || r.Start > r.End {
+		return fmt.Errorf("invalid rollout range [%d, %d)", r.Start, r.End)
+	}
+	return nil
+}
+
+// bucketKey 将分桶标签值转换为稳定的字符串表示。
+// 整数值的 float64（来自 JSON）与 int 得到相同结果，保证不同来源的 user_id 分桶一致。
+func bucketKey(v any) (string, bool) {
+	switch val := v.(type) {
+	case string:
+		return val, true
+	case int:
+		return strconv.FormatInt(int64(val), 10), true
+	case int64:
+		return strconv.FormatInt(val, 10), true
+	case int32:
+		return strconv.FormatInt(int64(val), 10), true
+	case uint64:
+		return strconv.FormatUint(val, 10), true
+	case uint32:
+		return strconv.FormatUint(uint64(val), 10), true
+	case uint:
+		return strconv.FormatUint(uint64(val), 10), true
+	case float64:
+		if val == math.Trunc(val) && math.Abs(val) < 1<<53 {
+			return strconv.FormatInt(int64(val), 10), true
+		}
+		return strconv.FormatFloat(val, 'g', -1, 64), true
+	}
+	return "", false
+}
+
+// percentToBuckets 将百分比 (0-100) 转换为桶数量。
+func percentToBuckets(percent float64) int {
+	n := int(math.Round(percent * RolloutBuckets / 100))
+	if n < 0 {
+		return 0
+	}
+	if n > RolloutBuckets {
+		return RolloutBuckets
+	}
+	return n
+}
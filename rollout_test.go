@@ -0,0 +1,150 @@
+package bttsetting
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRolloutBucket_Stable(t *testing.T) {
+	// 分桶结果必须跨进程稳定，这里固定几个已知结果防止算法被无意修改
+	if b := RolloutBucket("new_checkout", "10001"); b != 9492 {
+		t.Errorf("Expected bucket 9492, got %d", b)
+	}
+	if b := RolloutBucket("", "u1"); b != 9403 {
+		t.Errorf("Expected bucket 9403, got %d", b)
+	}
+	if RolloutBucket("a", "bc") == RolloutBucket("ab", "c") && RolloutBucket("x", "yz") == RolloutBucket("xy", "z") {
+		t.Error("Salt and value should be separated")
+	}
+
+	// int 与来自 JSON 的 float64 得到相同的分桶 Key
+	k1, _ := bucketKey(12345)
+	k2, _ := bucketKey(float64(12345))
+	if k1 != k2 {
+		t.Errorf("bucketKey mismatch: %s != %s", k1, k2)
+	}
+}
+
+func TestRollout_Distribution(t *testing.T) {
+	r := RolloutPercent("user_id", 10)
+	r.Salt = "k"
+	hit := 0
+	const n = 20000
+	for i := 0; i < n; i++ {
+		if r.match(map[string]any{"user_id": i}) {
+			hit++
+		}
+	}
+	ratio := float64(hit) / n
+	if ratio < 0.08 || ratio > 0.12 {
+		t.Errorf("Expected about 10%%, got %.2f%%", ratio*100)
+	}
+}
+
+func TestMatch_Rollout(t *testing.T) {
+	rules := []Rule{
+		{Tags: map[string]any{"env": "prod"}, ValueHash: "on", Rollout: &Rollout{Tag: "user_id", Salt: "k", End: RolloutBuckets}},
+		{Tags: map[string]any{}, ValueHash: "off"},
+	}
+	// 100% 灰度，但仍需满足普通标签
+	if r := Match(rules, map[string]any{"env": "prod", "user_id": "u1"}); r == nil || r.ValueHash != "on" {
+		t.Errorf("Expected on, got %v", r)
+	}
+	if r := Match(rules, map[string]any{"env": "dev", "user_id": "u1"}); r == nil || r.ValueHash != "off" {
+		t.Errorf("Expected off, got %v", r)
+	}
+	// 缺少分桶标签时不匹配
+	if r := Match(rules, map[string]any{"env": "prod"}); r == nil || r.ValueHash != "off" {
+		t.Errorf("Expected off without user_id, got %v", r)
+	}
+	// 0% 灰度
+	rules[0].Rollout.End = 0
+	if r := Match(rules, map[string]any{"env": "prod", "user_id": "u1"}); r == nil || r.ValueHash != "off" {
+		t.Errorf("Expected off at 0%%, got %v", r)
+	}
+}
+
+func TestPublisher_Ramp(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testramp:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	err := p.Publish(ctx, PublishRequest{
+		FullReplace: true,
+		Items: map[string][]RuleInput{
+			"new_checkout": {
+				{Tags: map[string]any{"env": "prod"}, Value: true, Rollout: RolloutPercent("user_id", 1)},
+				{Value: false},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	cfg, _ := New(rdb, 1)
+	enabled := func() map[string]bool {
+		out := make(map[string]bool)
+		for i := 0; i < 5000; i++ {
+			uid := fmt.Sprintf("u%d", i)
+			v, _ := Get[bool](cfg.WithTags(map[string]any{"env": "prod", "user_id": uid}), "new_checkout")
+			if v {
+				out[uid] = true
+			}
+		}
+		return out
+	}
+	before := enabled()
+	if len(before) == 0 || len(before) > 150 {
+		t.Fatalf("Expected about 1%% enabled, got %d", len(before))
+	}
+
+	// 扩量到 50%，已命中的用户保持命中
+	if err := p.Ramp(ctx, "new_checkout", map[string]any{"env": "prod"}, 50); err != nil {
+		t.Fatalf("Ramp failed: %v", err)
+	}
+	cfg.Load(ctx)
+	after := enabled()
+	if len(after) < 2000 || len(after) > 3000 {
+		t.Errorf("Expected about 50%% enabled, got %d", len(after))
+	}
+	for uid := range before {
+		if !after[uid] {
+			t.Fatalf("User %s was reshuffled out after ramp", uid)
+		}
+	}
+
+	// 重新发布不指定 Salt 时沿用已有盐值
+	err = p.Publish(ctx, PublishRequest{
+		Items: map[string][]RuleInput{
+			"new_checkout": {
+				{Tags: map[string]any{"env": "prod"}, Value: true, Rollout: RolloutPercent("user_id", 50)},
+				{Value: false},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	cfg.Load(ctx)
+	again := enabled()
+	if len(again) != len(after) {
+		t.Errorf("Republish should keep salt, got %d vs %d", len(again), len(after))
+	}
+
+	if err := p.Ramp(ctx, "missing", nil, 10); err == nil {
+		t.Error("Expected error for missing rollout rule")
+	}
+	if err := p.Publish(ctx, PublishRequest{
+		Items: map[string][]RuleInput{"bad": {{Value: 1, Rollout: &Rollout{Tag: "user_id", Start: 10, End: 5}}}},
+	}); err == nil {
+		t.Error("Expected invalid range error")
+	}
+}
@@ -0,0 +1,471 @@
+package bttsetting
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrIncompatibleValue 发布的值无法读取为客户端上报的类型，见 Publisher.Publish。
+var ErrIncompatibleValue = errors.New("value incompatible with client type")
+
+// Schema 由 Go 类型推导出的值结构描述（JSON Schema 的子集）。
+// Type 为空表示任意 JSON 值；JSON null 总是兼容（与 encoding/json 一致，保持零值）。
+type Schema struct {
+	Type string `json:"type,omitempty"` // boolean、integer、number、string、array、object
+	// Format 由内置解码器读取的类型：duration、date-time、byte-size、ip、uri、regex。
+	// 解码器只作用于读取的目标类型本身，结构体字段等内部类型按 encoding/json 的规则描述（如 time.Duration 为整数）
+	Format  string   `json:"format,omitempty"`
+	Minimum *float64 `json:"minimum,omitempty"` // 数值类型的取值范围
+	Maximum *float64 `json:"maximum,omitempty"`
+	// Properties 结构体的字段（按 JSON 字段名，匹配时不区分大小写），值中缺少或多出的字段都兼容
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	// AdditionalProperties map 的值类型
+	AdditionalProperties *Schema `json:"additionalProperties,omitempty"`
+	Items                *Schema `json:"items,omitempty"` // 数组、切片的元素类型
+}
+
+// TypeSchema 客户端读取某个 Key 时使用的 Go 类型及其结构描述。
+type TypeSchema struct {
+	Key        string  `json:"key"`
+	Path       string  `json:"path,omitempty"` // GetPath 读取的子路径，为空表示整个值
+	GoType     string  `json:"goType"`
+	Schema     *Schema `json:"schema"`
+	ReportedAt int64   `json:"reportedAt"` // Unix 秒
+}
+
+// WithTypeRecording 记录读取每个 Key 时使用的类型，与 Register 声明的类型一起通过 ReportSchemas 上报。
+// Get 与 ValueOf 在 L1 未命中时记录，Bind 在绑定每个字段时记录，GetPath 按 (Key, 路径, 类型) 记录。
+func WithTypeRecording() Option {
+	return func(c *Config) {
+		c.recordTypes = true
+	}
+}
+
+// readType 记录的 (Key, 子路径, 类型)。
+type readType struct {
+	key  string
+	path string
+	typ  reflect.Type
+}
+
+// recordType 记录读取 key（或其子路径）时使用的类型。
+func (c *Config) recordType(key, path string, typ reflect.Type) {
+	rt := readType{key, path, typ}
+	if _, ok := c.readTypes.Load(rt); !ok {
+		c.readTypes.Store(rt, struct{}{})
+	}
+}
+
+// ReportSchemas 把 Register 声明与 Get 记录（见 WithTypeRecording）的类型推导为 Schema，
+// 按客户端的版本号写入 Redis。发布到该版本时，Publish 会拒绝无法读取为这些类型的值。
+// 同一个 Key 的不同类型分别记录；不再使用的类型需要由运维在 Redis 中清理。
+func (c *Config) ReportSchemas(ctx context.Context) error {
+	types := make(map[readType]struct{})
+	for _, r := range c.registry.all() {
+		types[readType{key: r.Key, typ: r.typ}] = struct{}{}
+	}
+	c.readTypes.Range(func(k, _ any) bool {
+		types[k.(readType)] = struct{}{}
+		return true
+	})
+	if len(types) == 0 {
+		return nil
+	}
+
+	now := time.Now().Unix()
+	fields := make([]any, 0, len(types)*2)
+	for rt := range types {
+		ts := TypeSchema{Key: rt.key, Path: rt.path, GoType: rt.typ.String(), Schema: deriveSchema(rt.typ), ReportedAt: now}
+		data, err := json.Marshal(ts)
+		if err != nil {
+			return fmt.Errorf("marshal schema %s failed: %w", rt.key, err)
+		}
+		fields = append(fields, schemaField(&ts), data)
+	}
+	if err := c.rdb.HSet(ctx, KeySchemas(c.version), fields...).Err(); err != nil {
+		return fmt.Errorf("report schemas failed: %w", err)
+	}
+	return nil
+}
+
+// schemaField Schema Hash 的字段名：同一个 Key 的不同路径、类型分别存储。
+func schemaField(ts *TypeSchema) string {
+	if ts.Path == "" {
+		return ts.Key + "|" + ts.GoType
+	}
+	return ts.Key + "|" + ts.Path + "|" + ts.GoType
+}
+
+// Schemas 读取客户端上报的类型 (Key -> 按路径、GoType 排序的类型列表)，没有上报时返回空 map。
+func (p *Publisher) Schemas(ctx context.Context) (map[string][]TypeSchema, error) {
+	raw, err := p.rdb.HGetAll(ctx, KeySchemas(p.version)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("get schemas failed: %w", err)
+	}
+	out := make(map[string][]TypeSchema)
+	for field, v := range raw {
+		var ts TypeSchema
+		if err := json.Unmarshal([]byte(v), &ts); err != nil {
+			return nil, fmt.Errorf("unmarshal schema %s failed: %w", field, err)
+		}
+		out[ts.Key] = append(out[ts.Key], ts)
+	}
+	for _, list := range out {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Path != list[j].Path {
+				return list[i].Path < list[j].Path
+			}
+			return list[i].GoType < list[j].GoType
+		})
+	}
+	return out, nil
+}
+
+// IncompatibleValueError 发布的值无法读取为客户端上报的类型。errors.Is(err, ErrIncompatibleValue) 为 true。
+type IncompatibleValueError struct {
+	Key    string
+	GoType string
+	Path   string // 值中不兼容的位置，如 "pool.max_open"，整个值为空
+	Err    error
+}
+
+func (e *IncompatibleValueError) Error() string {
+	msg := fmt.Sprintf("key %s: value incompatible with client type %s", e.Key, e.GoType)
+	if e.Path != "" {
+		msg += " at " + e.Path
+	}
+	return msg + ": " + e.Err.Error()
+}
+
+func (e *IncompatibleValueError) Is(target error) bool {
+	return target == ErrIncompatibleValue
+}
+
+func (e *IncompatibleValueError) Unwrap() error {
+	return e.Err
+}
+
+// checkSchemas 校验本次发布的 Key 的值是否兼容客户端上报的类型，返回所有不兼容的值。
+func (p *Publisher) checkSchemas(ctx context.Context, st *publishState, keys map[string][]RuleInput) ([]error, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	schemas, err := p.Schemas(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(keys))
+	for key := range keys {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, key := range names {
+		types := schemas[key]
+		if len(types) == 0 {
+			continue
+		}
+		seen := make(map[string]bool)
+		for i := range st.items[key] {
+			st.items[key][i].valueHashes(func(h string) {
+				raw, ok := st.values[h]
+				if !ok || seen[h] {
+					return
+				}
+				seen[h] = true
+				for _, ts := range types {
+					if path, err := ts.validate(raw); err != nil {
+						errs = append(errs, &IncompatibleValueError{Key: key, GoType: ts.GoType, Path: path, Err: err})
+					}
+				}
+			})
+		}
+	}
+	return errs, nil
+}
+
+// validate 校验值（或 Path 指向的子树）能否读取为上报的类型，值中没有 Path 时视为兼容。
+func (ts *TypeSchema) validate(raw []byte) (string, error) {
+	if ts.Path == "" {
+		return ts.Schema.validate(raw, "")
+	}
+	tokens, err := parsePath(ts.Path)
+	if err != nil {
+		return ts.Path, err
+	}
+	sub, err := extractPath(raw, tokens)
+	if errors.Is(err, ErrPathNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return ts.Path, err
+	}
+	path, err := ts.Schema.validate(sub, "")
+	return joinField(ts.Path, path), err
+}
+
+// deriveSchema 推导 Go 类型读取时接受的 JSON 结构，规则与 unmarshalValue 一致。
+func deriveSchema(typ reflect.Type) *Schema {
+	return schemaOf(typ, true, make(map[reflect.Type]bool))
+}
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	jsonNumberType      = reflect.TypeOf(json.Number(""))
+)
+
+// formatTypes Format 对应的内置解码器类型，校验时使用该类型的解码器。
+var formatTypes = map[string]reflect.Type{
+	"duration":  typeOf[time.Duration](),
+	"date-time": typeOf[time.Time](),
+	"byte-size": typeOf[ByteSize](),
+	"ip":        typeOf[net.IP](),
+	"uri":       typeOf[*url.URL](),
+	"regex":     typeOf[*regexp.Regexp](),
+}
+
+// schemaOf 推导 typ 的 Schema。top 为 true 表示读取的目标类型本身，按 unmarshalValue 的规则
+// （解码器、数值转换）；否则为结构体字段、元素等内部类型，按 encoding/json 的规则（解码器不生效）。
+func schemaOf(typ reflect.Type, top bool, visiting map[reflect.Type]bool) *Schema {
+	if top {
+		for format, ft := range formatTypes {
+			if ft == typ {
+				return &Schema{Format: format}
+			}
+		}
+		// 自定义解码器：无法得知接受的结构
+		if _, ok := lookupDecoder(typ); ok {
+			return &Schema{}
+		}
+	}
+	if typ == jsonNumberType {
+		return &Schema{Type: "number"}
+	}
+	if reflect.PointerTo(typ).Implements(unmarshalerType) {
+		// 自定义反序列化方法：无法得知接受的结构
+		return &Schema{}
+	}
+	if reflect.PointerTo(typ).Implements(textUnmarshalerType) && !(top && isNumberKind(typ)) {
+		// encoding/json 只把 JSON 字符串交给 UnmarshalText
+		return &Schema{Type: "string"}
+	}
+
+	switch typ.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		bits := typ.Bits()
+		return &Schema{Type: "integer", Minimum: floatPtr(float64(int64(-1) << (bits - 1))), Maximum: floatPtr(float64(int64(1)<<(bits-1) - 1))}
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Minimum: floatPtr(0), Maximum: floatPtr(float64(uint64(1)<<typ.Bits() - 1))}
+	case reflect.Int, reflect.Int64:
+		// 取值范围在校验时按 int64 精确判断
+		return &Schema{Type: "integer"}
+	case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		return &Schema{Type: "integer", Minimum: floatPtr(0)}
+	case reflect.Float32:
+		return &Schema{Type: "number", Minimum: floatPtr(-math.MaxFloat32), Maximum: floatPtr(math.MaxFloat32)}
+	case reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Pointer:
+		return schemaOf(typ.Elem(), top, visiting)
+	case reflect.Slice, reflect.Array:
+		if typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8 {
+			// []byte 按 base64 字符串编码
+			return &Schema{Type: "string"}
+		}
+		return &Schema{Type: "array", Items: schemaOf(typ.Elem(), false, visiting)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: schemaOf(typ.Elem(), false, visiting)}
+	case reflect.Struct:
+		if visiting[typ] {
+			// 递归类型，内层不再展开
+			return &Schema{Type: "object"}
+		}
+		visiting[typ] = true
+		defer delete(visiting, typ)
+		s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+		structProperties(typ, s.Properties, visiting)
+		return s
+	}
+	// interface 等：任意值
+	return &Schema{}
+}
+
+// structProperties 按 encoding/json 的规则收集结构体字段，匿名结构体字段展开。
+func structProperties(typ reflect.Type, props map[string]*Schema, visiting map[reflect.Type]bool) {
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		ft := sf.Type
+		if sf.Anonymous && name == "" {
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				structProperties(ft, props, visiting)
+				continue
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		if _, exists := props[name]; exists {
+			// 外层字段优先
+			continue
+		}
+		if strings.Contains(opts, "string") {
+			// ,string 选项：值以字符串编码
+			props[name] = &Schema{Type: "string"}
+			continue
+		}
+		props[name] = schemaOf(ft, false, visiting)
+	}
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+// validate 校验 JSON 值是否符合 Schema，失败时返回不兼容的位置与原因。
+// path 为空表示读取的目标类型本身（见 schemaOf），数值按 unmarshalValue 的规则转换，如 42.0 可以读取为整数；
+// 内部的数值按 encoding/json 的规则，整数必须是整数字面量。
+func (s *Schema) validate(raw []byte, path string) (string, error) {
+	raw = bytes.TrimSpace(raw)
+	if s == nil || string(raw) == "null" {
+		return "", nil
+	}
+	if s.Format != "" {
+		if typ, ok := formatTypes[s.Format]; ok {
+			if err := unmarshalValue(string(raw), reflect.New(typ).Interface(), typ); err != nil {
+				return path, err
+			}
+		}
+		return "", nil
+	}
+
+	mismatch := func() (string, error) {
+		return path, fmt.Errorf("expected %s, got %s", s.Type, rawKind(raw))
+	}
+	switch s.Type {
+	case "":
+		return "", nil
+	case "boolean":
+		if string(raw) != "true" && string(raw) != "false" {
+			return mismatch()
+		}
+	case "string":
+		if len(raw) == 0 || raw[0] != '"' {
+			return mismatch()
+		}
+	case "integer", "number":
+		if !strings.HasPrefix(rawKind(raw), "number") {
+			return mismatch()
+		}
+		if err := s.checkNumber(string(raw), path != ""); err != nil {
+			return path, err
+		}
+	case "array":
+		var items []json.RawMessage
+		if len(raw) == 0 || raw[0] != '[' || json.Unmarshal(raw, &items) != nil {
+			return mismatch()
+		}
+		for i, item := range items {
+			if p, err := s.Items.validate(item, joinPath(path, strconv.Itoa(i))); err != nil {
+				return p, err
+			}
+		}
+	case "object":
+		var members map[string]json.RawMessage
+		if len(raw) == 0 || raw[0] != '{' || json.Unmarshal(raw, &members) != nil {
+			return mismatch()
+		}
+		names := make([]string, 0, len(members))
+		for name := range members {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			sub := s.AdditionalProperties
+			if s.Properties != nil {
+				sub = s.property(name)
+			}
+			if p, err := sub.validate(members[name], joinPath(path, name)); err != nil {
+				return p, err
+			}
+		}
+	}
+	return "", nil
+}
+
+// property 按 encoding/json 的规则查找字段：优先精确匹配，其次不区分大小写。
+func (s *Schema) property(name string) *Schema {
+	if p, ok := s.Properties[name]; ok {
+		return p
+	}
+	for k, p := range s.Properties {
+		if strings.EqualFold(k, name) {
+			return p
+		}
+	}
+	return nil
+}
+
+// checkNumber 检查数字能否被精确表示并在取值范围内，strict 为 true 时整数必须是整数字面量。
+func (s *Schema) checkNumber(n string, strict bool) error {
+	if s.Type == "integer" {
+		unsigned := s.Minimum != nil && *s.Minimum == 0
+		var err error
+		switch {
+		case strict && unsigned:
+			_, err = strconv.ParseUint(n, 10, 64)
+		case strict:
+			_, err = strconv.ParseInt(n, 10, 64)
+		case unsigned:
+			err = setNumber(reflect.New(typeOf[uint64]()).Elem(), json.Number(n))
+		default:
+			err = setNumber(reflect.New(typeOf[int64]()).Elem(), json.Number(n))
+		}
+		if err != nil {
+			return fmt.Errorf("number %s: not an integer in range", n)
+		}
+	}
+	f, err := strconv.ParseFloat(n, 64)
+	if err != nil {
+		return fmt.Errorf("number %s: %w", n, err)
+	}
+	if (s.Minimum != nil && f < *s.Minimum) || (s.Maximum != nil && f > *s.Maximum) {
+		return fmt.Errorf("number %s out of range", n)
+	}
+	return nil
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,314 @@
+package bttsetting
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+type schemaPool struct {
+	MaxOpen int8          `json:"max_open"`
+	Idle    time.Duration `json:"idle"`
+}
+
+type schemaBase struct {
+	Name string `json:"name"`
+}
+
+type schemaConfig struct {
+	schemaBase
+	Pool    schemaPool       `json:"pool"`
+	Hosts   []string         `json:"hosts"`
+	Weights map[string]uint8 `json:"weights"`
+	Port    int64            `json:"port,string"`
+	Extra   any              `json:"extra"`
+	Skip    chan int         `json:"-"`
+	Next    *schemaConfig    `json:"next"`
+	secret  string
+}
+
+func TestSchema_Validate(t *testing.T) {
+	s := deriveSchema(typeOf[schemaConfig]())
+	if _, ok := s.Properties["secret"]; ok {
+		t.Error("Unexported field should be skipped")
+	}
+	if _, ok := s.Properties["Skip"]; ok {
+		t.Error(`Field tagged "-" should be skipped`)
+	}
+	if s.Properties["name"] == nil {
+		t.Error("Embedded struct fields should be flattened")
+	}
+
+	tests := []struct {
+		raw     string
+		wantErr bool
+		path    string // 不兼容的位置
+	}{
+		{`{"name":"a","pool":{"max_open":10,"idle":5000000000},"hosts":["h1"],"weights":{"a":1}}`, false, ""},
+		{`{"POOL":{"Max_Open":127}}`, false, ""},      // 字段名不区分大小写
+		{`{"unknown":1,"extra":[1,"x"]}`, false, ""},  // 多出的字段与任意类型
+		{`{"pool":null,"hosts":null}`, false, ""},     // null 保持零值
+		{`{"port":"8080"}`, false, ""},                // ,string
+		{`{"next":{"next":{"name":"x"}}}`, false, ""}, // 递归类型
+		{`{"name":1}`, true, "name"},
+		{`{"pool":{"max_open":128}}`, true, "pool.max_open"}, // 超出 int8
+		{`{"pool":{"max_open":1.5}}`, true, "pool.max_open"},
+		{`{"pool":{"max_open":10.0}}`, true, "pool.max_open"}, // 字段按 encoding/json 读取，不做数值转换
+		{`{"pool":{"idle":"5s"}}`, true, "pool.idle"},         // 解码器不作用于字段
+		{`{"hosts":["h1",2]}`, true, "hosts.1"},
+		{`{"weights":{"a":-1}}`, true, "weights.a"},
+		{`{"port":8080}`, true, "port"},
+		{`[1]`, true, ""},
+	}
+	for _, tt := range tests {
+		path, err := s.validate([]byte(tt.raw), "")
+		if (err != nil) != tt.wantErr || path != tt.path {
+			t.Errorf("%s: got path %q, err %v; want path %q", tt.raw, path, err, tt.path)
+		}
+	}
+
+	// 读取的目标类型本身按 unmarshalValue 的规则：解码器与数值转换
+	if _, err := deriveSchema(typeOf[int8]()).validate([]byte("10.0"), ""); err != nil {
+		t.Errorf("Unexpected int8 error: %v", err)
+	}
+	if _, err := deriveSchema(typeOf[time.Duration]()).validate([]byte(`"5s"`), ""); err != nil {
+		t.Errorf("Unexpected duration error: %v", err)
+	}
+	if _, err := deriveSchema(typeOf[[]time.Duration]()).validate([]byte(`["5s"]`), ""); err == nil {
+		t.Error("Expected error for duration string in slice")
+	}
+
+	// 整数取值范围按 int64 / uint64 精确判断
+	if _, err := deriveSchema(typeOf[int]()).validate([]byte("9223372036854775808"), ""); err == nil {
+		t.Error("Expected int overflow error")
+	}
+	if _, err := deriveSchema(typeOf[uint64]()).validate([]byte("18446744073709551615"), ""); err != nil {
+		t.Errorf("Unexpected uint64 error: %v", err)
+	}
+	if _, err := deriveSchema(typeOf[float64]()).validate([]byte("1e300"), ""); err != nil {
+		t.Errorf("Unexpected float64 error: %v", err)
+	}
+	if _, err := deriveSchema(typeOf[float32]()).validate([]byte("1e300"), ""); err == nil {
+		t.Error("Expected float32 overflow error")
+	}
+	if _, err := deriveSchema(typeOf[[]byte]()).validate([]byte(`"aGk="`), ""); err != nil {
+		t.Errorf("Unexpected []byte error: %v", err)
+	}
+}
+
+func TestReportSchemas(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testschema:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	if err := p.Publish(ctx, PublishRequest{FullReplace: true, Items: map[string][]RuleInput{
+		"limit": {{Value: 10}},
+		"pool":  {{Value: map[string]any{"max_open": 10, "idle": 5 * time.Second}}},
+	}}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	cfg, _ := New(rdb, 1, WithTypeRecording())
+	Register(cfg, "timeout", 3*time.Second)
+	g := cfg.WithTags(nil)
+	Get[int](g, "limit")
+	Get[int](g, "limit")
+	Get[schemaPool](g, "pool")
+	Get[int](cfg.WithTags(nil), "missing")
+	if err := cfg.ReportSchemas(ctx); err != nil {
+		t.Fatalf("ReportSchemas failed: %v", err)
+	}
+
+	schemas, err := p.Schemas(ctx)
+	if err != nil {
+		t.Fatalf("Schemas failed: %v", err)
+	}
+	if len(schemas) != 4 {
+		t.Errorf("Expected 4 keys, got %v", schemas)
+	}
+	if ts := schemas["limit"]; len(ts) != 1 || ts[0].GoType != "int" || ts[0].Schema.Type != "integer" || ts[0].ReportedAt == 0 {
+		t.Errorf("Unexpected limit schema %+v", ts)
+	}
+	if ts := schemas["timeout"]; len(ts) != 1 || ts[0].Schema.Format != "duration" {
+		t.Errorf("Unexpected timeout schema %+v", ts)
+	}
+
+	// 不记录类型时只上报注册的 Key
+	SetPrefix("testschema2:")
+	plain, _ := New(rdb, 1)
+	Get[int](plain.WithTags(nil), "limit")
+	if err := plain.ReportSchemas(ctx); err != nil {
+		t.Fatalf("ReportSchemas failed: %v", err)
+	}
+	if mr.Exists(KeySchemas(1)) {
+		t.Error("Expected no schemas without recording or registry")
+	}
+}
+
+func TestPublish_IncompatibleValue(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testschema3:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	p.Publish(ctx, PublishRequest{FullReplace: true, Items: map[string][]RuleInput{
+		"limit": {{Value: 10}},
+	}})
+	cfg, _ := New(rdb, 1)
+	Register(cfg, "limit", 5)
+	Register(cfg, "pool", schemaPool{})
+	if err := cfg.ReportSchemas(ctx); err != nil {
+		t.Fatalf("ReportSchemas failed: %v", err)
+	}
+
+	bad := PublishRequest{Items: map[string][]RuleInput{
+		"limit": {
+			{Tags: map[string]any{"env": "prod"}, Value: 20},
+			{Value: "20"},
+		},
+		"pool": {{Experiment: &ExperimentInput{ID: "exp", Tag: "uid", Variants: []VariantInput{
+			{Name: "a", Weight: 50, Value: map[string]any{"max_open": 10}},
+			{Name: "b", Weight: 50, Value: map[string]any{"max_open": 1000}},
+		}}}},
+		"other": {{Value: "x"}},
+	}}
+	err := p.Publish(ctx, bad)
+	if !errors.Is(err, ErrIncompatibleValue) {
+		t.Fatalf("Expected ErrIncompatibleValue, got %v", err)
+	}
+	var ie *IncompatibleValueError
+	if !errors.As(err, &ie) || ie.Key != "limit" || ie.GoType != "int" {
+		t.Errorf("Unexpected error %#v", ie)
+	}
+	if !strings.Contains(err.Error(), "key pool: value incompatible with client type bttsetting.schemaPool at max_open") {
+		t.Errorf("Expected pool violation in %v", err)
+	}
+	if v, _ := NewPublisher(rdb, 1).Schemas(ctx); len(v) != 2 {
+		t.Errorf("Expected 2 reported keys, got %d", len(v))
+	}
+	cfg.Load(ctx)
+	if _, err := Get[string](cfg.WithTags(nil), "other"); !errors.Is(err, ErrNotFound) {
+		t.Error("Rejected publish should not be written")
+	}
+
+	// Diff 以提示的形式列出不兼容的值
+	d, err := p.Diff(ctx, bad)
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	if len(d.Warnings) != 2 {
+		t.Errorf("Expected 2 warnings, got %v", d.Warnings)
+	}
+
+	// Force 跳过校验
+	bad.Force = true
+	if err := p.Publish(ctx, bad); err != nil {
+		t.Fatalf("Forced publish failed: %v", err)
+	}
+	cfg.Load(ctx)
+	if v, _ := Get[string](cfg.WithTags(nil), "other"); v != "x" {
+		t.Errorf("Expected forced publish to be written, got %q", v)
+	}
+
+	// 其他版本不受影响
+	if err := NewPublisher(rdb, 2).Publish(ctx, PublishRequest{Items: map[string][]RuleInput{
+		"limit": {{Value: "20"}},
+	}}); err != nil {
+		t.Errorf("Unexpected error for version without schemas: %v", err)
+	}
+}
+
+func TestPublish_NestedStruct(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testschema4:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	cfg, _ := New(rdb, 1)
+	Register(cfg, "pool", schemaPool{})
+	cfg.ReportSchemas(ctx)
+
+	// 字段中的 time.Duration 按 encoding/json 读取，字符串会导致客户端读取失败
+	err := p.Publish(ctx, PublishRequest{Items: map[string][]RuleInput{
+		"pool": {{Value: map[string]any{"max_open": 10, "idle": "1s"}}},
+	}})
+	if !errors.Is(err, ErrIncompatibleValue) {
+		t.Fatalf("Expected ErrIncompatibleValue, got %v", err)
+	}
+
+	if err := p.Publish(ctx, PublishRequest{Items: map[string][]RuleInput{
+		"pool": {{Value: map[string]any{"max_open": 10, "idle": time.Second}}},
+	}}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	cfg.Load(ctx)
+	v, err := Get[schemaPool](cfg.WithTags(nil), "pool")
+	if err != nil || v != (schemaPool{MaxOpen: 10, Idle: time.Second}) {
+		t.Errorf("Unexpected value %+v, %v", v, err)
+	}
+}
+
+func TestTypeRecording_BindAndPath(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testschema5:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	p.Publish(ctx, PublishRequest{Items: map[string][]RuleInput{
+		"db":      {{Value: map[string]any{"pool": map[string]any{"max_open": 10}}}},
+		"timeout": {{Value: "3s"}},
+	}})
+	cfg, _ := New(rdb, 1, WithTypeRecording())
+	cfg.Load(ctx)
+
+	type settings struct {
+		Timeout time.Duration `setting:"timeout"`
+	}
+	b, err := Bind[settings](cfg, nil)
+	if err != nil {
+		t.Fatalf("Bind failed: %v", err)
+	}
+	defer b.Close()
+	if _, err := GetPath[int8](cfg.WithSharedTags(nil), "db", "pool.max_open"); err != nil {
+		t.Fatalf("GetPath failed: %v", err)
+	}
+	if err := cfg.ReportSchemas(ctx); err != nil {
+		t.Fatalf("ReportSchemas failed: %v", err)
+	}
+
+	schemas, _ := p.Schemas(ctx)
+	if ts := schemas["timeout"]; len(ts) != 1 || ts[0].GoType != "time.Duration" {
+		t.Errorf("Expected bound field type to be reported, got %+v", ts)
+	}
+	if ts := schemas["db"]; len(ts) != 1 || ts[0].Path != "pool.max_open" || ts[0].GoType != "int8" {
+		t.Errorf("Expected path type to be reported, got %+v", ts)
+	}
+
+	// 子路径按上报的路径校验，值中没有该路径时视为兼容
+	err = p.Publish(ctx, PublishRequest{Items: map[string][]RuleInput{
+		"db":      {{Value: map[string]any{"pool": map[string]any{"max_open": 1000}}}},
+		"timeout": {{Value: "3 seconds"}},
+	}})
+	if !errors.Is(err, ErrIncompatibleValue) || !strings.Contains(err.Error(), "at pool.max_open") || !strings.Contains(err.Error(), "key timeout") {
+		t.Errorf("Expected incompatible bound field and path, got %v", err)
+	}
+	if err := p.Publish(ctx, PublishRequest{Items: map[string][]RuleInput{
+		"db": {{Value: map[string]any{"dsn": "x"}}},
+	}}); err != nil {
+		t.Errorf("Unexpected error for missing path: %v", err)
+	}
+}
@@ -0,0 +1,462 @@
+package bttsetting
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// SegmentCond 人群包条件：Getter 中 Tag 标签的值属于名为 Name 的人群包时匹配。
+type SegmentCond struct {
+	Tag  string `json:"tag"`  // 输入标签，如 user_id
+	Name string `json:"name"` // 人群包名
+}
+
+const (
+	// segmentBatch 每次 SSCAN / 发布写入的成员数量
+	segmentBatch = 1000
+	// defaultSegmentExactLimit 成员数不超过该值的人群包使用精确集合，超过则使用布隆过滤器 + Redis 确认
+	defaultSegmentExactLimit = 50000
+	// segmentConfirmCacheSize 大人群包的 Redis 确认结果缓存上限
+	segmentConfirmCacheSize = 4096
+	// segmentConfirmTimeout 单次 Redis 确认的超时时间
+	segmentConfirmTimeout = 200 * time.Millisecond
+	// segmentConfirmBackoff Redis 确认失败后暂停确认的时间，期间未确认的成员直接视为不属于，不再占用读路径
+	segmentConfirmBackoff = time.Second
+)
+
+// errSegmentUnconfirmed 布隆过滤器命中但无法向 Redis 确认成员。
+var errSegmentUnconfirmed = errors.New("segment member unconfirmed")
+
+// WithSegmentExactLimit 设置使用精确集合存储的人群包大小上限，超过的人群包使用布隆过滤器。
+func WithSegmentExactLimit(n int) Option {
+	return func(c *Config) {
+		c.segments.exactLimit = n
+	}
+}
+
+// segmentStore 客户端内存中的人群包集合，只保存当前快照规则引用到的人群包。
+type segmentStore struct {
+	rdb        *redis.Client
+	exactLimit int
+
+	mu   sync.RWMutex
+	segs map[string]*segment
+
+	// gen 在任意人群包内容变化时递增，L1 缓存据此判断依赖人群包的结果是否过期。
+	// 从 1 开始，0 表示“不依赖人群包”。
+	gen atomic.Uint64
+	// confirmRetryAt 上一次 Redis 确认失败后恢复确认的时间 (UnixNano)，0 表示未失败
+	confirmRetryAt atomic.Int64
+}
+
+func newSegmentStore(rdb *redis.Client) *segmentStore {
+	s := &segmentStore{
+		rdb:        rdb,
+		exactLimit: defaultSegmentExactLimit,
+		segs:       make(map[string]*segment),
+	}
+	s.gen.Store(1)
+	return s
+}
+
+// segment 单个人群包：小人群包为精确集合；大人群包为布隆过滤器，命中后再向 Redis 确认。
+type segment struct {
+	name string
+
+	mu      sync.RWMutex
+	rev     int64
+	exact   map[string]struct{}
+	bloom   *bloomFilter
+	confirm map[string]bool // 大人群包的确认结果缓存
+}
+
+// contains 检查成员是否属于人群包。
+// 大人群包无法向 Redis 确认时返回 false 与 errSegmentUnconfirmed，调用方不应缓存该结果。
+func (s *segmentStore) contains(name, member string) (bool, error) {
+	s.mu.RLock()
+	seg := s.segs[name]
+	s.mu.RUnlock()
+	if seg == nil {
+		// 未加载 (如 Match 在没有环境的情况下调用)，视为不属于
+		return false, nil
+	}
+
+	seg.mu.RLock()
+	if seg.exact != nil {
+		_, ok := seg.exact[member]
+		seg.mu.RUnlock()
+		return ok, nil
+	}
+	if !seg.bloom.mayContain(member) {
+		seg.mu.RUnlock()
+		return false, nil
+	}
+	res, cached := seg.confirm[member]
+	seg.mu.RUnlock()
+	if cached {
+		return res, nil
+	}
+	if retryAt := s.confirmRetryAt.Load(); retryAt != 0 && time.Now().UnixNano() < retryAt {
+		return false, errSegmentUnconfirmed
+	}
+
+	// 布隆过滤器可能误判，且无法删除成员，因此需要向 Redis 确认
+	ctx, cancel := context.WithTimeout(context.Background(), segmentConfirmTimeout)
+	defer cancel()
+	ok, err := s.rdb.SIsMember(ctx, KeySegment(name), member).Result()
+	if err != nil {
+		slog.Warn("confirm segment member failed", "segment", name, "err", err)
+		s.confirmRetryAt.Store(time.Now().Add(segmentConfirmBackoff).UnixNano())
+		return false, fmt.Errorf("%w: %w", errSegmentUnconfirmed, err)
+	}
+	s.confirmRetryAt.Store(0)
+	seg.mu.Lock()
+	if len(seg.confirm) >= segmentConfirmCacheSize {
+		seg.confirm = make(map[string]bool)
+	}
+	seg.confirm[member] = ok
+	seg.mu.Unlock()
+	return ok, nil
+}
+
+// sync 确保 names 中的人群包都已加载到最新版本，并释放不再被引用的人群包。
+func (s *segmentStore) sync(ctx context.Context, names map[string]struct{}) error {
+	if len(names) == 0 {
+		s.mu.Lock()
+		if len(s.segs) > 0 {
+			s.segs = make(map[string]*segment)
+			s.gen.Add(1)
+		}
+		s.mu.Unlock()
+		return nil
+	}
+
+	list := make([]string, 0, len(names))
+	for n := range names {
+		list = append(list, n)
+	}
+	revs, err := s.rdb.HMGet(ctx, KeySegmentRevisions(), list...).Result()
+	if err != nil {
+		return fmt.Errorf("get segment revisions failed: %w", err)
+	}
+
+	s.mu.RLock()
+	old := s.segs
+	s.mu.RUnlock()
+
+	segs := make(map[string]*segment, len(list))
+	changed := len(old) != len(list)
+	for i, name := range list {
+		rev := parseRevision(revs[i])
+		if seg, ok := old[name]; ok && seg.revision() == rev {
+			segs[name] = seg
+			continue
+		}
+		seg, err := s.load(ctx, name)
+		if err != nil {
+			return err
+		}
+		segs[name] = seg
+		changed = true
+	}
+
+	s.mu.Lock()
+	s.segs = segs
+	s.mu.Unlock()
+	if changed {
+		s.gen.Add(1)
+	}
+	return nil
+}
+
+// refresh 检查已加载人群包的版本，重新加载版本不一致的人群包（反熵）。
+func (s *segmentStore) refresh(ctx context.Context) error {
+	s.mu.RLock()
+	names := make(map[string]struct{}, len(s.segs))
+	for n := range s.segs {
+		names[n] = struct{}{}
+	}
+	s.mu.RUnlock()
+	if len(names) == 0 {
+		return nil
+	}
+	return s.sync(ctx, names)
+}
+
+// load 通过 SSCAN 分批全量加载一个人群包。
+// 先读取版本号再扫描：扫描期间发生的变更会以更高的版本号通过增量消息再次应用，集合操作是幂等的。
+func (s *segmentStore) load(ctx context.Context, name string) (*segment, error) {
+	revStr, err := s.rdb.HGet(ctx, KeySegmentRevisions(), name).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("get segment %s revision failed: %w", name, err)
+	}
+	size, err := s.rdb.SCard(ctx, KeySegment(name)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("get segment %s size failed: %w", name, err)
+	}
+
+	seg := &segment{name: name, rev: parseRevision(revStr)}
+	if size <= int64(s.exactLimit) {
+		seg.exact = make(map[string]struct{}, size)
+	} else {
+		// 预留 50% 余量给后续的增量新增成员
+		seg.bloom = newBloomFilter(int(size+size/2), 0.01)
+		seg.confirm = make(map[string]bool)
+	}
+
+	var cursor uint64
+	for {
+		members, next, err := s.rdb.SScan(ctx, KeySegment(name), cursor, "", segmentBatch).Result()
+		if err != nil {
+			return nil, fmt.Errorf("scan segment %s failed: %w", name, err)
+		}
+		for _, m := range members {
+			seg.add(m)
+		}
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+	return seg, nil
+}
+
+// applyDelta 应用 Watch 收到的人群包增量。版本不连续时全量重新加载该人群包。
+func (s *segmentStore) applyDelta(ctx context.Context, msg *UpdateMessage) {
+	s.mu.RLock()
+	seg := s.segs[msg.Segment]
+	s.mu.RUnlock()
+	if seg == nil {
+		// 当前快照未引用该人群包
+		return
+	}
+
+	seg.mu.Lock()
+	switch {
+	case msg.Revision <= seg.rev:
+		// 已包含该变更
+		seg.mu.Unlock()
+		return
+	case msg.Revision == seg.rev+1:
+		for _, m := range msg.Added {
+			seg.add(m)
+		}
+		for _, m := range msg.Removed {
+			seg.remove(m)
+		}
+		seg.rev = msg.Revision
+		seg.mu.Unlock()
+		s.gen.Add(1)
+		return
+	}
+	seg.mu.Unlock()
+
+	// 丢失了中间的增量，全量重新加载
+	fresh, err := s.load(ctx, msg.Segment)
+	if err != nil {
+		slog.Error("reload segment failed", "segment", msg.Segment, "err", err)
+		return
+	}
+	s.mu.Lock()
+	if _, ok := s.segs[msg.Segment]; ok {
+		s.segs[msg.Segment] = fresh
+	}
+	s.mu.Unlock()
+	s.gen.Add(1)
+}
+
+func (seg *segment) revision() int64 {
+	seg.mu.RLock()
+	defer seg.mu.RUnlock()
+	return seg.rev
+}
+
+// add 新增成员 (调用方持有写锁或处于构建阶段)。
+func (seg *segment) add(m string) {
+	if seg.exact != nil {
+		seg.exact[m] = struct{}{}
+		return
+	}
+	seg.bloom.add(m)
+	delete(seg.confirm, m)
+}
+
+// remove 删除成员。布隆过滤器无法删除，只清理确认缓存，由 Redis 确认返回 false。
+func (seg *segment) remove(m string) {
+	if seg.exact != nil {
+		delete(seg.exact, m)
+		return
+	}
+	delete(seg.confirm, m)
+}
+
+func parseRevision(v any) int64 {
+	str, ok := v.(string)
+	if !ok {
+		return 0
+	}
+	rev, _ := strconv.ParseInt(str, 10, 64)
+	return rev
+}
+
+// segmentNames 收集规则中引用的全部人群包名。
+func segmentNames(items map[string][]Rule) map[string]struct{} {
+	names := make(map[string]struct{})
+	for _, rules := range items {
+		for i := range rules {
+			if rules[i].Segment != nil {
+				names[rules[i].Segment.Name] = struct{}{}
+			}
+		}
+	}
+	return names
+}
+
+// bloomFilter 简单的布隆过滤器，使用 FNV-1a 双重 Hash。
+type bloomFilter struct {
+	bits []uint64
+	m    uint64 // 位数
+	k    uint64 // Hash 函数个数
+}
+
+func newBloomFilter(n int, fpRate float64) *bloomFilter {
+	if n < 1024 {
+		n = 1024
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloomFilter{
+		bits: make([]uint64, (m+63)/64),
+		m:    m,
+		k:    k,
+	}
+}
+
+func (b *bloomFilter) hashes(s string) (uint64, uint64) {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	var h uint64 = offset64
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= prime64
+	}
+	h1 := h
+	// 第二个 Hash 由第一个 Hash 再混合得到 (splitmix64)
+	h2 := h ^ (h >> 30)
+	h2 *= 0xbf58476d1ce4e5b9
+	h2 ^= h2 >> 27
+	h2 *= 0x94d049bb133111eb
+	h2 ^= h2 >> 31
+	return h1, h2 | 1
+}
+
+func (b *bloomFilter) add(s string) {
+	h1, h2 := b.hashes(s)
+	for i := uint64(0); i < b.k; i++ {
+		pos := (h1 + i*h2) % b.m
+		b.bits[pos/64] |= 1 << (pos % 64)
+	}
+}
+
+func (b *bloomFilter) mayContain(s string) bool {
+	h1, h2 := b.hashes(s)
+	for i := uint64(0); i < b.k; i++ {
+		pos := (h1 + i*h2) % b.m
+		if b.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// segmentEditScript 原子地修改人群包成员、递增版本并发送增量通知。
+// 增量消息在 Lua 中补充 revision 字段，保证消息中的版本与实际写入一致。
+const segmentEditScript = `
+	local setKey = KEYS[1]
+	local revKey = KEYS[2]
+	local streamKey = KEYS[3]
+
+	local name = ARGV[1]
+	local op = ARGV[2]
+	local msgJSON = ARGV[3]
+
+	local members = {}
+	for i = 4, #ARGV do
+		members[#members + 1] = ARGV[i]
+	end
+
+	if op == 'add' then
+		redis.call('SADD', setKey, unpack(members))
+	else
+		redis.call('SREM', setKey, unpack(members))
+	end
+
+	local rev = redis.call('HINCRBY', revKey, name, 1)
+	local msg = cjson.decode(msgJSON)
+	msg['revision'] = rev
+	redis.call('XADD', streamKey, 'MAXLEN', '~', '1000', '*', 'data', cjson.encode(msg))
+
+	return rev
+`
+
+// SegmentAdd 向人群包中添加成员。人群包独立于配置快照版本，修改后通过 Watch 增量同步到客户端，
+// 无需重新发布引用它的配置 Key。成员较多时分批写入，每批产生一个版本。
+func (p *Publisher) SegmentAdd(ctx context.Context, name string, members ...string) error {
+	return p.editSegment(ctx, name, "add", members)
+}
+
+// SegmentRemove 从人群包中移除成员。
+func (p *Publisher) SegmentRemove(ctx context.Context, name string, members ...string) error {
+	return p.editSegment(ctx, name, "remove", members)
+}
+
+func (p *Publisher) editSegment(ctx context.Context, name, op string, members []string) error {
+	if name == "" {
+		return fmt.Errorf("segment name is empty")
+	}
+	for start := 0; start < len(members); start += segmentBatch {
+		end := start + segmentBatch
+		if end > len(members) {
+			end = len(members)
+		}
+		batch := members[start:end]
+
+		msg := UpdateMessage{
+			Event:     EventSegment,
+			Segment:   name,
+			Timestamp: time.Now().Unix(),
+		}
+		if op == "add" {
+			msg.Added = batch
+		} else {
+			msg.Removed = batch
+		}
+		msgData, _ := json.Marshal(msg)
+
+		keys := []string{KeySegment(name), KeySegmentRevisions(), KeyUpdates()}
+		argv := make([]any, 0, 3+len(batch))
+		argv = append(argv, name, op, string(msgData))
+		for _, m := range batch {
+			argv = append(argv, m)
+		}
+		if err := p.rdb.Eval(ctx, segmentEditScript, keys, argv...).Err(); err != nil {
+			return fmt.Errorf("edit segment %s failed: %w", name, err)
+		}
+	}
+	return nil
+}
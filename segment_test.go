@@ -0,0 +1,258 @@
+package bttsetting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestBloomFilter(t *testing.T) {
+	b := newBloomFilter(10000, 0.01)
+	for i := 0; i < 10000; i++ {
+		b.add(fmt.Sprintf("u%d", i))
+	}
+	for i := 0; i < 10000; i++ {
+		if !b.mayContain(fmt.Sprintf("u%d", i)) {
+			t.Fatalf("False negative for u%d", i)
+		}
+	}
+	fp := 0
+	for i := 0; i < 10000; i++ {
+		if b.mayContain(fmt.Sprintf("x%d", i)) {
+			fp++
+		}
+	}
+	if fp > 300 {
+		t.Errorf("False positive rate too high: %d/10000", fp)
+	}
+}
+
+func publishSegmentRule(t *testing.T, p *Publisher, ctx context.Context) {
+	t.Helper()
+	err := p.Publish(ctx, PublishRequest{
+		FullReplace: true,
+		Items: map[string][]RuleInput{
+			"discount": {
+				{Value: 50, Segment: &SegmentCond{Tag: "user_id", Name: "whitelist"}},
+				{Value: 0},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+}
+
+func TestSegment_ExactAndWatch(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testseg:")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p := NewPublisher(rdb, 1)
+	if err := p.SegmentAdd(ctx, "whitelist", "u1", "u2"); err != nil {
+		t.Fatalf("SegmentAdd failed: %v", err)
+	}
+	publishSegmentRule(t, p, ctx)
+
+	cfg, err := New(rdb, 1)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	get := func(g *Getter) int {
+		v, _ := Get[int](g, "discount")
+		return v
+	}
+	g1 := cfg.WithTags(map[string]any{"user_id": "u1"})
+	g3 := cfg.WithTags(map[string]any{"user_id": "u3"})
+	if get(g1) != 50 || get(g3) != 0 {
+		t.Fatalf("Unexpected initial values: %d, %d", get(g1), get(g3))
+	}
+	// 没有 user_id 的 Getter 不属于人群包
+	if get(cfg.WithTags(nil)) != 0 {
+		t.Error("Expected 0 without user_id")
+	}
+	// Match 没有求值环境，人群包条件不匹配
+	ss := cfg.snapshot.Load().(*Snapshot)
+	if r := Match(ss.Rules["discount"], map[string]any{"user_id": "u1"}); r == nil || r.Segment != nil {
+		t.Errorf("Match without env should skip segment rule, got %v", r)
+	}
+
+	go cfg.Watch(ctx)
+	time.Sleep(100 * time.Millisecond)
+
+	// 人群包变更通过 Watch 增量同步，无需重新发布，AllHash 不变
+	hash := ss.AllHash
+	p.SegmentAdd(ctx, "whitelist", "u3")
+	p.SegmentRemove(ctx, "whitelist", "u1")
+
+	ok := false
+	for i := 0; i < 30; i++ {
+		// 复用同一个 Getter：L1 缓存需要感知人群包变化
+		if get(g1) == 0 && get(g3) == 50 {
+			ok = true
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if !ok {
+		t.Fatalf("Segment delta not applied: u1=%d u3=%d", get(g1), get(g3))
+	}
+	if cfg.snapshot.Load().(*Snapshot).AllHash != hash {
+		t.Error("AllHash should not change on segment edit")
+	}
+}
+
+func TestSegment_LargeWithBloom(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testsegbig:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	members := make([]string, 2500)
+	for i := range members {
+		members[i] = fmt.Sprintf("u%d", i)
+	}
+	if err := p.SegmentAdd(ctx, "whitelist", members...); err != nil {
+		t.Fatalf("SegmentAdd failed: %v", err)
+	}
+	// 分批写入，每批一个版本
+	if rev, _ := rdb.HGet(ctx, KeySegmentRevisions(), "whitelist").Result(); rev != "3" {
+		t.Errorf("Expected revision 3, got %s", rev)
+	}
+	publishSegmentRule(t, p, ctx)
+
+	cfg, err := New(rdb, 1, WithSegmentExactLimit(100))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	seg := cfg.segments.segs["whitelist"]
+	if seg == nil || seg.bloom == nil || seg.exact != nil {
+		t.Fatalf("Expected bloom segment, got %+v", seg)
+	}
+
+	for _, uid := range []string{"u0", "u1234", "u2499"} {
+		if v, _ := Get[int](cfg.WithTags(map[string]any{"user_id": uid}), "discount"); v != 50 {
+			t.Errorf("Expected %s in segment", uid)
+		}
+	}
+	for i := 0; i < 200; i++ {
+		uid := fmt.Sprintf("x%d", i)
+		if v, _ := Get[int](cfg.WithTags(map[string]any{"user_id": uid}), "discount"); v != 0 {
+			t.Fatalf("Expected %s not in segment (false positive must be confirmed)", uid)
+		}
+	}
+
+	// 删除成员：布隆过滤器无法删除，由 Redis 确认
+	p.SegmentRemove(ctx, "whitelist", "u0")
+	cfg.segments.applyDelta(ctx, &UpdateMessage{Event: EventSegment, Segment: "whitelist", Revision: 4, Removed: []string{"u0"}})
+	if v, _ := Get[int](cfg.WithTags(map[string]any{"user_id": "u0"}), "discount"); v != 0 {
+		t.Error("Removed member should not match")
+	}
+}
+
+func TestSegment_ConfirmFailureNotCached(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testsegconfirm:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	p.SegmentAdd(ctx, "whitelist", "u1", "u2", "u3")
+	publishSegmentRule(t, p, ctx)
+	cfg, _ := New(rdb, 1, WithSegmentExactLimit(1), WithEvalCacheSize(16))
+	tags := map[string]any{"user_id": "u2"}
+
+	// Redis 不可用：无法确认时按不属于处理
+	mr.SetError("unavailable")
+	g := cfg.WithTags(tags)
+	if v, _ := Get[int](g, "discount"); v != 0 {
+		t.Errorf("Expected 0 while unconfirmed, got %d", v)
+	}
+	val, _ := ValueOf[int](cfg, "discount", tags)
+	defer val.Close()
+	if v := val.Load(); v != 0 {
+		t.Errorf("Expected 0 while unconfirmed, got %d", v)
+	}
+	// 暂停确认期间不再访问 Redis
+	if _, err := cfg.segments.contains("whitelist", "u3"); !errors.Is(err, errSegmentUnconfirmed) {
+		t.Errorf("Expected unconfirmed during backoff, got %v", err)
+	}
+
+	// 恢复后同一个 Getter 与新的 Getter 都重新确认，未确认的结果没有被缓存
+	mr.SetError("")
+	cfg.segments.confirmRetryAt.Store(0)
+	if v, _ := Get[int](g, "discount"); v != 50 {
+		t.Errorf("Expected 50 after Redis recovered, got %d", v)
+	}
+	if v, _ := Get[int](cfg.WithTags(tags), "discount"); v != 50 {
+		t.Errorf("Expected 50 from a new Getter, got %d", v)
+	}
+	if v := val.Load(); v != 50 {
+		t.Errorf("Expected ValueOf to re-evaluate, got %d", v)
+	}
+}
+
+func TestSegmentStore_RevisionGap(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testseggap:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	p.SegmentAdd(ctx, "s", "a")
+	store := newSegmentStore(rdb)
+	if err := store.sync(ctx, map[string]struct{}{"s": {}}); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+
+	in := func(name, member string) bool {
+		ok, _ := store.contains(name, member)
+		return ok
+	}
+
+	// 中间的增量丢失 (rev 2)，收到 rev 3 时全量重新加载
+	p.SegmentAdd(ctx, "s", "b")
+	p.SegmentAdd(ctx, "s", "c")
+	gen := store.gen.Load()
+	store.applyDelta(ctx, &UpdateMessage{Event: EventSegment, Segment: "s", Revision: 3, Added: []string{"c"}})
+	if !in("s", "b") || !in("s", "c") {
+		t.Error("Expected full reload after revision gap")
+	}
+	if store.gen.Load() == gen {
+		t.Error("Generation should increase")
+	}
+
+	// 旧版本增量被忽略
+	store.applyDelta(ctx, &UpdateMessage{Event: EventSegment, Segment: "s", Revision: 2, Removed: []string{"b"}})
+	if !in("s", "b") {
+		t.Error("Stale delta should be ignored")
+	}
+
+	// 未引用的人群包不加载
+	store.applyDelta(ctx, &UpdateMessage{Event: EventSegment, Segment: "other", Revision: 1, Added: []string{"x"}})
+	if in("other", "x") {
+		t.Error("Unreferenced segment should not be loaded")
+	}
+
+	// 不再引用时释放
+	store.sync(ctx, nil)
+	if in("s", "a") {
+		t.Error("Segment should be released")
+	}
+
+	if err := p.SegmentAdd(ctx, ""); err == nil {
+		t.Error("Expected error for empty segment name")
+	}
+}
@@ -0,0 +1,121 @@
+package bttsetting
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Reader 是同时接受两种访问器的读取函数（GetAll、GetPath）的类型约束。
+type Reader interface {
+	*Getter | *SharedGetter
+}
+
+// SharedGetter 是标签固定、可被多个协程并发使用的 Getter，适合长生命周期的后台任务与工作池。
+//
+// L1 缓存按快照 Hash 整体替换，读路径只有一次原子加载和一次 sync.Map 查找，不加锁；
+// 未命中时在锁内求值，只发布本次写入的 Key 的条目（每个 Key 的条目切片写时复制），
+// 不复制整个缓存。未匹配的结果（ErrNotFound）同样缓存，不存在的 Key 不会每次都加锁求值。
+//
+// 与 Getter 不同，SharedGetter 不固定快照：每次读取都使用 Config 的最新快照，
+// 需要一致读取多个 Key 时使用 GetManyShared。
+type SharedGetter struct {
+	cfg   *Config
+	state atomic.Pointer[sharedState]
+
+	mu    sync.Mutex
+	inner *Getter // 未命中时用于求值，仅在持有 mu 时使用
+}
+
+// sharedState 某个快照下的 L1 缓存。只在持有 SharedGetter.mu 时写入，
+// 每个 Key 的条目切片发布后不再修改。
+type sharedState struct {
+	hash    string
+	entries sync.Map // Key -> l1Entries
+}
+
+// load 返回 key 已发布的条目。
+func (st *sharedState) load(key string) l1Entries {
+	if v, ok := st.entries.Load(key); ok {
+		return v.(l1Entries)
+	}
+	return nil
+}
+
+// WithSharedTags 创建一个标签固定、并发安全的 SharedGetter。
+// 标签的解析规则与 WithTags 相同；tags 在创建后不应再被修改。
+func (c *Config) WithSharedTags(tags map[string]any) *SharedGetter {
+	return &SharedGetter{
+		cfg:   c,
+		inner: &Getter{cfg: c, rawTags: tags},
+	}
+}
+
+// GetShared 与 Get 相同，从 SharedGetter 读取配置值。
+func GetShared[T any](sg *SharedGetter, key string) (T, error) {
+	return getShared[T](sg, sg.current(), key)
+}
+
+// GetManyShared 与 GetMany 相同，从 SharedGetter 读取；所有 Key 同样读自同一个快照。
+func GetManyShared[T any](sg *SharedGetter, keys ...string) (map[string]T, error) {
+	ss := sg.current()
+	return getMany(keys, func(key string) (T, error) { return getShared[T](sg, ss, key) })
+}
+
+// getShared 是 SharedGetter 的 Get 实现，ss 为本次读取使用的快照。
+func getShared[T any](sg *SharedGetter, ss *Snapshot, key string) (T, error) {
+	if st := sg.state.Load(); st != nil && st.hash == ss.AllHash {
+		es := st.load(key)
+		if entry, ok := es.find(typeID[T]()); ok && entry.valid(sg.cfg, ss) {
+			if val, ok := entry.ParsedValue.(T); ok {
+				return val, nil
+			}
+		}
+		if entry, ok := es.evaluated(sg.cfg, ss); ok && entry.notFound {
+			return defaultValue[T](sg.cfg, key, "")
+		}
+	}
+
+	var (
+		val T
+		err error
+	)
+	sg.locked(ss, true, func(g *Getter) {
+		val, err = get[T](g, key, nil)
+	})
+	return val, err
+}
+
+// current 返回 Config 的当前快照。
+func (sg *SharedGetter) current() *Snapshot {
+	return sg.cfg.snapshot.Load().(*Snapshot)
+}
+
+// locked 在持有锁时使用内部 Getter 求值：内部 Getter 固定到 ss，读取已发布的缓存，新条目写入自己的缓存。
+// publish 为 true 且 ss 仍是 Config 的当前快照时，把新条目发布到 ss 的缓存（快照变化时新建）；
+// 旧快照下的结果不会覆盖新快照的缓存。
+func (sg *SharedGetter) locked(ss *Snapshot, publish bool, fn func(g *Getter)) {
+	sg.mu.Lock()
+	defer sg.mu.Unlock()
+
+	st := sg.state.Load()
+	if st != nil && st.hash != ss.AllHash {
+		st = nil
+	}
+	g := sg.inner
+	g.pinned = ss
+	g.cache = make(map[string]l1Entries)
+	g.shared = st
+
+	fn(g)
+
+	if publish && len(g.cache) > 0 && ss.AllHash == sg.current().AllHash {
+		if st == nil {
+			st = &sharedState{hash: ss.AllHash}
+			defer sg.state.Store(st)
+		}
+		for key, es := range g.cache {
+			st.entries.Store(key, es)
+		}
+	}
+	g.cache, g.shared = nil, nil
+}
@@ -0,0 +1,151 @@
+package bttsetting
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestSharedGetter(t *testing.T) {
+	cfg := &Config{segments: newSegmentStore(nil), now: time.Now}
+	cfg.snapshot.Store(&Snapshot{
+		Version: 1,
+		AllHash: "hash1",
+		Rules: map[string][]Rule{
+			"timeout": {{Tags: map[string]any{"env": "prod"}, ValueHash: "t1"}, {ValueHash: "t0"}},
+			"retries": {{ValueHash: "r1"}},
+		},
+		Values: map[string]string{"t1": "100", "t0": "50", "r1": "3"},
+	})
+
+	sg := cfg.WithSharedTags(map[string]any{"env": "prod"})
+	if v, err := GetShared[int](sg, "timeout"); err != nil || v != 100 {
+		t.Fatalf("Expected 100, got %d, %v", v, err)
+	}
+	st := sg.state.Load()
+	if st == nil || st.hash != "hash1" || st.load("timeout") == nil {
+		t.Fatalf("Expected published L1 state, got %+v", st)
+	}
+
+	// 命中 L1 不会重新发布状态
+	GetShared[int](sg, "timeout")
+	if sg.state.Load() != st {
+		t.Error("L1 hit should not republish state")
+	}
+	// 新 Key 写入同一个快照的状态，不复制已有条目
+	GetShared[int](sg, "retries")
+	if sg.state.Load() != st || st.load("retries") == nil {
+		t.Error("Expected new key to be published in place")
+	}
+
+	// 未匹配的结果同样缓存
+	for i := 0; i < 2; i++ {
+		if _, err := GetShared[int](sg, "missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+	}
+	if e, ok := st.load("missing").evaluated(cfg, cfg.snapshot.Load().(*Snapshot)); !ok || !e.notFound {
+		t.Error("Expected negative L1 entry")
+	}
+	if _, err := GetShared[string](sg, "timeout"); err == nil {
+		t.Error("Expected type mismatch")
+	}
+
+	got, err := GetManyShared[int](sg, "timeout", "retries")
+	if err != nil || got["timeout"] != 100 || got["retries"] != 3 {
+		t.Errorf("Unexpected GetMany result: %v, %v", got, err)
+	}
+	_, ex, _ := GetDetailedShared[int](sg, "timeout")
+	if ex.Source != SourceL1 || ex.RuleIndex != 0 {
+		t.Errorf("Unexpected explanation: %+v", ex)
+	}
+	if ex, err := ExplainShared(sg, "timeout"); err != nil || !ex.Matched || ex.AllHash != "hash1" {
+		t.Errorf("Unexpected explanation: %+v, %v", ex, err)
+	}
+
+	// SharedGetter 不固定快照，重载后读取最新值
+	cfg.snapshot.Store(&Snapshot{
+		Version: 1,
+		AllHash: "hash2",
+		Rules:   map[string][]Rule{"timeout": {{ValueHash: "t2"}}},
+		Values:  map[string]string{"t2": "200"},
+	})
+	if v, _ := GetShared[int](sg, "timeout"); v != 200 {
+		t.Errorf("Expected 200 after reload, got %d", v)
+	}
+	if st := sg.state.Load(); st.hash != "hash2" || st.load("retries") != nil {
+		t.Errorf("Expected state replaced for new snapshot, got %+v", st)
+	}
+}
+
+func TestSharedGetter_Concurrent(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testshared:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	publish := func(v int) {
+		err := p.Publish(ctx, PublishRequest{
+			FullReplace: true,
+			Items: map[string][]RuleInput{
+				"a": {{Tags: map[string]any{"env": "prod"}, Value: v}, {Value: 0}},
+				"b": {{Value: v}},
+				"c": {{Value: "x"}},
+			},
+		})
+		if err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+	}
+	publish(1)
+	cfg, _ := New(rdb, 1)
+	sg := cfg.WithSharedTags(map[string]any{"env": "prod"})
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				m, err := GetManyShared[int](sg, "a", "b")
+				if err != nil {
+					t.Errorf("GetMany failed: %v", err)
+					return
+				}
+				// 同一次 GetMany 的结果来自同一个快照
+				if m["a"] != m["b"] || m["a"] == 0 {
+					t.Errorf("Inconsistent read: %v", m)
+					return
+				}
+				GetShared[string](sg, "c")
+				runtime.Gosched()
+			}
+		}()
+	}
+	for v := 2; v <= 5; v++ {
+		publish(v)
+		if err := cfg.Load(ctx); err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	if v, _ := GetShared[int](sg, "a"); v != 5 {
+		t.Errorf("Expected 5, got %d", v)
+	}
+}
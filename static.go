@@ -0,0 +1,143 @@
+package bttsetting
+
+import (
+	"sort"
+)
+
+// WithPendingRestart 设置静态 Key 有新的发布等待重启生效时的回调，keys 为当前所有等待重启的 Key（已排序）。
+// 回调在后台协程中调用，不阻塞重载；同一组变更只通知一次。
+func WithPendingRestart(fn func(keys []string)) Option {
+	return func(c *Config) {
+		c.changes.subscribe(func(cs *ChangeSet) {
+			if cs.restartChanged && len(cs.PendingRestart) > 0 {
+				fn(cs.PendingRestart)
+			}
+		})
+	}
+}
+
+// Status 客户端当前的配置状态。
+type Status struct {
+	Version int    `json:"version"`
+	AllHash string `json:"allHash"` // 最近一次加载的快照 Hash
+	// PendingRestart 发布了新值、但因为是静态 Key 要重启后才生效的 Key（已排序）
+	PendingRestart []string `json:"pendingRestart,omitempty"`
+	// MissingRequired 通过 Register 声明为必填、但快照中不存在的 Key（已排序）
+	MissingRequired []string `json:"missingRequired,omitempty"`
+}
+
+// Err 返回未就绪的原因（包装 ErrNotReady）：还没有加载到快照，或缺少必填 Key；就绪时返回 nil。
+func (s Status) Err() error {
+	return statusErr(&s)
+}
+
+// Status 返回客户端当前的配置状态。
+func (c *Config) Status() Status {
+	ss := c.snapshot.Load().(*Snapshot)
+	c.mu.RLock()
+	pending := sortedKeys(c.pending)
+	c.mu.RUnlock()
+	return Status{
+		Version:         ss.Version,
+		AllHash:         ss.AllHash,
+		PendingRestart:  pending,
+		MissingRequired: c.missingRequired(ss),
+	}
+}
+
+// staticKeys 进程启动时加载的静态 Key 的规则与值。
+// 静态标记本身也以启动时为准：之后新增或取消的标记在重启后生效。
+type staticKeys struct {
+	rules  map[string][]Rule // Key -> 启动时的规则，启动时不存在的 Key 不在其中
+	hashes map[string]string // Key -> 启动时的规则 Hash
+	values map[string]string // 启动时规则引用的 ValueHash -> RawJSON
+	keys   []string          // 所有静态 Key
+}
+
+// captureStatic 从启动时的快照中记录静态 Key，没有静态 Key 时返回空记录。
+func captureStatic(ss *Snapshot) *staticKeys {
+	st := &staticKeys{
+		rules:  make(map[string][]Rule),
+		hashes: make(map[string]string),
+		values: make(map[string]string),
+	}
+	for key, m := range ss.Meta.Keys {
+		if !m.Static {
+			continue
+		}
+		st.keys = append(st.keys, key)
+		rules, ok := ss.Rules[key]
+		if !ok {
+			continue
+		}
+		st.rules[key] = rules
+		st.hashes[key] = ss.rulesHash(key)
+		for i := range rules {
+			rules[i].valueHashes(func(h string) {
+				st.values[h] = ss.Values[h]
+			})
+		}
+	}
+	sort.Strings(st.keys)
+	return st
+}
+
+// pin 把新加载的规则中的静态 Key 替换为启动时的规则，返回规则与启动时不同的 Key
+// 及其新发布的规则 Hash（Key 被删除时为空）。
+func (st *staticKeys) pin(items map[string][]Rule, ruleHashes map[string]string) map[string]string {
+	var pending map[string]string
+	for _, key := range st.keys {
+		newHash := ruleHashes[key]
+		if _, ok := items[key]; !ok {
+			newHash = ""
+		}
+		if newHash != st.hashes[key] {
+			if pending == nil {
+				pending = make(map[string]string)
+			}
+			pending[key] = newHash
+		}
+		if rules, ok := st.rules[key]; ok {
+			items[key] = rules
+			ruleHashes[key] = st.hashes[key]
+		} else {
+			delete(items, key)
+			delete(ruleHashes, key)
+		}
+	}
+	return pending
+}
+
+// value 返回启动时规则引用的值，st 可以为 nil。
+func (st *staticKeys) value(h string) (string, bool) {
+	if st == nil {
+		return "", false
+	}
+	v, ok := st.values[h]
+	return v, ok
+}
+
+// samePending 判断两组等待重启的 Key 及其规则 Hash 是否相同。
+func samePending(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, h := range a {
+		if bh, ok := b[k]; !ok || bh != h {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedKeys(m map[string]string) []string {
+	if len(m) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,176 @@
+package bttsetting
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestStaticKeys(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("teststatic:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	items := map[string][]RuleInput{
+		"db.dsn":  {{Value: "mysql://a"}},
+		"timeout": {{Value: 10}},
+	}
+	err := p.Publish(ctx, PublishRequest{
+		FullReplace: true,
+		Items:       items,
+		KeyMeta:     map[string]KeyMetadata{"db.dsn": {Static: true}, "port": {Static: true}},
+	})
+	if err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	notified := make(chan []string, 10)
+	cfg, _ := New(rdb, 1, WithPendingRestart(func(keys []string) { notified <- keys }))
+	changes := cfg.Changes()
+
+	publish := func() {
+		t.Helper()
+		if err := p.Publish(ctx, PublishRequest{Items: items}); err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+		if err := cfg.Load(ctx); err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+	}
+	get := func(key string) any {
+		g := cfg.WithTags(nil)
+		if key == "timeout" {
+			v, _ := Get[int](g, key)
+			return v
+		}
+		v, err := Get[string](g, key)
+		if err != nil {
+			return err
+		}
+		return v
+	}
+
+	// 静态 Key 保持启动时的值，其他 Key 正常热更新
+	items["db.dsn"] = []RuleInput{{Value: "mysql://b"}}
+	items["timeout"] = []RuleInput{{Value: 20}}
+	publish()
+	if get("db.dsn") != "mysql://a" || get("timeout") != 20 {
+		t.Errorf("Unexpected values: %v, %v", get("db.dsn"), get("timeout"))
+	}
+	if st := cfg.Status(); !reflect.DeepEqual(st.PendingRestart, []string{"db.dsn"}) {
+		t.Errorf("Unexpected status: %+v", st)
+	}
+	select {
+	case keys := <-notified:
+		if !reflect.DeepEqual(keys, []string{"db.dsn"}) {
+			t.Errorf("Unexpected pending keys %v", keys)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected pending restart callback")
+	}
+	cs := <-changes
+	if len(cs.Changes) != 1 || cs.Changes[0].Key != "timeout" || len(cs.PendingRestart) != 1 {
+		t.Errorf("Static key should only appear in PendingRestart: %+v", cs)
+	}
+
+	// 等待重启的 Key 没有新变化时不重复通知
+	items["timeout"] = []RuleInput{{Value: 30}}
+	publish()
+	// 启动时不存在的静态 Key 保持不存在
+	items["port"] = []RuleInput{{Value: "8080"}}
+	publish()
+	if _, ok := get("port").(error); !ok {
+		t.Errorf("Expected static key absent at start to stay absent, got %v", get("port"))
+	}
+	select {
+	case keys := <-notified:
+		if !reflect.DeepEqual(keys, []string{"db.dsn", "port"}) {
+			t.Errorf("Unexpected pending keys %v", keys)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected pending restart callback")
+	}
+
+	// 恢复为启动时的值后不再等待重启
+	items["db.dsn"] = []RuleInput{{Value: "mysql://a"}}
+	delete(items, "port")
+	p.Publish(ctx, PublishRequest{Items: items, Deletes: []DeleteOp{{Key: "port"}}})
+	cfg.Load(ctx)
+	if st := cfg.Status(); len(st.PendingRestart) != 0 {
+		t.Errorf("Expected no pending keys, got %v", st.PendingRestart)
+	}
+	select {
+	case keys := <-notified:
+		t.Errorf("Unexpected callback %v", keys)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// 新的客户端以启动时加载的值为准
+	items["db.dsn"] = []RuleInput{{Value: "mysql://c"}}
+	publish()
+	cfg2, _ := New(rdb, 1)
+	if v, _ := Get[string](cfg2.WithTags(nil), "db.dsn"); v != "mysql://c" {
+		t.Errorf("Expected restarted client to read new value, got %s", v)
+	}
+}
+
+func TestPublisher_Diff(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("teststatic2:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	p.Publish(ctx, PublishRequest{
+		FullReplace: true,
+		Items: map[string][]RuleInput{
+			"db.dsn":  {{Value: "mysql://a"}},
+			"timeout": {{Value: 10}},
+		},
+		KeyMeta: map[string]KeyMetadata{"db.dsn": {Static: true}},
+	})
+	cfg, _ := New(rdb, 1)
+	base := cfg.Status().AllHash
+
+	req := PublishRequest{
+		Items:   map[string][]RuleInput{"db.dsn": {{Value: "mysql://b"}}, "timeout": {{Value: 20}}},
+		KeyMeta: map[string]KeyMetadata{"port": {Static: true}},
+	}
+	d, err := p.Diff(ctx, req)
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	if d.BaseHash != base || d.NewHash == base || len(d.Changes) != 2 {
+		t.Errorf("Unexpected diff: %+v", d)
+	}
+	if len(d.Warnings) != 2 ||
+		!strings.Contains(d.Warnings[0], "db.dsn is static") ||
+		!strings.Contains(d.Warnings[1], "port: static flag") {
+		t.Errorf("Unexpected warnings: %v", d.Warnings)
+	}
+
+	// Diff 不写入 Redis，发布后的 Hash 与预演一致
+	if cfg.Load(ctx); cfg.Status().AllHash != base {
+		t.Error("Diff should not publish")
+	}
+	p.Publish(ctx, req)
+	cfg.Load(ctx)
+	if cfg.Status().AllHash != d.NewHash {
+		t.Errorf("Expected published hash %s, got %s", d.NewHash, cfg.Status().AllHash)
+	}
+
+	// 清除元数据
+	d, _ = p.Diff(ctx, PublishRequest{KeyMeta: map[string]KeyMetadata{"db.dsn": {}}})
+	if len(d.Changes) != 0 || len(d.Warnings) != 1 {
+		t.Errorf("Unexpected diff: %+v", d)
+	}
+}
@@ -0,0 +1,184 @@
+package bttsetting
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Schedule 周期性生效窗口：当前时间（按 Timezone 换算后）满足 Cron 表达式的每一分钟内规则生效。
+// Cron 为 5 段格式「分 时 日 月 周」，支持 *、数字、a-b、*/n、a/n、a-b/n 及逗号列表，
+// 例如 "* 9-17 * * 1-5" 表示工作日 9:00-17:59。
+type Schedule struct {
+	Cron     string `json:"cron"`
+	Timezone string `json:"timezone,omitempty"` // IANA 时区，如 Asia/Shanghai，默认 UTC
+
+	// 编译结果，首次使用时解析（Schedule 在规则中以指针形式共享，可并发使用）
+	once sync.Once
+	spec *cronSpec
+	loc  *time.Location
+	err  error
+}
+
+// WithClock 设置规则时间窗口求值使用的时钟，默认 time.Now，主要用于测试。
+func WithClock(now func() time.Time) Option {
+	return func(c *Config) {
+		c.now = now
+	}
+}
+
+// compile 解析 Cron 表达式与时区。
+func (s *Schedule) compile() error {
+	s.once.Do(func() {
+		s.loc = time.UTC
+		if s.Timezone != "" {
+			if s.loc, s.err = time.LoadLocation(s.Timezone); s.err != nil {
+				return
+			}
+		}
+		s.spec, s.err = parseCron(s.Cron)
+	})
+	return s.err
+}
+
+// active 判断给定时间是否处于周期窗口内。表达式非法时视为不生效。
+func (s *Schedule) active(now time.Time) bool {
+	if s.compile() != nil {
+		return false
+	}
+	return s.spec.match(now.In(s.loc))
+}
+
+// matchTime 检查规则的时间条件，并把结果可能发生变化的下一个时间点记录到求值环境中，
+// 使 L1 缓存在窗口边界到达时失效（窗口边界不会改变 AllHash）。
+func (r *Rule) matchTime(ec *evalContext) bool {
+	now := ec.now()
+	sec := now.Unix()
+
+	if r.ValidFrom != 0 {
+		if sec < r.ValidFrom {
+			ec.expireAt(time.Unix(r.ValidFrom, 0))
+			return false
+		}
+	}
+	if r.ValidUntil != 0 {
+		if sec >= r.ValidUntil {
+			return false
+		}
+		ec.expireAt(time.Unix(r.ValidUntil, 0))
+	}
+	if r.Schedule != nil {
+		// 周期窗口以分钟为粒度，结果最多保持到下一分钟
+		ec.expireAt(now.Truncate(time.Minute).Add(time.Minute))
+		return r.Schedule.active(now)
+	}
+	return true
+}
+
+// hasTimeWindow 规则是否带有时间条件。
+func (r *Rule) hasTimeWindow() bool {
+	return r.ValidFrom != 0 || r.ValidUntil != 0 || r.Schedule != nil
+}
+
+// cronSpec 编译后的 Cron 表达式，每个字段用位图表示允许的取值。
+type cronSpec struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+func (c *cronSpec) match(t time.Time) bool {
+	if c.minute&(1<<uint(t.Minute())) == 0 ||
+		c.hour&(1<<uint(t.Hour())) == 0 ||
+		c.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	domOK := c.dom&(1<<uint(t.Day())) != 0
+	dowOK := c.dow&(1<<uint(t.Weekday())) != 0
+	// 与标准 cron 一致：日与周都被限制时，满足其一即可
+	if !c.domAny && !c.dowAny {
+		return domOK || dowOK
+	}
+	return domOK && dowOK
+}
+
+func parseCron(expr string) (*cronSpec, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron %q: expected 5 fields, got %d", expr, len(fields))
+	}
+	var (
+		spec cronSpec
+		err  error
+	)
+	if spec.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("cron %q minute: %w", expr, err)
+	}
+	if spec.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("cron %q hour: %w", expr, err)
+	}
+	if spec.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("cron %q day of month: %w", expr, err)
+	}
+	if spec.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("cron %q month: %w", expr, err)
+	}
+	if spec.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("cron %q day of week: %w", expr, err)
+	}
+	// 7 与 0 都表示周日
+	if spec.dow&(1<<7) != 0 {
+		spec.dow |= 1
+	}
+	spec.domAny = fields[2] == "*"
+	spec.dowAny = fields[4] == "*"
+	return &spec, nil
+}
+
+// parseCronField 解析单个 Cron 字段为位图。
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step, stepped := part, 1, false
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			rangePart = part[:idx]
+			n, err := strconv.Atoi(part[idx+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", part)
+			}
+			step, stepped = n, true
+		}
+
+		lo, hi := min, max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid range %q", part)
+			}
+			if hi, err = strconv.Atoi(bounds[1]); err != nil {
+				return 0, fmt.Errorf("invalid range %q", part)
+			}
+		default:
+			n, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			lo, hi = n, n
+			if stepped {
+				// a/n 与标准 cron 一致：从 a 开始到字段最大值，每 n 个取一次
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("value %q out of range [%d, %d]", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
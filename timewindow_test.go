@@ -0,0 +1,171 @@
+package bttsetting
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+	_ "time/tzdata" // 测试环境可能没有系统时区数据
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr string
+		at   string // RFC3339 (UTC)
+		want bool
+	}{
+		{"* * * * *", "2026-11-11T03:04:00Z", true},
+		{"0 0 11 11 *", "2026-11-11T00:00:30Z", true},
+		{"0 0 11 11 *", "2026-11-11T00:01:00Z", false},
+		{"* 9-17 * * 1-5", "2026-11-11T10:00:00Z", true},  // 周三
+		{"* 9-17 * * 1-5", "2026-11-14T10:00:00Z", false}, // 周六
+		{"*/15 * * * *", "2026-11-11T10:30:00Z", true},
+		{"*/15 * * * *", "2026-11-11T10:31:00Z", false},
+		{"0,30 * * * *", "2026-11-11T10:30:00Z", true},
+		{"5/20 * * * *", "2026-11-11T10:45:00Z", true}, // 从 5 分开始每 20 分钟
+		{"5/20 * * * *", "2026-11-11T10:05:00Z", true},
+		{"5/20 * * * *", "2026-11-11T10:15:00Z", false},
+		{"* * * * 7", "2026-11-15T10:00:00Z", true}, // 周日
+		{"* * 1 * 1", "2026-11-16T10:00:00Z", true}, // 日与周都限制时满足其一即可 (周一)
+		{"* * 1 * 1", "2026-11-01T10:00:00Z", true}, // 1 号
+		{"* * 1 * 1", "2026-11-17T10:00:00Z", false},
+	}
+	for _, tt := range tests {
+		spec, err := parseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("parseCron(%q) failed: %v", tt.expr, err)
+		}
+		at, _ := time.Parse(time.RFC3339, tt.at)
+		if got := spec.match(at); got != tt.want {
+			t.Errorf("%q at %s = %v, want %v", tt.expr, tt.at, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"* * * *", "60 * * * *", "* 24 * * *", "*/0 * * * *", "a * * * *", "5-1 * * * *", "60/5 * * * *"} {
+		if _, err := parseCron(bad); err == nil {
+			t.Errorf("parseCron(%q) should fail", bad)
+		}
+	}
+}
+
+func TestSchedule_Timezone(t *testing.T) {
+	s := &Schedule{Cron: "* 9 * * *", Timezone: "Asia/Shanghai"}
+	at, _ := time.Parse(time.RFC3339, "2026-11-11T01:30:00Z") // 北京时间 09:30
+	if !s.active(at) {
+		t.Error("Expected active at 09:30 Asia/Shanghai")
+	}
+	if s.active(at.Add(time.Hour)) {
+		t.Error("Expected inactive at 10:30 Asia/Shanghai")
+	}
+	bad := &Schedule{Cron: "* * * * *", Timezone: "Nowhere/City"}
+	if bad.active(at) {
+		t.Error("Invalid timezone should never be active")
+	}
+}
+
+func TestGet_TimeWindow(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testtime:")
+	ctx := context.Background()
+
+	loc := time.FixedZone("CST", 8*3600)
+	start := time.Date(2026, 11, 11, 0, 0, 0, 0, loc)
+	end := time.Date(2026, 11, 12, 2, 0, 0, 0, loc)
+
+	p := NewPublisher(rdb, 1)
+	err := p.Publish(ctx, PublishRequest{
+		FullReplace: true,
+		Items: map[string][]RuleInput{
+			"price": {
+				{Value: 99, ValidFrom: start, ValidUntil: end},
+				{Value: 199},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	var now atomic.Int64
+	now.Store(start.Add(-time.Minute).UnixNano())
+	cfg, err := New(rdb, 1, WithClock(func() time.Time { return time.Unix(0, now.Load()) }))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	// 同一个 Getter 跨越窗口边界：AllHash 不变，但 L1 缓存必须失效
+	g := cfg.WithTags(nil)
+	check := func(at time.Time, want int) {
+		t.Helper()
+		now.Store(at.UnixNano())
+		v, err := Get[int](g, "price")
+		if err != nil || v != want {
+			t.Errorf("At %s expected %d, got %d (err: %v)", at, want, v, err)
+		}
+	}
+	check(start.Add(-time.Minute), 199)
+	check(start.Add(-time.Second), 199)
+	check(start, 99)
+	check(end.Add(-time.Second), 99)
+	check(end, 199)
+	check(end.Add(24*time.Hour), 199)
+
+	// 非法窗口被拒绝
+	err = p.Publish(ctx, PublishRequest{
+		Items: map[string][]RuleInput{"bad": {{Value: 1, ValidFrom: end, ValidUntil: start}}},
+	})
+	if err == nil {
+		t.Error("Expected error for inverted window")
+	}
+	err = p.Publish(ctx, PublishRequest{
+		Items: map[string][]RuleInput{"bad": {{Value: 1, Schedule: &Schedule{Cron: "bad"}}}},
+	})
+	if err == nil {
+		t.Error("Expected error for invalid schedule")
+	}
+}
+
+func TestGet_Schedule(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testsched:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	err := p.Publish(ctx, PublishRequest{
+		FullReplace: true,
+		Items: map[string][]RuleInput{
+			"happy_hour": {
+				{Value: true, Schedule: &Schedule{Cron: "* 18 * * *", Timezone: "Asia/Shanghai"}},
+				{Value: false},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	var now atomic.Int64
+	base, _ := time.Parse(time.RFC3339, "2026-11-11T09:59:30Z") // 北京时间 17:59:30
+	now.Store(base.UnixNano())
+	cfg, _ := New(rdb, 1, WithClock(func() time.Time { return time.Unix(0, now.Load()) }))
+	g := cfg.WithTags(nil)
+
+	if v, _ := Get[bool](g, "happy_hour"); v {
+		t.Error("Expected false before 18:00")
+	}
+	now.Store(base.Add(30 * time.Second).UnixNano())
+	if v, _ := Get[bool](g, "happy_hour"); !v {
+		t.Error("Expected true at 18:00")
+	}
+	now.Store(base.Add(time.Hour + 30*time.Second).UnixNano())
+	if v, _ := Get[bool](g, "happy_hour"); v {
+		t.Error("Expected false at 19:00")
+	}
+}
@@ -1,9 +1,60 @@
 package bttsetting
 
+import "reflect"
+
 // Rule 定义单个匹配规则。
 type Rule struct {
-	Tags      map[string]any `json:"tags"`     // 用于匹配的标签
-	ValueHash string         `json:"val_hash"` // 值内容的 Hash
+	Tags      map[string]any `json:"tags"`              // 用于匹配的标签
+	ValueHash string         `json:"val_hash"`          // 值内容的 Hash
+	Rollout   *Rollout       `json:"rollout,omitempty"` // 百分比灰度条件 (可选)
+	// Experiment 多变体实验 (可选)。存在时 ValueHash 为空，值由分桶选中的变体决定。
+	Experiment *Experiment `json:"experiment,omitempty"`
+	// Segment 人群包条件 (可选)。
+	Segment *SegmentCond `json:"segment,omitempty"`
+
+	// 时间窗口 (可选)，在客户端按注入的时钟求值。
+	ValidFrom  int64     `json:"valid_from,omitempty"`  // 生效时间 (Unix 秒，含)
+	ValidUntil int64     `json:"valid_until,omitempty"` // 失效时间 (Unix 秒，不含)
+	Schedule   *Schedule `json:"schedule,omitempty"`    // 周期性生效窗口
+
+	// Prerequisites 前置开关 (可选)，全部满足时规则才匹配。
+	Prerequisites []Prerequisite `json:"prerequisites,omitempty"`
+	// Matchers 自定义匹配器 (可选)，全部返回 true 时规则才匹配。
+	Matchers []MatcherCond `json:"matchers,omitempty"`
+}
+
+// Experiment 多变体 (A/B/n) 实验：按分桶标签加盐 Hash 后，按权重选择一个变体。
+// 权重不变时分组稳定；调整权重会按比例移动区间边界，可能改变部分用户的分组。
+type Experiment struct {
+	ID       string    `json:"id"`       // 实验 ID，写入曝光事件
+	Tag      string    `json:"tag"`      // 分桶依据的输入标签，如 user_id
+	Salt     string    `json:"salt"`     // 分桶盐值，发布时默认取实验 ID
+	Variants []Variant `json:"variants"` // 变体列表 (顺序即区间顺序)
+}
+
+// Variant 实验变体。
+type Variant struct {
+	Name      string `json:"name"`     // 变体名，写入曝光事件
+	Weight    int    `json:"weight"`   // 权重
+	ValueHash string `json:"val_hash"` // 变体值内容的 Hash
+}
+
+// RolloutBuckets 百分比灰度的分桶总数，1 个桶 = 0.01%。
+const RolloutBuckets = 10000
+
+// Rollout 百分比灰度条件：对输入标签做加盐 Hash 分桶 (0-9999)，桶号落在 [Start, End) 内才匹配。
+// 分桶只依赖 Salt 与标签值，跨快照、跨进程稳定；扩量时只增大 End，已命中的用户不会被重新洗牌。
+type Rollout struct {
+	Tag   string `json:"tag"`   // 分桶依据的输入标签，如 user_id
+	Salt  string `json:"salt"`  // 分桶盐值，发布时默认取配置 Key，使不同 Key 的分桶相互独立
+	Start int    `json:"start"` // 桶区间起点 (含)
+	End   int    `json:"end"`   // 桶区间终点 (不含)，最大 RolloutBuckets
+}
+
+// RolloutPercent 创建从 0 号桶开始、覆盖 percent% 用户的灰度条件。
+// percent 取值 0-100，精度 0.01。
+func RolloutPercent(tag string, percent float64) *Rollout {
+	return &Rollout{Tag: tag, End: percentToBuckets(percent)}
 }
 
 // HistoryRecord 版本历史记录
@@ -13,18 +64,116 @@ type HistoryRecord struct {
 	Timestamp int64  `json:"timestamp"`
 }
 
+// TagHierarchy 描述一层标签层级：当前标签的值向上映射到上级标签的值。
+// 例如 city 的层级为 {Parent: "province", Values: {"haidian": "beijing"}}。
+type TagHierarchy struct {
+	Parent string            `json:"parent"` // 上级标签 Key
+	Values map[string]string `json:"values"` // 当前标签值 -> 上级标签值
+}
+
+// 标签字典中的值类型
+const (
+	TagTypeString = "string"
+	TagTypeNumber = "number"
+	TagTypeBool   = "bool"
+)
+
+// TagDef 标签字典中单个标签 Key 的定义。
+type TagDef struct {
+	Type      string `json:"type,omitempty"`      // 值类型 (TagTypeXxx)，空表示不限
+	Values    []any  `json:"values,omitempty"`    // 允许的取值，空表示不限
+	Lowercase bool   `json:"lowercase,omitempty"` // 字符串值是否转为小写
+	Trim      bool   `json:"trim,omitempty"`      // 字符串值是否去除首尾空白
+}
+
+// KeyMetadata 单个配置 Key 的元数据。
+type KeyMetadata struct {
+	// Static 静态 Key（如监听端口、数据库 DSN）：客户端始终使用进程启动时加载的值，
+	// 之后发布的变更在重启后生效，见 Config.Status。
+	Static bool `json:"static,omitempty"`
+}
+
+// SnapshotMeta 快照级别的元数据，与 Rules 一同发布并参与 AllHash 计算。
+type SnapshotMeta struct {
+	Hierarchies map[string]TagHierarchy `json:"hierarchies,omitempty"` // 标签 Key -> 层级
+	Dictionary  map[string]TagDef       `json:"dictionary,omitempty"`  // 标签字典：允许的标签 Key -> 定义
+	Keys        map[string]KeyMetadata  `json:"keys,omitempty"`        // 配置 Key -> 元数据
+}
+
+// IsEmpty 判断元数据是否为空（为空时不写入 Redis，AllHash 与无元数据时保持一致）。
+func (m *SnapshotMeta) IsEmpty() bool {
+	return len(m.Hierarchies) == 0 && len(m.Dictionary) == 0 && len(m.Keys) == 0
+}
+
 // Snapshot 代表特定版本的配置快照。
 type Snapshot struct {
 	Version int               // 版本号 (int)
 	AllHash string            // 快照内容的全局 Hash (用于缓存失效)
 	Rules   map[string][]Rule // Key -> Rules
 	Values  map[string]string // ValueHash -> RawJSON
+	Meta    SnapshotMeta      // 快照元数据 (标签层级等)
+
+	ruleHashes map[string]string // Key -> 规则 JSON 的 Hash，Load 时计算，用于比较快照差异
+	keys       []string          // 排序后的全部 Key，Load 时计算，用于前缀查询
+}
+
+// l1Entries 同一个 Key 按不同类型读取的 L1 缓存条目，通常只有一个。
+// 写入时复制，已发布到 SharedGetter 的切片不会被修改。
+type l1Entries []CacheEntry
+
+// find 返回目标类型的条目。
+func (es l1Entries) find(typ reflect.Type) (*CacheEntry, bool) {
+	for i := range es {
+		if es[i].typ == typ {
+			return &es[i], true
+		}
+	}
+	return nil, false
+}
+
+// evaluated 返回一个仍然有效的条目。同一个 Key 的所有有效条目记录的是同一次求值的结果
+// （匹配的规则、ValueHash 与依赖），按其他类型或子路径读取、或确认 Key 未匹配时可以跳过求值。
+func (es l1Entries) evaluated(c *Config, ss *Snapshot) (*CacheEntry, bool) {
+	for i := range es {
+		if es[i].valid(c, ss) {
+			return &es[i], true
+		}
+	}
+	return nil, false
+}
+
+// with 返回写入 e 之后的新切片，替换同类型的旧条目。
+func (es l1Entries) with(e CacheEntry) l1Entries {
+	out := make(l1Entries, 0, len(es)+1)
+	for _, old := range es {
+		if old.typ != e.typ {
+			out = append(out, old)
+		}
+	}
+	return append(out, e)
 }
 
 // CacheEntry 是存储在 Getter 中的 L1 缓存条目。
 type CacheEntry struct {
 	ParsedValue  any
 	SnapshotHash string
+	// typ 读取时请求的类型 (typeID)，同一个 Key 可以在同一个 Getter 中按不同类型读取；
+	// nil 表示只记录求值结果、没有反序列化的值（GetPath 的读取或未匹配的负缓存）
+	typ reflect.Type
+	// segmentGen 求值时依赖的人群包版本，0 表示未依赖人群包。
+	// 人群包变更不会改变 AllHash，因此需要单独判断是否过期。
+	segmentGen uint64
+	// expiresAt 求值结果可能变化的最早时间 (UnixNano)，0 表示不随时间变化。
+	// 时间窗口边界到达时 AllHash 不变，因此同样需要单独判断。
+	expiresAt int64
+	// ruleIndex、valueHash、variant 记录匹配结果，供 GetDetailed 在命中缓存时输出。
+	ruleIndex int
+	valueHash string
+	variant   string
+	// volatile 求值调用了自定义匹配器，结果不进入跨 Getter 的求值缓存
+	volatile bool
+	// notFound 求值结果为 ErrNotFound（Key 不存在或没有规则匹配），此时 typ 为 nil
+	notFound bool
 }
 
 // ValueCacheItem 是 L2 缓存项 (泛型解析对象)。
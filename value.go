@@ -0,0 +1,116 @@
+package bttsetting
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+// Value 是 ValueOf 返回的单个配置值句柄，适合标签固定的热路径读取（如进程级配置）。
+// Load 只是一次原子指针读取，没有快照加载、L1 查找与类型断言；
+// 快照 AllHash 变化时由 Config.Load 重新求值并原子替换。
+type Value[T any] struct {
+	cfg    *Config
+	key    string
+	tags   map[string]any
+	state  atomic.Pointer[valueState[T]]
+	remove func()
+
+	mu   sync.Mutex
+	hash string // 当前值对应的 AllHash
+	err  error  // 最近一次求值的错误
+}
+
+// valueState 一次求值的结果，写入后只读。
+type valueState[T any] struct {
+	val T
+	// dynamic 结果依赖人群包、时间窗口或自定义匹配器，Load 时需要校验
+	dynamic    bool
+	segmentGen uint64
+	expiresAt  int64
+	volatile   bool
+}
+
+// ValueOf 返回 key 在给定标签下的配置值句柄，并在配置重载时自动重新求值。
+//
+// 初次求值失败（如 ErrNotFound、类型不匹配）时返回错误；重载时求值失败则保留上一次的值，
+// 错误记录日志并可通过 Err 获取。
+// 结果依赖人群包或时间窗口时，Load 在人群包更新或越过窗口边界后重新求值；
+// 依赖自定义匹配器时每次 Load 都重新求值，与 Get 的开销相同。
+func ValueOf[T any](cfg *Config, key string, tags map[string]any) (*Value[T], error) {
+	v := &Value[T]{cfg: cfg, key: key, tags: tags}
+	// 先注册再求值，与 Bind 相同
+	v.remove = cfg.addReloadHook(func(_, _ *Snapshot) {
+		if err := v.refresh(false); err != nil {
+			slog.Error("value refresh failed", "key", key, "err", err)
+		}
+	})
+	if err := v.refresh(false); err != nil {
+		v.remove()
+		return nil, err
+	}
+	return v, nil
+}
+
+// Load 返回当前值。
+func (v *Value[T]) Load() T {
+	st := v.state.Load()
+	if st.dynamic {
+		return v.loadDynamic(st)
+	}
+	return st.val
+}
+
+// loadDynamic 校验依赖人群包、时间窗口或自定义匹配器的结果，失效时重新求值。
+// 重新求值失败时返回上一次的值，错误可通过 Err 获取。
+func (v *Value[T]) loadDynamic(st *valueState[T]) T {
+	c := v.cfg
+	if !st.volatile &&
+		(st.segmentGen == 0 || st.segmentGen == c.segments.gen.Load()) &&
+		(st.expiresAt == 0 || c.now().UnixNano() < st.expiresAt) {
+		return st.val
+	}
+	v.refresh(true)
+	return v.state.Load().val
+}
+
+// Err 返回最近一次求值的错误，成功时为 nil。
+func (v *Value[T]) Err() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.err
+}
+
+// Close 停止随配置重载更新，Load 继续返回最后一次的值。
+func (v *Value[T]) Close() {
+	v.remove()
+}
+
+// refresh 按 Config 的当前快照重新求值；force 为 false 时快照未变化则跳过。
+func (v *Value[T]) refresh(force bool) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	ss := v.cfg.snapshot.Load().(*Snapshot)
+	if !force && v.hash == ss.AllHash && v.state.Load() != nil {
+		return nil
+	}
+
+	g := &Getter{cfg: v.cfg, rawTags: v.tags, cache: make(map[string]l1Entries), pinned: ss}
+	val, err := get[T](g, v.key, nil)
+	if err != nil {
+		v.err = err
+		return err
+	}
+	st := &valueState[T]{val: val}
+	// g 是新建的 Getter，条目都来自本次求值；不检查有效性，立即过期的结果（如人群包未能确认）也要标记为动态
+	if es := g.cache[v.key]; len(es) > 0 {
+		e := &es[0]
+		st.segmentGen, st.expiresAt, st.volatile = e.segmentGen, e.expiresAt, e.volatile
+		st.dynamic = e.segmentGen != 0 || e.expiresAt != 0 || e.volatile
+	}
+	v.state.Store(st)
+	v.hash = ss.AllHash
+	v.err = nil
+	return nil
+}
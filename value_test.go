@@ -0,0 +1,107 @@
+package bttsetting
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestValue(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testvalue:")
+	ctx := context.Background()
+
+	p := NewPublisher(rdb, 1)
+	p.Publish(ctx, PublishRequest{FullReplace: true, Items: map[string][]RuleInput{
+		"timeout": {{Tags: map[string]any{"env": "prod"}, Value: 30}, {Value: 10}},
+	}})
+	cfg, _ := New(rdb, 1)
+
+	v, err := ValueOf[int](cfg, "timeout", map[string]any{"env": "prod"})
+	if err != nil {
+		t.Fatalf("ValueOf failed: %v", err)
+	}
+	if v.Load() != 30 {
+		t.Errorf("Expected 30, got %d", v.Load())
+	}
+
+	// 重载后重新求值
+	p.Publish(ctx, PublishRequest{Items: map[string][]RuleInput{
+		"timeout": {{Tags: map[string]any{"env": "prod"}, Value: 60}, {Value: 10}},
+	}})
+	cfg.Load(ctx)
+	if v.Load() != 60 {
+		t.Errorf("Expected 60 after reload, got %d", v.Load())
+	}
+
+	// 求值失败保留上一次的值
+	p.Publish(ctx, PublishRequest{Items: map[string][]RuleInput{
+		"timeout": {{Value: "oops"}},
+	}})
+	cfg.Load(ctx)
+	var tm *TypeMismatchError
+	if v.Load() != 60 || !errors.As(v.Err(), &tm) {
+		t.Errorf("Expected previous value and type error, got %d, %v", v.Load(), v.Err())
+	}
+
+	// Close 后不再更新
+	p.Publish(ctx, PublishRequest{Items: map[string][]RuleInput{
+		"timeout": {{Value: 5}},
+	}})
+	v.Close()
+	cfg.Load(ctx)
+	if v.Load() != 60 {
+		t.Errorf("Closed value should not update, got %d", v.Load())
+	}
+
+	if _, err := ValueOf[int](cfg, "not_exist", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if len(cfg.hooks) != 0 {
+		t.Errorf("Expected no reload hooks, got %d", len(cfg.hooks))
+	}
+}
+
+func TestValue_TimeWindow(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	SetPrefix("testvalue2:")
+	ctx := context.Background()
+
+	start := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	p := NewPublisher(rdb, 1)
+	p.Publish(ctx, PublishRequest{FullReplace: true, Items: map[string][]RuleInput{
+		"price": {{Value: 99, ValidFrom: start, ValidUntil: start.Add(time.Hour)}, {Value: 199}},
+		"plain": {{Value: 1}},
+	}})
+	var now atomic.Int64
+	now.Store(start.Add(-time.Minute).UnixNano())
+	cfg, _ := New(rdb, 1, WithClock(func() time.Time { return time.Unix(0, now.Load()) }))
+
+	v, _ := ValueOf[int](cfg, "price", nil)
+	if v.Load() != 199 {
+		t.Errorf("Expected 199 before window, got %d", v.Load())
+	}
+	// 没有快照变化，越过窗口边界后同样生效
+	now.Store(start.UnixNano())
+	if v.Load() != 99 {
+		t.Errorf("Expected 99 inside window, got %d", v.Load())
+	}
+	now.Store(start.Add(time.Hour).UnixNano())
+	if v.Load() != 199 {
+		t.Errorf("Expected 199 after window, got %d", v.Load())
+	}
+
+	plain, _ := ValueOf[int](cfg, "plain", nil)
+	if plain.state.Load().dynamic {
+		t.Error("Static rule should take the fast path")
+	}
+}
@@ -0,0 +1,378 @@
+package bttsetting
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// valueKey L2 缓存的键：同一个值按不同目标类型分别缓存。
+// 直接使用 reflect.Type 比较，避免拼接字符串。
+type valueKey struct {
+	hash string
+	path string // GetPath 读取的子路径，整个值为空
+	typ  reflect.Type
+}
+
+// valueEntry L2 缓存条目。val 在写入缓存前已完整构建，之后只读；
+// 淘汰只移除缓存对条目的引用，不影响已经拿到值的并发 Get。
+type valueEntry struct {
+	key  valueKey
+	val  any
+	size int64
+	ref  atomic.Bool // CLOCK 访问位
+}
+
+// WithValueCacheLimit 限制 L2 缓存的条目数与估算字节数，0 表示不限制（默认）。
+// 超出限制时先整体丢弃上一代快照中未再被读取的值，再按 CLOCK 算法淘汰当前代的值。
+// 单个估算大小超过 maxBytes 的值不进入缓存，每次读取都重新反序列化。
+func WithValueCacheLimit(maxEntries int, maxBytes int64) Option {
+	return func(c *Config) {
+		c.valueCache.maxEntries = maxEntries
+		c.valueCache.maxBytes = maxBytes
+	}
+}
+
+// ValueCacheStats L2 缓存统计。
+type ValueCacheStats struct {
+	Hits       uint64
+	Misses     uint64
+	Evictions  uint64
+	Entries    int
+	Bytes      int64         // 缓存值的估算大小，未限制字节数时不估算，为 0
+	Decodes    uint64        // 反序列化次数（含失败）
+	DecodeTime time.Duration // 反序列化累计耗时
+}
+
+// ValueCacheStats 返回 L2 缓存统计。
+func (c *Config) ValueCacheStats() ValueCacheStats {
+	vc := &c.valueCache
+	vc.mu.RLock()
+	entries, bytes := len(vc.cur)+len(vc.prev), vc.curBytes+vc.prevBytes
+	vc.mu.RUnlock()
+	return ValueCacheStats{
+		Hits:       vc.hits.Load(),
+		Misses:     vc.misses.Load(),
+		Evictions:  vc.evictions.Load(),
+		Entries:    entries,
+		Bytes:      bytes,
+		Decodes:    vc.decodes.Load(),
+		DecodeTime: time.Duration(vc.decodeNanos.Load()),
+	}
+}
+
+// valueCache 全局反序列化缓存 (L2)，按快照代际分为 cur 与 prev 两代，零值可用。
+//
+// 快照切换时只需轮换代际 (O(1))：新快照下首次读取的值从 prev 移到 cur，
+// 再下一次切换时 prev 中未被新快照读取的值（包括已不在快照中的值）整体丢弃。
+// 值按内容寻址，Hash 相同即内容相同，跨快照复用是安全的。
+type valueCache struct {
+	maxEntries int
+	maxBytes   int64
+
+	mu        sync.RWMutex
+	cur       map[valueKey]*valueEntry
+	ring      []*valueEntry // cur 中的条目，CLOCK 淘汰顺序
+	hand      int
+	curBytes  int64
+	prev      map[valueKey]*valueEntry
+	prevBytes int64
+
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	evictions   atomic.Uint64
+	decodes     atomic.Uint64
+	decodeNanos atomic.Int64
+}
+
+// get 查找缓存值，命中上一代时移到当前代。
+func (vc *valueCache) get(k valueKey) (any, bool) {
+	vc.mu.RLock()
+	e, ok := vc.cur[k]
+	if !ok {
+		_, inPrev := vc.prev[k]
+		vc.mu.RUnlock()
+		if inPrev {
+			return vc.promote(k)
+		}
+		vc.misses.Add(1)
+		return nil, false
+	}
+	vc.mu.RUnlock()
+
+	if !e.ref.Load() {
+		e.ref.Store(true)
+	}
+	vc.hits.Add(1)
+	return e.val, true
+}
+
+// promote 把上一代的条目移到当前代。
+func (vc *valueCache) promote(k valueKey) (any, bool) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	if e, ok := vc.cur[k]; ok {
+		// 并发读取已完成提升
+		vc.hits.Add(1)
+		return e.val, true
+	}
+	e, ok := vc.prev[k]
+	if !ok {
+		// 期间发生了轮换或淘汰
+		vc.misses.Add(1)
+		return nil, false
+	}
+	delete(vc.prev, k)
+	vc.prevBytes -= e.size
+	vc.insert(e)
+	vc.hits.Add(1)
+	return e.val, true
+}
+
+// put 写入完整构建的值。
+func (vc *valueCache) put(k valueKey, v any, size int64) {
+	if vc.maxBytes > 0 && size > vc.maxBytes {
+		return
+	}
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	if old, ok := vc.cur[k]; ok {
+		// 并发反序列化了同一个值，保留已有条目
+		old.ref.Store(true)
+		return
+	}
+	if old, ok := vc.prev[k]; ok {
+		delete(vc.prev, k)
+		vc.prevBytes -= old.size
+	}
+	vc.insert(&valueEntry{key: k, val: v, size: size})
+}
+
+// insert 把条目加入当前代并按需淘汰，需持有写锁。
+// 有条目被淘汰时新条目写入被淘汰的槽位，hand 前移越过它，新条目在其他条目之后才被扫描到；
+// 否则追加到环尾。
+func (vc *valueCache) insert(e *valueEntry) {
+	if vc.cur == nil {
+		vc.cur = make(map[valueKey]*valueEntry)
+	}
+	vc.cur[e.key] = e
+	vc.curBytes += e.size
+	if free := vc.evict(); free >= 0 {
+		vc.ring[free] = e
+		vc.hand = free + 1
+		return
+	}
+	if vc.hand >= len(vc.ring) {
+		// hand 已越过环尾，回到环首，避免追加的条目正好位于 hand 处
+		vc.hand = 0
+	}
+	vc.ring = append(vc.ring, e)
+}
+
+// overLimit 是否超出限制，需持有锁。
+func (vc *valueCache) overLimit() bool {
+	return (vc.maxEntries > 0 && len(vc.cur)+len(vc.prev) > vc.maxEntries) ||
+		(vc.maxBytes > 0 && vc.curBytes+vc.prevBytes > vc.maxBytes)
+}
+
+// evict 淘汰条目直到满足限制，需持有写锁；返回留给新条目的空槽位，没有淘汰时返回 -1。
+// 上一代整体丢弃；当前代按 CLOCK：访问位为 1 的条目清零后跳过，为 0 的条目淘汰。
+// 第一个被淘汰的条目留下空槽位；按字节限额需要继续淘汰时，把环尾移到被淘汰的位置，环中最多一个空槽位，
+// 每次淘汰都是 O(1)。
+func (vc *valueCache) evict() int {
+	if !vc.overLimit() {
+		return -1
+	}
+	if len(vc.prev) > 0 {
+		vc.evictions.Add(uint64(len(vc.prev)))
+		vc.prev, vc.prevBytes = nil, 0
+	}
+	free := -1
+	// 每个条目最多被跳过一次，两圈内必然找到可淘汰的条目
+	for vc.overLimit() {
+		live := len(vc.ring)
+		if free >= 0 {
+			live--
+		}
+		if live == 0 {
+			break
+		}
+		if vc.hand >= len(vc.ring) {
+			vc.hand = 0
+		}
+		v := vc.ring[vc.hand]
+		if v == nil {
+			// 本次留下的空槽位
+			vc.hand++
+			continue
+		}
+		if v.ref.Load() {
+			v.ref.Store(false)
+			vc.hand++
+			continue
+		}
+		delete(vc.cur, v.key)
+		vc.curBytes -= v.size
+		vc.evictions.Add(1)
+		if free < 0 {
+			vc.ring[vc.hand] = nil
+			free = vc.hand
+			vc.hand++
+			continue
+		}
+		// 已有空槽位：环尾移到 hand 处，hand 不动，下一轮扫描移过来的条目
+		last := len(vc.ring) - 1
+		if last == free {
+			free = vc.hand
+		}
+		vc.ring[vc.hand] = vc.ring[last]
+		vc.ring[last] = nil
+		vc.ring = vc.ring[:last]
+	}
+	return free
+}
+
+// rotate 在快照切换时开始新的一代。
+func (vc *valueCache) rotate() {
+	vc.mu.Lock()
+	vc.prev, vc.prevBytes = vc.cur, vc.curBytes
+	vc.cur, vc.curBytes = make(map[valueKey]*valueEntry, len(vc.prev)), 0
+	vc.ring, vc.hand = nil, 0
+	vc.mu.Unlock()
+}
+
+// len 返回两代缓存的条目总数。
+func (vc *valueCache) len() int {
+	vc.mu.RLock()
+	defer vc.mu.RUnlock()
+	return len(vc.cur) + len(vc.prev)
+}
+
+// decodeValue 从 L2 缓存读取 valueHash 对应的 T，未命中时反序列化 rawJSON 并写入缓存。
+// 命中时不分配内存。转换规则见 unmarshalValue。
+func decodeValue[T any](c *Config, valueHash, rawJSON string) (T, ValueSource, error) {
+	vc := &c.valueCache
+	k := valueKey{hash: valueHash, typ: typeOf[T]()}
+	if cached, ok := vc.get(k); ok {
+		return cached.(T), SourceL2, nil
+	}
+
+	var val T
+	if err := vc.unmarshal(rawJSON, &val, k.typ); err != nil {
+		var zero T
+		return zero, SourceDecode, err
+	}
+	// 值完整构建后才写入缓存
+	vc.put(k, val, vc.entrySize(reflect.ValueOf(&val).Elem()))
+	return val, SourceDecode, nil
+}
+
+// decodeValueOf 与 decodeValue 相同，按运行时类型 typ 读取（用于 Bind 的字段），与 decodeValue 共用 L2 缓存条目。
+func decodeValueOf(c *Config, valueHash, rawJSON string, typ reflect.Type) (reflect.Value, ValueSource, error) {
+	vc := &c.valueCache
+	k := valueKey{hash: valueHash, typ: typ}
+	if cached, ok := vc.get(k); ok {
+		return valueOf(cached, typ), SourceL2, nil
+	}
+
+	ptr := reflect.New(typ)
+	if err := vc.unmarshal(rawJSON, ptr.Interface(), typ); err != nil {
+		return reflect.Value{}, SourceDecode, err
+	}
+	val := ptr.Elem()
+	vc.put(k, val.Interface(), vc.entrySize(val))
+	return val, SourceDecode, nil
+}
+
+// valueOf 把缓存中的值还原为 typ 类型的 reflect.Value（nil 接口值还原为零值）。
+func valueOf(v any, typ reflect.Type) reflect.Value {
+	if v == nil {
+		return reflect.Zero(typ)
+	}
+	return reflect.ValueOf(v)
+}
+
+// unmarshal 反序列化 rawJSON 并记录次数与耗时。
+func (vc *valueCache) unmarshal(rawJSON string, out any, typ reflect.Type) error {
+	start := time.Now()
+	err := unmarshalValue(rawJSON, out, typ)
+	vc.decodeNanos.Add(int64(time.Since(start)))
+	vc.decodes.Add(1)
+	return err
+}
+
+// entrySize 返回写入缓存时记录的大小。未限制字节数时大小不参与淘汰，跳过估算。
+func (vc *valueCache) entrySize(v reflect.Value) int64 {
+	if vc.maxBytes == 0 {
+		return 0
+	}
+	return estimateSize(v)
+}
+
+// estimateSize 估算反序列化结果占用的内存字节数（近似值，用于缓存限额）。
+// 反序列化得到的值不含环，按树形遍历即可；自定义解码器的结果可能含环（或很深），
+// 超过 maxSizeDepth 层的引用不再计入。
+func estimateSize(v reflect.Value) int64 {
+	return sizeAt(v, 0)
+}
+
+// maxSizeDepth estimateSize 遍历的最大引用深度。
+const maxSizeDepth = 32
+
+func sizeAt(v reflect.Value, depth int) int64 {
+	return int64(v.Type().Size()) + indirectSize(v, depth)
+}
+
+// indirectSize 估算 v 引用的堆内存（不含 v 本身）。
+func indirectSize(v reflect.Value, depth int) int64 {
+	if depth >= maxSizeDepth {
+		return 0
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return int64(v.Len())
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		return sizeAt(v.Elem(), depth+1)
+	case reflect.Slice:
+		if v.IsNil() {
+			return 0
+		}
+		n := int64(v.Cap()) * int64(v.Type().Elem().Size())
+		for i := 0; i < v.Len(); i++ {
+			n += indirectSize(v.Index(i), depth+1)
+		}
+		return n
+	case reflect.Array:
+		var n int64
+		for i := 0; i < v.Len(); i++ {
+			n += indirectSize(v.Index(i), depth+1)
+		}
+		return n
+	case reflect.Struct:
+		var n int64
+		for i := 0; i < v.NumField(); i++ {
+			n += indirectSize(v.Field(i), depth+1)
+		}
+		return n
+	case reflect.Map:
+		if v.IsNil() {
+			return 0
+		}
+		// 每个条目按键值大小加上桶的固定开销估算
+		const mapEntryOverhead = 16
+		t := v.Type()
+		n := int64(v.Len()) * (int64(t.Key().Size()) + int64(t.Elem().Size()) + mapEntryOverhead)
+		iter := v.MapRange()
+		for iter.Next() {
+			n += indirectSize(iter.Key(), depth+1) + indirectSize(iter.Value(), depth+1)
+		}
+		return n
+	}
+	return 0
+}
@@ -0,0 +1,254 @@
+package bttsetting
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// valueCacheHas 返回键是否位于当前代、上一代（不触发提升）。
+func valueCacheHas(vc *valueCache, k valueKey) (inCur, inPrev bool) {
+	vc.mu.RLock()
+	defer vc.mu.RUnlock()
+	_, inCur = vc.cur[k]
+	_, inPrev = vc.prev[k]
+	return inCur, inPrev
+}
+
+func TestDecodeValue(t *testing.T) {
+	cfg := &Config{}
+
+	v, src, err := decodeValue[int](cfg, "h1", "42")
+	if err != nil || v != 42 || src != SourceDecode {
+		t.Fatalf("Unexpected first decode: %v, %s, %v", v, src, err)
+	}
+	v, src, _ = decodeValue[int](cfg, "h1", "42")
+	if v != 42 || src != SourceL2 {
+		t.Errorf("Expected l2 hit, got %v, %s", v, src)
+	}
+
+	// 同一个值按不同类型分别缓存
+	f, src, _ := decodeValue[float64](cfg, "h1", "42")
+	if f != 42 || src != SourceDecode {
+		t.Errorf("Expected separate entry for float64, got %v, %s", f, src)
+	}
+	if n := cfg.valueCache.len(); n != 2 {
+		t.Errorf("Expected 2 entries, got %d", n)
+	}
+
+	// 反序列化失败不缓存
+	if _, _, err := decodeValue[int](cfg, "h2", `"x"`); err == nil {
+		t.Error("Expected unmarshal error")
+	}
+	if n := cfg.valueCache.len(); n != 2 {
+		t.Errorf("Failed decode should not be cached, got %d entries", n)
+	}
+
+	s := cfg.ValueCacheStats()
+	if s.Hits != 1 || s.Misses != 3 || s.Decodes != 3 || s.Entries != 2 || s.Bytes != 0 || s.DecodeTime <= 0 {
+		t.Errorf("Unexpected stats: %+v", s)
+	}
+}
+
+func TestValueCache_Rotate(t *testing.T) {
+	cfg := &Config{}
+	decodeValue[string](cfg, "keep", `"a"`)
+	decodeValue[string](cfg, "drop", `"b"`)
+
+	cfg.valueCache.rotate()
+	// 新一代读取 keep，移到当前代
+	if _, src, _ := decodeValue[string](cfg, "keep", `"a"`); src != SourceL2 {
+		t.Errorf("Expected l2 hit from previous generation, got %s", src)
+	}
+	if cur, prev := valueCacheHas(&cfg.valueCache, valueKey{hash: "keep", typ: reflect.TypeOf("")}); !cur || prev {
+		t.Errorf("Expected entry moved to current generation, cur=%v prev=%v", cur, prev)
+	}
+
+	cfg.valueCache.rotate()
+	if _, src, _ := decodeValue[string](cfg, "keep", `"a"`); src != SourceL2 {
+		t.Errorf("Promoted value should survive rotation, got %s", src)
+	}
+	if _, src, _ := decodeValue[string](cfg, "drop", `"b"`); src != SourceDecode {
+		t.Errorf("Unused value should be dropped after two rotations, got %s", src)
+	}
+}
+
+func TestValueCache_EntryLimit(t *testing.T) {
+	cfg := &Config{}
+	WithValueCacheLimit(3, 0)(cfg)
+
+	for i := 0; i < 3; i++ {
+		decodeValue[int](cfg, fmt.Sprint(i), "1")
+	}
+	// 访问 0，使其在 CLOCK 扫描中被跳过一次
+	decodeValue[int](cfg, "0", "1")
+	decodeValue[int](cfg, "3", "1")
+
+	s := cfg.ValueCacheStats()
+	if s.Entries != 3 || s.Evictions != 1 {
+		t.Errorf("Unexpected stats: %+v", s)
+	}
+	if cur, _ := valueCacheHas(&cfg.valueCache, valueKey{hash: "0", typ: reflect.TypeOf(0)}); !cur {
+		t.Error("Recently used entry should survive eviction")
+	}
+	if cur, _ := valueCacheHas(&cfg.valueCache, valueKey{hash: "3", typ: reflect.TypeOf(0)}); !cur {
+		t.Error("Newly inserted entry should be cached")
+	}
+
+	// 超限时先整体丢弃上一代
+	cfg.valueCache.rotate()
+	decodeValue[int](cfg, "0", "1") // 提升
+	decodeValue[int](cfg, "4", "1")
+	decodeValue[int](cfg, "5", "1")
+	if cur, prev := valueCacheHas(&cfg.valueCache, valueKey{hash: "1", typ: reflect.TypeOf(0)}); cur || prev {
+		t.Error("Previous generation should be dropped first")
+	}
+	if n := cfg.valueCache.len(); n != 3 {
+		t.Errorf("Expected 3 entries, got %d", n)
+	}
+}
+
+func TestValueCache_NewestSurvives(t *testing.T) {
+	cfg := &Config{}
+	WithValueCacheLimit(3, 0)(cfg)
+
+	for i := 0; i < 3; i++ {
+		decodeValue[int](cfg, fmt.Sprint(i), "1")
+	}
+	// 淘汰 0 之后 hand 停在原位置，新插入的 3 不能被移到那里
+	decodeValue[int](cfg, "3", "1")
+	decodeValue[int](cfg, "4", "1")
+
+	if cur, _ := valueCacheHas(&cfg.valueCache, valueKey{hash: "3", typ: reflect.TypeOf(0)}); !cur {
+		t.Error("Entry inserted before the last eviction should survive it")
+	}
+	if cur, _ := valueCacheHas(&cfg.valueCache, valueKey{hash: "1", typ: reflect.TypeOf(0)}); cur {
+		t.Error("Expected the next entry in scan order to be evicted")
+	}
+	if s := cfg.ValueCacheStats(); s.Entries != 3 || s.Evictions != 2 {
+		t.Errorf("Unexpected stats: %+v", s)
+	}
+}
+
+func TestValueCache_ByteLimit(t *testing.T) {
+	cfg := &Config{}
+	str := fmt.Sprintf("%0512d", 0)
+	big := `"` + str + `"`
+	size := estimateSize(reflect.ValueOf(str))
+	WithValueCacheLimit(0, 2*size+size/2)(cfg)
+
+	decodeValue[string](cfg, "a", big)
+	decodeValue[string](cfg, "b", big)
+	decodeValue[string](cfg, "c", big)
+	s := cfg.ValueCacheStats()
+	if s.Entries != 2 || s.Bytes > 2*size+size/2 || s.Evictions != 1 {
+		t.Errorf("Unexpected stats: %+v (entry size %d)", s, size)
+	}
+
+	// 超过整体限额的值不缓存
+	huge := fmt.Sprintf(`"%04096d"`, 0)
+	decodeValue[string](cfg, "huge", huge)
+	if _, src, _ := decodeValue[string](cfg, "huge", huge); src != SourceDecode {
+		t.Errorf("Oversized value should not be cached, got %s", src)
+	}
+}
+
+func TestValueCache_ByteLimitEvictsSeveral(t *testing.T) {
+	cfg := &Config{}
+	small, large := fmt.Sprintf("%064d", 0), fmt.Sprintf("%0512d", 0)
+	size := estimateSize(reflect.ValueOf(small))
+	WithValueCacheLimit(0, estimateSize(reflect.ValueOf(large))+2*size)(cfg)
+
+	for i := 0; i < 8; i++ {
+		decodeValue[string](cfg, fmt.Sprint(i), `"`+small+`"`)
+	}
+	// 一个大值需要淘汰多个小值，环中的条目与当前代保持一致
+	decodeValue[string](cfg, "large", `"`+large+`"`)
+	decodeValue[string](cfg, "8", `"`+small+`"`)
+	vc := &cfg.valueCache
+	n := 0
+	for _, e := range vc.ring {
+		if e == nil || vc.cur[e.key] != e {
+			t.Fatalf("Ring out of sync with the current generation: %v", e)
+		}
+		n++
+	}
+	if n != len(vc.cur) {
+		t.Errorf("Expected %d ring entries, got %d", len(vc.cur), n)
+	}
+	for _, h := range []string{"large", "8"} {
+		if cur, _ := valueCacheHas(vc, valueKey{hash: h, typ: reflect.TypeOf("")}); !cur {
+			t.Errorf("Expected %s to be cached", h)
+		}
+	}
+	if s := cfg.ValueCacheStats(); s.Bytes > vc.maxBytes {
+		t.Errorf("Unexpected stats: %+v", s)
+	}
+}
+
+func TestValueCache_ConcurrentEviction(t *testing.T) {
+	cfg := &Config{}
+	WithValueCacheLimit(8, 0)(cfg)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				n := (i*7 + w) % 32
+				raw := fmt.Sprintf(`{"n":%d,"items":[1,2,3]}`, n)
+				v, _, err := decodeValue[map[string]any](cfg, fmt.Sprint(n), raw)
+				// 淘汰不会让并发读取拿到不完整的值
+				if err != nil || v["n"] != float64(n) || len(v["items"].([]any)) != 3 {
+					t.Errorf("Unexpected value %v, %v", v, err)
+					return
+				}
+				if i%100 == 0 {
+					cfg.valueCache.rotate()
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	if n := cfg.valueCache.len(); n > 8 {
+		t.Errorf("Expected at most 8 entries, got %d", n)
+	}
+}
+
+func TestEstimateSize(t *testing.T) {
+	type limits struct {
+		Name  string
+		Rates []float64
+		Tags  map[string]string
+	}
+	small := estimateSize(reflect.ValueOf(limits{Name: "a"}))
+	large := estimateSize(reflect.ValueOf(limits{
+		Name:  "a",
+		Rates: make([]float64, 100),
+		Tags:  map[string]string{"k": string(make([]byte, 1000))},
+	}))
+	if small <= 0 || large < small+800+1000 {
+		t.Errorf("Unexpected estimates: small %d, large %d", small, large)
+	}
+
+	var v any = map[string]any{"s": "hello", "n": 1.0, "l": []any{"x"}}
+	if n := estimateSize(reflect.ValueOf(&v).Elem()); n < 5+1 {
+		t.Errorf("Estimate too small: %d", n)
+	}
+}
+
+func TestDecodeValue_ZeroAllocHit(t *testing.T) {
+	cfg := &Config{}
+	decodeValue[map[string]int](cfg, "h", `{"a":1}`)
+	decodeValue[int](cfg, "i", `1`)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		decodeValue[map[string]int](cfg, "h", `{"a":1}`)
+		decodeValue[int](cfg, "i", `1`)
+	})
+	if allocs != 0 {
+		t.Errorf("Expected allocation-free L2 hits, got %.1f allocs", allocs)
+	}
+}
@@ -34,6 +34,11 @@ func (c *Config) Watch(ctx context.Context) error {
 			slog.Info("version hash mismatch detected, reloading", "local", currentSS.AllHash, "remote", remoteHash)
 			_ = c.Load(ctx)
 		}
+
+		// 人群包版本独立于 AllHash，单独检查
+		if err := c.segments.refresh(ctx); err != nil {
+			slog.Error("refresh segments failed", "err", err)
+		}
 	}
 
 	// 1. 启动时立即检查一次（防止 New 和 Watch 之间的 Gap 导致漏更）
@@ -87,6 +92,12 @@ func (c *Config) Watch(ctx context.Context) error {
 					continue
 				}
 
+				// 人群包变更与应用版本无关，直接应用增量
+				if updateMsg.Event == EventSegment {
+					c.segments.applyDelta(ctx, &updateMsg)
+					continue
+				}
+
 				// 处理更新
 				// 仅当发布的版本号与当前客户端应用版本一致时才加载
 				if updateMsg.Version == c.version {